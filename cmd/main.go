@@ -1,21 +1,78 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
 	"github.com/KianoushAmirpour/notification_server/internal/application"
 	config "github.com/KianoushAmirpour/notification_server/internal/infrastructure/configs"
 )
 
+const usage = `usage: notification_server <command> [flags]
+
+commands:
+  all                          run the API, workers and schedulers in one process (default)
+  serve                        run the HTTP API
+  worker --streams=story,email run the worker pools of the given streams
+  scheduler                    run the retry schedulers, outbox relay and story schedules
+  migrate [up|down|status|...] run database migrations (default up)
+`
+
 // @title Notification Service API
 // @version 1.0
 // @description REST API for notifications
 // @host localhost:4000
 // @BasePath /
 func main() {
+	command, args := "all", []string{}
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+
 	cfg, err := config.LoadConfigs(".env")
 	if err != nil {
 		panic(err)
 	}
 
 	app := application.App{Cfg: cfg}
-	app.Run()
+
+	switch command {
+	case "all":
+		err = app.Run()
+	case "serve":
+		err = app.Serve()
+	case "worker":
+		fs := flag.NewFlagSet("worker", flag.ExitOnError)
+		streams := fs.String("streams", "story,email", "comma separated streams to consume: story, email")
+		_ = fs.Parse(args)
+		err = app.Work(splitStreams(*streams))
+	case "scheduler":
+		err = app.Schedule()
+	case "migrate":
+		migrateCommand := "up"
+		if len(args) > 0 {
+			migrateCommand, args = args[0], args[1:]
+		}
+		err = app.Migrate(migrateCommand, args...)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		os.Exit(1)
+	}
+}
+
+func splitStreams(s string) []string {
+	var streams []string
+	for _, stream := range strings.Split(s, ",") {
+		if stream = strings.TrimSpace(stream); stream != "" {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
 }
@@ -0,0 +1,36 @@
+package dto
+
+import "time"
+
+type AccountExport struct {
+	Profile     ExportedProfile    `json:"profile"`
+	Preferences []string           `json:"preferences"`
+	Stories     []ExportedStory    `json:"stories"`
+	StoryJobs   []ExportedJob      `json:"story_jobs"`
+	EmailJobs   []ExportedJob      `json:"email_jobs"`
+	Schedules   []ScheduleResponse `json:"schedules"`
+	ExportedAt  time.Time          `json:"exported_at"`
+}
+
+type ExportedProfile struct {
+	ID        int       `json:"id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Plan      string    `json:"plan"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportedStory struct {
+	ID        int       `json:"id"`
+	FileName  string    `json:"file_name"`
+	Story     string    `json:"story"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportedJob struct {
+	ID      int    `json:"id"`
+	StoryID int    `json:"story_id"`
+	Status  string `json:"status"`
+}
@@ -0,0 +1,21 @@
+package dto
+
+import "time"
+
+type AuditEventResponse struct {
+	ID        int64             `json:"id"`
+	EventType string            `json:"event_type"`
+	Outcome   string            `json:"outcome"`
+	ActorID   *int              `json:"actor_id"`
+	UserID    *int              `json:"user_id"`
+	RequestID string            `json:"request_id"`
+	ClientIP  string            `json:"client_ip"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type AuditEventsResponse struct {
+	Events []AuditEventResponse `json:"events"`
+	// NextCursor is passed as before to fetch the next page, 0 on the last one.
+	NextCursor int64 `json:"next_cursor"`
+}
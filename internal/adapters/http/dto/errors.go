@@ -61,6 +61,12 @@ func MapDomainErrToHttpErr(err *domain.DomainError) HttpError {
 			Code:       err.Code,
 			StatusCode: http.StatusConflict,
 		}
+	case domain.ErrCodePrecondition:
+		return HttpError{
+			Message:    err.Message,
+			Code:       err.Code,
+			StatusCode: http.StatusPreconditionFailed,
+		}
 	case domain.ErrCodeRateLimited:
 		return HttpError{
 			Message:    err.Message,
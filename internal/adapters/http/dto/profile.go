@@ -0,0 +1,29 @@
+package dto
+
+import "time"
+
+type Profile struct {
+	ID        int       `json:"id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Plan      string    `json:"plan"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProfileUpdate is a partial update, omitted fields are left unchanged.
+type ProfileUpdate struct {
+	FirstName *string `json:"first_name" validate:"omitnil,min=1,max=256"`
+	LastName  *string `json:"last_name" validate:"omitnil,min=1,max=256"`
+}
+
+type UserPreferences struct {
+	Preferences []string `json:"preferences" validate:"required,unique,user_preferences_check"`
+}
+
+type UserPreferencesResponse struct {
+	Preferences []string  `json:"preferences"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,20 @@
+package dto
+
+import "time"
+
+type Schedule struct {
+	CronExpr        string `json:"cron" validate:"required,max=128"`
+	TimeZone        string `json:"time_zone" validate:"required,max=64"`
+	MissedRunPolicy string `json:"missed_run_policy" validate:"omitempty,oneof=skip run_once"`
+	Enabled         *bool  `json:"enabled"`
+}
+
+type ScheduleResponse struct {
+	ID              int        `json:"id"`
+	CronExpr        string     `json:"cron"`
+	TimeZone        string     `json:"time_zone"`
+	MissedRunPolicy string     `json:"missed_run_policy"`
+	Enabled         bool       `json:"enabled"`
+	NextRunAt       time.Time  `json:"next_run_at"`
+	LastRunAt       *time.Time `json:"last_run_at"`
+}
@@ -17,14 +17,82 @@ type RegisteredUser struct {
 	Preferences []string `json:"preferences" validate:"required,unique,user_preferences_check"`
 }
 
+// RegisterVerify names the registration by the verification_id returned at
+// registration, or by its email.
 type RegisterVerify struct {
-	SentOtpbyUser string `json:"otp" validate:"required"`
+	VerificationID string `json:"verification_id" validate:"required_without=Email,omitempty,uuid"`
+	Email          string `json:"email" validate:"required_without=VerificationID,omitempty,email"`
+	SentOtpbyUser  string `json:"otp" validate:"required"`
+}
+
+type ResendVerification struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
 }
 
 type LoginUser struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
-type DeleteUser struct {
-	UserID int `json:"user_id" validate:"required,gte=0"`
+
+// DeleteAccount confirms a self-service deletion with the password or the
+// code emailed by POST /users/me/deletion-otp.
+type DeleteAccount struct {
+	Password string `json:"password" validate:"required_without=OTP"`
+	OTP      string `json:"otp" validate:"required_without=Password"`
+}
+
+// RestoreAccount proves a deleted account is the caller's with its password
+// or the code emailed by POST /auth/restore/otp.
+type RestoreAccount struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required_without=OTP"`
+	OTP      string `json:"otp" validate:"required_without=Password"`
+}
+
+// RestoreAccountOTP asks for the code that confirms POST /auth/restore.
+type RestoreAccountOTP struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// EmailChange starts an email change, confirmed with the current password.
+type EmailChange struct {
+	Email    string `json:"email" validate:"required,email,max=256"`
+	Password string `json:"password" validate:"required"`
+}
+
+type MFACode struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// MFALogin carries the second login step; Code is a TOTP or a recovery code.
+type MFALogin struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=64"`
+}
+
+// MFAEnroll confirms the account password before a new authenticator is set up.
+type MFAEnroll struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type MFAEnrollment struct {
+	OtpauthURI    string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type EmailChangeVerify struct {
+	OTP string `json:"otp" validate:"required"`
+}
+
+type UserRole struct {
+	Role string `json:"role" validate:"required,oneof=user admin support"`
+}
+
+type UserRoleResponse struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
 }
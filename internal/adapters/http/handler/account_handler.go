@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/dto"
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type AccountHandler struct {
+	UserSvc        *usecase.UserService
+	AccountSvc     *usecase.AccountDataService
+	GracePeriod    time.Duration
+	OtpExpiration  int
+	ResendCooldown time.Duration
+	Logger         domain.LoggingRepository
+}
+
+func NewAccountHandler(usersvc *usecase.UserService, accountsvc *usecase.AccountDataService, gracePeriod time.Duration, otpExpiration int, resendCooldown time.Duration, logger domain.LoggingRepository) *AccountHandler {
+	return &AccountHandler{UserSvc: usersvc, AccountSvc: accountsvc, GracePeriod: gracePeriod, OtpExpiration: otpExpiration, ResendCooldown: resendCooldown, Logger: logger}
+}
+
+func toAccountExport(e *domain.UserExport) dto.AccountExport {
+	export := dto.AccountExport{
+		Profile: dto.ExportedProfile{
+			ID:        e.Profile.ID,
+			FirstName: e.Profile.FirstName,
+			LastName:  e.Profile.LastName,
+			Email:     e.Profile.Email,
+			Plan:      e.Profile.Plan,
+			Role:      e.Profile.Role,
+			CreatedAt: e.Profile.CreatedAt,
+		},
+		Preferences: e.Preferences,
+		Stories:     make([]dto.ExportedStory, 0, len(e.Stories)),
+		StoryJobs:   make([]dto.ExportedJob, 0, len(e.StoryJobs)),
+		EmailJobs:   make([]dto.ExportedJob, 0, len(e.EmailJobs)),
+		Schedules:   make([]dto.ScheduleResponse, 0, len(e.Schedules)),
+		ExportedAt:  e.ExportedAt,
+	}
+	for _, s := range e.Stories {
+		export.Stories = append(export.Stories, dto.ExportedStory(s))
+	}
+	for _, j := range e.StoryJobs {
+		export.StoryJobs = append(export.StoryJobs, dto.ExportedJob(j))
+	}
+	for _, j := range e.EmailJobs {
+		export.EmailJobs = append(export.EmailJobs, dto.ExportedJob(j))
+	}
+	for i := range e.Schedules {
+		export.Schedules = append(export.Schedules, toScheduleResponse(&e.Schedules[i]))
+	}
+	return export
+}
+
+// zipExport lays the export out as one JSON file per section, plus every
+// story as a plain-text file.
+func zipExport(export dto.AccountExport) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	files := map[string]any{
+		"profile.json":     export.Profile,
+		"preferences.json": export.Preferences,
+		"stories.json":     export.Stories,
+		"jobs.json":        map[string]any{"story_jobs": export.StoryJobs, "email_jobs": export.EmailJobs},
+		"schedules.json":   export.Schedules,
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(content); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range export.Stories {
+		w, err := zw.Create(fmt.Sprintf("stories/%d-%s.txt", s.ID, path.Base(s.FileName)))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(s.Story)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportAccountHandler godoc
+// @Summary Export your data
+// @Description Returns everything stored about the authenticated user: profile, preferences, stories, job history and schedules. A ZIP archive by default, a single JSON document with format=json.
+// @Tags Users
+// @Produce application/zip
+// @Produce json
+// @Param format query string false "zip or json" default(zip)
+// @Success 200 {object} dto.AccountExport "Account export"
+// @Failure 400 {object} dto.HttpError "Unknown format"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 404 {object} dto.HttpError "User not found"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /users/me/export [get]
+func (h *AccountHandler) ExportAccountHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", "zip")
+	if format != "zip" && format != "json" {
+		respond(c, 0, nil, domain.NewDomainError(domain.ErrCodeValidation, "format must be zip or json", nil))
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	data, err := h.AccountSvc.ExportAccount(c.Request.Context(), userID)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	export := toAccountExport(data)
+
+	c.Header("Cache-Control", "no-store")
+	if format == "json" {
+		respond(c, http.StatusOK, export, nil)
+		return
+	}
+
+	archive, err := zipExport(export)
+	if err != nil {
+		respond(c, 0, nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to build export archive", err))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%d-%s.zip"`, userID, export.ExportedAt.Format("20060102")))
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// RequestRestoreOTPHandler godoc
+// @Summary Request an account restoration code
+// @Description Emails a one-time code that confirms POST /auth/restore, for accounts without a password or users who forgot it. The answer is the same whether or not a deleted account exists.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body dto.RestoreAccountOTP true "Email of the deleted account"
+// @Success 202 {object} map[string]string "Code sent if a deleted account exists"
+// @Failure 400 {object} dto.HttpError "Bad request"
+// @Failure 429 {object} dto.HttpError "A code was sent recently"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Failure 503 {object} dto.HttpError "External service error"
+// @Router /auth/restore/otp [post]
+func (h *AccountHandler) RequestRestoreOTPHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.RestoreAccountOTP)
+
+	resp, err := h.UserSvc.RequestAccountRestoration(c.Request.Context(), req.Email, h.OtpExpiration, h.ResendCooldown)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusAccepted, gin.H{"Message": resp.Message}, nil)
+}
+
+// RestoreAccountHandler godoc
+// @Summary Restore a deleted account
+// @Description Restores an account the user deleted within the grace period, confirmed with its password or a code from /auth/restore/otp. Accounts deleted by an admin cannot be restored.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body dto.RestoreAccount true "Email and password or otp of the deleted account"
+// @Success 200 {object} map[string]string "Account restored"
+// @Failure 400 {object} dto.HttpError "Bad request or invalid otp"
+// @Failure 401 {object} dto.HttpError "Invalid credentials"
+// @Failure 403 {object} dto.HttpError "Deleted by an admin"
+// @Failure 404 {object} dto.HttpError "Grace period is over"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /auth/restore [post]
+func (h *AccountHandler) RestoreAccountHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.RestoreAccount)
+
+	resp, err := h.UserSvc.RestoreAccount(c.Request.Context(), domain.RestoreUser{Email: req.Email, Password: req.Password, OTP: req.OTP}, h.GracePeriod)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"Message": resp.Message}, nil)
+}
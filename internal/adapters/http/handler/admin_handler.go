@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/dto"
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	AuditSvc *usecase.AuditService
+	AdminSvc *usecase.AdminService
+	Logger   domain.LoggingRepository
+}
+
+func NewAdminHandler(auditsvc *usecase.AuditService, adminsvc *usecase.AdminService, logger domain.LoggingRepository) *AdminHandler {
+	return &AdminHandler{AuditSvc: auditsvc, AdminSvc: adminsvc, Logger: logger}
+}
+
+func toAuditEventResponse(e *domain.AuditEvent) dto.AuditEventResponse {
+	return dto.AuditEventResponse{
+		ID:        e.ID,
+		EventType: e.EventType,
+		Outcome:   e.Outcome,
+		ActorID:   e.ActorID,
+		UserID:    e.UserID,
+		RequestID: e.RequestID,
+		ClientIP:  e.ClientIP,
+		Metadata:  e.Metadata,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+func auditFilter(c *gin.Context) (domain.AuditFilter, error) {
+	f := domain.AuditFilter{EventType: c.Query("event_type")}
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			return f, domain.NewDomainError(domain.ErrCodeValidation, "invalid user_id", err)
+		}
+		f.UserID = &id
+	}
+	for name, dst := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, domain.NewDomainError(domain.ErrCodeValidation, name+" must be an RFC 3339 timestamp", err)
+			}
+			*dst = t
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return f, domain.NewDomainError(domain.ErrCodeValidation, "invalid limit", err)
+		}
+		f.Limit = limit
+	}
+	if v := c.Query("before"); v != "" {
+		before, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || before <= 0 {
+			return f, domain.NewDomainError(domain.ErrCodeValidation, "invalid before cursor", err)
+		}
+		f.BeforeID = before
+	}
+	return f, nil
+}
+
+// ListAuditEventsHandler godoc
+// @Summary List audit events
+// @Description Lists security events newest first. Pass next_cursor as before to get the next page.
+// @Tags Admin
+// @Produce json
+// @Param user_id query int false "Account the events are about"
+// @Param event_type query string false "Event type, e.g. auth.login"
+// @Param from query string false "Inclusive lower bound (RFC 3339)"
+// @Param to query string false "Exclusive upper bound (RFC 3339)"
+// @Param limit query int false "Page size, at most 200" default(50)
+// @Param before query int false "Cursor from the previous page"
+// @Success 200 {object} dto.AuditEventsResponse "Audit events"
+// @Failure 400 {object} dto.HttpError "Invalid filter"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 403 {object} dto.HttpError "Requires the admin or support role"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /admin/audit-events [get]
+func (h *AdminHandler) ListAuditEventsHandler(c *gin.Context) {
+	f, err := auditFilter(c)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	page, err := h.AuditSvc.ListEvents(c.Request.Context(), f)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	resp := dto.AuditEventsResponse{Events: make([]dto.AuditEventResponse, 0, len(page.Events)), NextCursor: page.NextCursor}
+	for i := range page.Events {
+		resp.Events = append(resp.Events, toAuditEventResponse(&page.Events[i]))
+	}
+	respond(c, http.StatusOK, resp, nil)
+}
+
+// ChangeUserRoleHandler godoc
+// @Summary Change the role of a user
+// @Description Sets the role of a user. It applies to the user's tokens from their next refresh on.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body dto.UserRole true "New role"
+// @Success 200 {object} dto.UserRoleResponse "Role changed"
+// @Failure 400 {object} dto.HttpError "Invalid user id or role"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 403 {object} dto.HttpError "Requires the admin role, or changing your own role"
+// @Failure 404 {object} dto.HttpError "User not found"
+// @Router /admin/users/{id}/role [put]
+func (h *AdminHandler) ChangeUserRoleHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		respond(c, 0, nil, domain.NewDomainError(domain.ErrCodeValidation, "invalid user id", err))
+		return
+	}
+	req := c.MustGet("payload").(dto.UserRole)
+	if err := h.AdminSvc.ChangeUserRole(c.Request.Context(), id, req.Role); err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusOK, dto.UserRoleResponse{UserID: id, Role: req.Role}, nil)
+}
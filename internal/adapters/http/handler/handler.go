@@ -5,12 +5,12 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/dto"
 	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/middleware"
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
-	"github.com/KianoushAmirpour/notification_server/internal/observability"
 	"github.com/KianoushAmirpour/notification_server/internal/usecase"
 	"github.com/gin-gonic/gin"
 )
@@ -22,9 +22,8 @@ type UserHandler struct {
 	JwtHandler     domain.JwtTokenRepository
 	Logger         domain.LoggingRepository
 	OtpExpiration  int
+	ResendCooldown time.Duration
 	JwtIss         string
-	JwtSecret      string
-	JwtRefresh     string
 	MaxAllowedSize int
 }
 
@@ -35,15 +34,14 @@ func NewUserHandler(
 	auth domain.JwtTokenRepository,
 	logger domain.LoggingRepository,
 	otpexpiration int,
+	resendcooldown time.Duration,
 	jwtiss string,
-	jwtsecret string,
-	jwtrefresh string,
 	ratelimitcapacity float64,
 	ratelimitfillrate float64,
 	maxallowedsize int,
 ) *UserHandler {
 	return &UserHandler{UserSvc: usersvc, ImageSvc: imgsvc, IpRateLimiter: redisratelimiter, JwtHandler: auth, Logger: logger,
-		OtpExpiration: otpexpiration, JwtIss: jwtiss, JwtSecret: jwtsecret, JwtRefresh: jwtrefresh,
+		OtpExpiration: otpexpiration, ResendCooldown: resendcooldown, JwtIss: jwtiss,
 		MaxAllowedSize: maxallowedsize}
 }
 
@@ -68,7 +66,7 @@ func (h *UserHandler) HomePageHandler(c *gin.Context) {
 // @Produce json
 // @Param X-Correlation-Id header string true "Correlation ID for request tracing"
 // @Param request body dto.RegisteredUser true "User registration payload"
-// @Success 201 {object} map[string]string "User registered successfully"
+// @Success 201 {object} map[string]string "Registered, with the verification_id to verify with"
 // @Failure 400 {object} dto.HttpError "Bad request"
 // @Failure 409 {object} dto.HttpError "User already exists"
 // @Failure 413 {object} dto.HttpError "Payload too large"
@@ -77,24 +75,6 @@ func (h *UserHandler) HomePageHandler(c *gin.Context) {
 // @Failure 503 {object} dto.HttpError "Service unavailable"
 // @Router /users/register [post]
 func (h *UserHandler) RegisterHandler(c *gin.Context) {
-
-	reqID := observability.GetRequestID(c.Request.Context())
-	log := h.Logger.With(
-		"service.name", "register",
-		"@timestamp", time.Now().UTC().Format(time.RFC3339Nano),
-		"event.category", []string{"iam", "web"},
-		"http.request.method", c.Request.Method,
-		"http.request.path", c.FullPath(),
-		"http.request.agent", c.Request.UserAgent(),
-		"http.request.id", reqID,
-		"client.ip", c.ClientIP(),
-	)
-
-	log.Info(
-		"http request started",
-		"event.action", "http.request",
-		"event.type", []string{"start"},
-	)
 	req := c.MustGet("payload").(dto.RegisteredUser)
 
 	reqRu := domain.RegisteredUser{
@@ -106,115 +86,67 @@ func (h *UserHandler) RegisterHandler(c *gin.Context) {
 	}
 
 	res, err := h.UserSvc.RegisterUser(c.Request.Context(), reqRu, h.OtpExpiration)
-	var duration time.Duration
-	t, b := observability.GetrequestStartTimeKey(c.Request.Context())
-	if b {
-		duration = time.Since(t)
-	}
 	if err != nil {
-		httpErr := dto.MapErr(err)
-		log.Error(
-			"http request failed",
-			"event.action", "http.request.register",
-			"event.outcome", "failure",
-			"event.type", []string{"error", "end"},
-			"http.response.status_code", httpErr.StatusCode,
-			"error.message", err.Error(),
-			"error.code", httpErr.Code,
-			"event.duration", duration.Nanoseconds(),
-		)
-		c.JSON(httpErr.StatusCode, httpErr)
+		respond(c, 0, nil, err)
 		return
 	}
-
-	log.Info(
-		"http request completed",
-		"event.action", "http.request",
-		"event.outcome", "success",
-		"event.type", []string{"end", "creation"},
-		"http.response.status_code", http.StatusCreated,
-		"event.duration", duration.Nanoseconds(),
-	)
-
-	c.JSON(http.StatusCreated, gin.H{"Message": res.Message})
+	respond(c, http.StatusCreated, gin.H{"Message": res.Message, "verification_id": res.VerificationID}, nil)
 }
 
 // VerificationHandler godoc
 // @Summary Verify a user
-// @Description Verifies a user using a one-time password (OTP)
+// @Description Verifies a user using a one-time password (OTP), for the registration named by the verification_id returned at registration or by its email
 // @Tags Authentication
 // @Accept json
 // @Produce json
-// @Param X-Correlation-Id header string true "Correlation ID for request tracing"
 // @Param request body dto.RegisterVerify true "User verification payload"
 // @Success 200 {object} map[string]string "User verified successfully"
 // @Failure 400 {object} dto.HttpError "Bad request"
-// @Failure 404 {object} dto.HttpError "Verification data not found"
+// @Failure 404 {object} dto.HttpError "Verification not found or expired"
 // @Failure 413 {object} dto.HttpError "Payload too large"
 // @Failure 429 {object} dto.HttpError "Too many verification attempts"
 // @Failure 500 {object} dto.HttpError "Internal server error"
 // @Router /auth/verify [post]
 func (h *UserHandler) VerificationHandler(c *gin.Context) {
-	reqID := observability.GetRequestID(c.Request.Context())
-	log := h.Logger.With(
-		"service.name", "verification",
-		"@timestamp", time.Now().UTC().Format(time.RFC3339Nano),
-		"event.category", []string{"iam", "web"},
-		"http.request.method", c.Request.Method,
-		"http.request.path", c.FullPath(),
-		"http.request.agent", c.Request.UserAgent(),
-		"http.request.id", reqID,
-		"client.ip", c.ClientIP(),
-	)
-
-	log.Info(
-		"http request started",
-		"event.action", "http.request",
-		"event.type", []string{"start"},
-	)
-
 	req := c.MustGet("payload").(dto.RegisterVerify)
-	registerReqID := c.GetHeader("X-Request-Id")
 
-	reqVu := domain.RegisterVerify{SentOtpbyUser: req.SentOtpbyUser}
+	reqVu := domain.RegisterVerify{VerificationID: req.VerificationID, Email: req.Email, SentOtpbyUser: req.SentOtpbyUser}
 
-	resp, err := h.UserSvc.VerifyUser(c.Request.Context(), reqVu, registerReqID)
-	var duration time.Duration
-	t, b := observability.GetrequestStartTimeKey(c.Request.Context())
-	if b {
-		duration = time.Since(t)
-	}
+	resp, err := h.UserSvc.VerifyUser(c.Request.Context(), reqVu)
 	if err != nil {
-		httpErr := dto.MapErr(err)
-		log.Error(
-			"http request failed",
-			"event.action", "http.request.verify",
-			"event.outcome", "failure",
-			"event.type", []string{"error", "end", "denied"},
-			"http.response.status_code", httpErr.StatusCode,
-			"error.message", err.Error(),
-			"error.code", httpErr.Code,
-			"event.duration", duration.Nanoseconds(),
-		)
-		c.JSON(httpErr.StatusCode, httpErr)
-		// c.Redirect(http.StatusSeeOther, "http://localhost:4000/api/user/register")
+		respond(c, 0, nil, err)
 		return
 	}
-	log.Info(
-		"http request completed",
-		"event.action", "http.request",
-		"event.outcome", "success",
-		"event.type", []string{"end", "allowed"},
-		"http.response.status_code", http.StatusCreated,
-		"event.duration", duration.Nanoseconds(),
-	)
-	c.JSON(http.StatusOK, gin.H{"Message": resp.Message})
+	respond(c, http.StatusOK, gin.H{"Message": resp.Message}, nil)
+}
 
+// ResendVerificationHandler godoc
+// @Summary Resend the verification code
+// @Description Sends a new code for a pending registration and extends it. The verification_id from registration stays valid. The answer is the same whether or not the email is registering.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body dto.ResendVerification true "Email of the pending registration"
+// @Success 202 {object} map[string]string "Code sent if a registration is pending"
+// @Failure 400 {object} dto.HttpError "Bad request"
+// @Failure 429 {object} dto.HttpError "A code was sent recently"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Failure 503 {object} dto.HttpError "Service unavailable"
+// @Router /auth/verify/resend [post]
+func (h *UserHandler) ResendVerificationHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.ResendVerification)
+
+	resp, err := h.UserSvc.ResendVerification(c.Request.Context(), req.Email, h.OtpExpiration, h.ResendCooldown)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusAccepted, gin.H{"Message": resp.Message}, nil)
 }
 
 // LoginHandler godoc
 // @Summary Login a user
-// @Description Authenticates a user and returns access and refresh tokens
+// @Description Authenticates a user and returns access and refresh tokens. Users with two-factor authentication get an mfa_token instead, to finish the login at /auth/mfa
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -228,23 +160,6 @@ func (h *UserHandler) VerificationHandler(c *gin.Context) {
 // @Failure 500 {object} dto.HttpError "Internal server error"
 // @Router /auth/login [post]
 func (h *UserHandler) LoginHandler(c *gin.Context) {
-	reqID := observability.GetRequestID(c.Request.Context())
-	log := h.Logger.With(
-		"service.name", "login",
-		"@timestamp", time.Now().UTC().Format(time.RFC3339Nano),
-		"event.category", []string{"authentication", "web"},
-		"http.request.method", c.Request.Method,
-		"http.request.path", c.FullPath(),
-		"http.request.agent", c.Request.UserAgent(),
-		"http.request.id", reqID,
-		"client.ip", c.ClientIP(),
-	)
-
-	log.Info(
-		"http request started",
-		"event.action", "http.request",
-		"event.type", []string{"start"},
-	)
 	req := c.MustGet("payload").(dto.LoginUser)
 
 	reqLu := domain.LoginUser{
@@ -253,38 +168,11 @@ func (h *UserHandler) LoginHandler(c *gin.Context) {
 	}
 
 	resp, err := h.UserSvc.AuthenticateUser(c.Request.Context(), reqLu)
-	t, b := observability.GetrequestStartTimeKey(c.Request.Context())
-	var duration time.Duration
-	if b {
-		duration = time.Since(t)
-	}
 	if err != nil {
-		httpErr := dto.MapErr(err)
-		log.Error(
-			"http request failed",
-			"event.action", "http.request.authenticate",
-			"event.outcome", "failure",
-			"event.type", []string{"error", "denied", "end"},
-			"http.response.status_code", httpErr.StatusCode,
-			"error.message", err.Error(),
-			"error.code", httpErr.Code,
-			"event.duration", duration.Nanoseconds(),
-		)
-		c.JSON(httpErr.StatusCode, httpErr)
-		// c.Redirect(http.StatusSeeOther, "http://localhost:4000/api/user/register")
+		respond(c, 0, nil, err)
 		return
 	}
-	c.Header("Authorization", "Bearer "+resp.AccessToken)
-	c.Header("X-Refresh-Token", resp.RefreshToken)
-	log.Info(
-		"http request completed",
-		"event.action", "http.request",
-		"event.outcome", "success",
-		"event.type", []string{"end", "allowed"},
-		"http.response.status_code", http.StatusCreated,
-		"event.duration", duration.Nanoseconds(),
-	)
-	c.JSON(http.StatusOK, gin.H{"Message": "You are logged in"})
+	respondLogin(c, resp)
 
 	// c.SetCookie("access-token", token, 3600, "/", "", true, true)
 }
@@ -304,129 +192,152 @@ func (h *UserHandler) LoginHandler(c *gin.Context) {
 // @Failure 500 {object} dto.HttpError "Internal server error"
 // @Router /refresh [post]
 func (h *UserHandler) JwtRefreshHandler(c *gin.Context) {
-	reqID := observability.GetRequestID(c.Request.Context())
-	log := h.Logger.With(
-		"service.name", "jwt-refresh",
-		"@timestamp", time.Now().UTC().Format(time.RFC3339Nano),
-		"event.category", []string{"authentication", "web"},
-		"http.request.method", c.Request.Method,
-		"http.request.path", c.FullPath(),
-		"http.request.agent", c.Request.UserAgent(),
-		"http.request.id", reqID,
-		"client.ip", c.ClientIP(),
-	)
-
-	log.Info(
-		"http request started",
-		"event.action", "http.request",
-		"event.type", "start",
-	)
 	refreshToken := c.GetHeader("X-Refresh-Token")
-	resp, err := h.UserSvc.RefreshJwtToken(c.Request.Context(), refreshToken, h.JwtRefresh)
-	t, b := observability.GetrequestStartTimeKey(c.Request.Context())
-	var duration time.Duration
-	if b {
-		duration = time.Since(t)
-	}
+	resp, err := h.UserSvc.RefreshJwtToken(c.Request.Context(), refreshToken)
 	if err != nil {
-		httpErr := dto.MapErr(err)
-		log.Error(
-			"http request failed",
-			"event.action", "http.request.refreshjwt",
-			"event.outcome", "failure",
-			"event.type", []string{"error", "denied", "end"},
-			"http.response.status_code", httpErr.StatusCode,
-			"error.message", err.Error(),
-			"error.code", httpErr.Code,
-			"event.duration", duration.Nanoseconds(),
-		)
-		c.JSON(httpErr.StatusCode, httpErr)
+		respond(c, 0, nil, err)
 		return
 	}
 	c.Header("Authorization", "Bearer "+resp.AccessToken)
 	c.Header("X-Refresh-Token", resp.RefreshToken)
-	log.Info(
-		"http request completed",
-		"event.action", "http.request",
-		"event.outcome", "success",
-		"event.type", []string{"end", "allowed"},
-		"http.response.status_code", http.StatusCreated,
-		"event.duration", duration.Nanoseconds(),
-	)
-	c.JSON(http.StatusCreated, gin.H{"Message": "You are logged in"})
+	respond(c, http.StatusCreated, gin.H{"Message": "You are logged in"}, nil)
+}
 
+// RequestAccountDeletionHandler godoc
+// @Summary Request an account deletion code
+// @Description Emails a one-time code that confirms DELETE /users/me
+// @Tags Users
+// @Produce json
+// @Success 200 {object} map[string]string "Code sent"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 404 {object} dto.HttpError "User not found"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Failure 503 {object} dto.HttpError "External service error"
+// @Router /users/me/deletion-otp [post]
+func (h *UserHandler) RequestAccountDeletionHandler(c *gin.Context) {
+	resp, err := h.UserSvc.RequestAccountDeletion(c.Request.Context(), c.GetInt("user_id"), h.OtpExpiration)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"Message": resp.Message}, nil)
 }
 
-// DeleteUserHandler godoc
-// @Summary Delete a user
-// @Description Deletes a user by ID
+// DeleteAccountHandler godoc
+// @Summary Delete your account
+// @Description Deletes the authenticated user's account, confirmed with the password or a code from /users/me/deletion-otp
 // @Tags Users
 // @Accept json
 // @Produce json
-// @Param request body dto.DeleteUser true "User deletion payload"
+// @Param request body dto.DeleteAccount true "Password or otp"
 // @Success 200 {object} map[string]string "User deleted successfully"
-// @Failure 400 {object} dto.HttpError "Bad request"
-// @Failure 401 {object} dto.HttpError "Unauthorized"
-// @Failure 413 {object} dto.HttpError "Payload too large"
-// @Failure 429 {object} dto.HttpError "Too many verification attempts"
+// @Failure 400 {object} dto.HttpError "Bad request or invalid otp"
+// @Failure 401 {object} dto.HttpError "Unauthorized or wrong password"
 // @Failure 404 {object} dto.HttpError "User not found"
+// @Failure 413 {object} dto.HttpError "Payload too large"
+// @Failure 429 {object} dto.HttpError "Too many otp attempts"
 // @Failure 500 {object} dto.HttpError "Internal server error"
-// @Router /users [delete]
-func (h *UserHandler) DeleteUserHandler(c *gin.Context) {
-	reqID := observability.GetRequestID(c.Request.Context())
-	log := h.Logger.With(
-		"service.name", "deletion",
-		"@timestamp", time.Now().UTC().Format(time.RFC3339Nano),
-		"event.category", []string{"iam", "web"},
-		"http.request.method", c.Request.Method,
-		"http.request.path", c.FullPath(),
-		"http.request.agent", c.Request.UserAgent(),
-		"http.request.id", reqID,
-		"client.ip", c.ClientIP(),
-	)
-
-	log.Info(
-		"http request started",
-		"event.action", "http.request",
-		"event.type", "start",
-	)
-	req := c.MustGet("payload").(dto.DeleteUser)
+// @Router /users/me [delete]
+func (h *UserHandler) DeleteAccountHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.DeleteAccount)
 
 	reqU := domain.DeleteUser{
-		ID: req.UserID,
+		ID:       c.GetInt("user_id"),
+		Password: req.Password,
+		OTP:      req.OTP,
 	}
 
-	resp, err := h.UserSvc.DeleteUser(c.Request.Context(), reqU)
-	t, b := observability.GetrequestStartTimeKey(c.Request.Context())
-	var duration time.Duration
-	if b {
-		duration = time.Since(t)
+	resp, err := h.UserSvc.DeleteAccount(c.Request.Context(), reqU)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
 	}
+	respond(c, http.StatusOK, gin.H{"Message": fmt.Sprintf("%s. Good buy🙌", resp.Message)}, nil)
+}
+
+// RequestEmailChangeHandler godoc
+// @Summary Change your email
+// @Description Stages a new email and sends a confirmation code to it. The email only changes once the code is sent to /users/me/email/verify.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param request body dto.EmailChange true "New email and current password"
+// @Success 202 {object} map[string]string "Code sent to the new email"
+// @Failure 400 {object} dto.HttpError "Bad request or same email"
+// @Failure 401 {object} dto.HttpError "Unauthorized or wrong password"
+// @Failure 409 {object} dto.HttpError "Email already exists"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Failure 503 {object} dto.HttpError "External service error"
+// @Router /users/me/email [post]
+func (h *UserHandler) RequestEmailChangeHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.EmailChange)
+
+	reqU := domain.EmailChange{
+		UserID:   c.GetInt("user_id"),
+		Email:    req.Email,
+		Password: req.Password,
+	}
+
+	resp, err := h.UserSvc.RequestEmailChange(c.Request.Context(), reqU, h.OtpExpiration)
 	if err != nil {
-		httpErr := dto.MapErr(err)
-		log.Error(
-			"http request failed",
-			"event.action", "http.request.delete",
-			"event.outcome", "failure",
-			"event.type", []string{"error", "denied", "end"},
-			"http.response.status_code", httpErr.StatusCode,
-			"error.message", err.Error(),
-			"error.code", httpErr.Code,
-			"event.duration", duration.Nanoseconds(),
-		)
-		c.JSON(httpErr.StatusCode, httpErr)
+		respond(c, 0, nil, err)
 		return
 	}
-	log.Info(
-		"http request completed",
-		"event.action", "http.request",
-		"event.outcome", "success",
-		"event.type", []string{"end", "deletion"},
-		"http.response.status_code", http.StatusCreated,
-		"event.duration", duration.Nanoseconds(),
-	)
-	c.JSON(http.StatusOK, gin.H{"Message": fmt.Sprintf("%s. Good buy🙌", resp.Message)})
+	respond(c, http.StatusAccepted, gin.H{"Message": resp.Message}, nil)
+}
+
+// ConfirmEmailChangeHandler godoc
+// @Summary Confirm your new email
+// @Description Swaps in the new email, revokes every refresh token and notifies the old email
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param request body dto.EmailChangeVerify true "Code sent to the new email"
+// @Success 200 {object} map[string]string "Email changed"
+// @Failure 400 {object} dto.HttpError "Invalid otp"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 404 {object} dto.HttpError "No email change in progress or code expired"
+// @Failure 409 {object} dto.HttpError "Email already exists"
+// @Failure 429 {object} dto.HttpError "Too many otp attempts"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /users/me/email/verify [post]
+func (h *UserHandler) ConfirmEmailChangeHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.EmailChangeVerify)
 
+	resp, err := h.UserSvc.ConfirmEmailChange(c.Request.Context(), c.GetInt("user_id"), req.OTP, h.OtpExpiration)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"Message": resp.Message}, nil)
+}
+
+// DeleteUserHandler godoc
+// @Summary Delete a user
+// @Description Deletes any user by ID. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string "User deleted successfully"
+// @Failure 400 {object} dto.HttpError "Invalid user id"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 403 {object} dto.HttpError "Requires the admin role"
+// @Failure 404 {object} dto.HttpError "User not found"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /admin/users/{id} [delete]
+func (h *UserHandler) DeleteUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		respond(c, 0, nil, domain.NewDomainError(domain.ErrCodeValidation, "invalid user id", err))
+		return
+	}
+
+	resp, err := h.UserSvc.DeleteUser(c.Request.Context(), id)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"Message": resp.Message}, nil)
 }
 
 // StoryGenerationHandler godoc
@@ -444,55 +355,13 @@ func (h *UserHandler) DeleteUserHandler(c *gin.Context) {
 // @Failure 503 {object} dto.HttpError "External service error"
 // @Router /stories [post]
 func (h *UserHandler) StoryGenerationHandler(c *gin.Context) {
-	reqID := observability.GetRequestID(c.Request.Context())
-	log := h.Logger.With(
-		"service.name", "story",
-		"@timestamp", time.Now().UTC().Format(time.RFC3339Nano),
-		"event.category", []string{"web"},
-		"http.request.method", c.Request.Method,
-		"http.request.path", c.FullPath(),
-		"http.request.agent", c.Request.UserAgent(),
-		"http.request.id", reqID,
-		"client.ip", c.ClientIP(),
-	)
-
-	log.Info(
-		"http request started",
-		"event.action", "http.request",
-		"event.type", "start",
-	)
 	userID := c.GetInt("user_id")
 	resp, err := h.ImageSvc.ScheduleStoryGeneration(c.Request.Context(), userID)
-	t, b := observability.GetrequestStartTimeKey(c.Request.Context())
-	var duration time.Duration
-	if b {
-		duration = time.Since(t)
-	}
 	if err != nil {
-		httpErr := dto.MapErr(err)
-		log.Error(
-			"http request failed",
-			"event.action", "http.request.story",
-			"event.outcome", "failure",
-			"event.type", []string{"error", "end"},
-			"http.response.status_code", httpErr.StatusCode,
-			"error.message", err.Error(),
-			"error.code", httpErr.Code,
-			"event.duration", duration.Nanoseconds(),
-		)
-		c.JSON(httpErr.StatusCode, httpErr)
+		respond(c, 0, nil, err)
 		return
 	}
-	log.Info(
-		"http request completed",
-		"event.action", "http.request",
-		"event.outcome", "success",
-		"event.type", []string{"end", "creation"},
-		"http.response.status_code", http.StatusCreated,
-		"event.duration", duration.Nanoseconds(),
-	)
-	c.JSON(http.StatusCreated, gin.H{"Message": resp.Message})
-
+	respond(c, http.StatusCreated, gin.H{"Message": resp.Message}, nil)
 }
 
 // HealthHandler godoc
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	Keys domain.KeySetProvider
+}
+
+func NewJWKSHandler(keys domain.KeySetProvider) *JWKSHandler {
+	return &JWKSHandler{Keys: keys}
+}
+
+// JWKSHandler godoc
+// @Summary Public keys for access tokens
+// @Description JSON Web Key Set other services verify our access tokens with, matched by the kid header. Empty while tokens are signed with a shared secret.
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Key set"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) JWKSHandler(c *gin.Context) {
+	keys, err := h.Keys.PublicKeys()
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	// verifiers refetch on an unknown kid, so a short cache is enough
+	c.Header("Cache-Control", "public, max-age=300")
+	respond(c, http.StatusOK, gin.H{"keys": keys}, nil)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/dto"
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type MagicLinkHandler struct {
+	UserSvc     *usecase.UserService
+	CallbackURL string
+	Expiration  int
+	Cooldown    time.Duration
+	Logger      domain.LoggingRepository
+}
+
+func NewMagicLinkHandler(usersvc *usecase.UserService, callbackURL string, expiration int, cooldown time.Duration, logger domain.LoggingRepository) *MagicLinkHandler {
+	return &MagicLinkHandler{UserSvc: usersvc, CallbackURL: callbackURL, Expiration: expiration, Cooldown: cooldown, Logger: logger}
+}
+
+// RequestMagicLinkHandler godoc
+// @Summary Email a sign-in link
+// @Description Emails a single-use link that signs the user in without a password. The answer is the same whether or not the email has an account.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body dto.MagicLinkRequest true "Email of the account"
+// @Success 202 {object} map[string]string "Link sent if the account exists"
+// @Failure 400 {object} dto.HttpError "Bad request"
+// @Failure 429 {object} dto.HttpError "A link was sent recently"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Failure 503 {object} dto.HttpError "Service unavailable"
+// @Router /auth/magic-link [post]
+func (h *MagicLinkHandler) RequestMagicLinkHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.MagicLinkRequest)
+
+	resp, err := h.UserSvc.RequestMagicLink(c.Request.Context(), req.Email, h.CallbackURL, h.Expiration, h.Cooldown)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusAccepted, gin.H{"Message": resp.Message}, nil)
+}
+
+// MagicLinkCallbackHandler godoc
+// @Summary Sign in with an emailed link
+// @Description Exchanges the token of a sign-in link for an access and refresh token, returned in the same headers as login. Each link works once.
+// @Tags Authentication
+// @Produce json
+// @Param email query string true "Email the link was sent to"
+// @Param token query string true "Token from the link"
+// @Success 200 {object} map[string]string "Logged in"
+// @Header 200 {string} Authorization "Bearer access token"
+// @Header 200 {string} X-Refresh-Token "Refresh token"
+// @Failure 400 {object} dto.HttpError "Bad request"
+// @Failure 401 {object} dto.HttpError "Link is invalid or expired"
+// @Failure 429 {object} dto.HttpError "Too many attempts"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /auth/magic-link/callback [get]
+func (h *MagicLinkHandler) MagicLinkCallbackHandler(c *gin.Context) {
+	email, token := c.Query("email"), c.Query("token")
+	if email == "" || token == "" {
+		respond(c, 0, nil, domain.NewDomainError(domain.ErrCodeValidation, "email and token are required", nil))
+		return
+	}
+
+	resp, err := h.UserSvc.LoginWithMagicLink(c.Request.Context(), email, token)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respondLogin(c, resp)
+}
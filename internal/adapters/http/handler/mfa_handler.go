@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/dto"
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type MFAHandler struct {
+	MFASvc  *usecase.MFAService
+	UserSvc *usecase.UserService
+	Logger  domain.LoggingRepository
+}
+
+func NewMFAHandler(mfasvc *usecase.MFAService, usersvc *usecase.UserService, logger domain.LoggingRepository) *MFAHandler {
+	return &MFAHandler{MFASvc: mfasvc, UserSvc: usersvc, Logger: logger}
+}
+
+// respondLogin sends the token pair the way LoginHandler always did, or the
+// MFA challenge when a second factor is still missing.
+func respondLogin(c *gin.Context, resp *usecase.UserServiceAuthResponse) {
+	if resp.MFAChallenge != "" {
+		respond(c, http.StatusOK, gin.H{"Message": "Enter the code from your authenticator app", "mfa_required": true, "mfa_token": resp.MFAChallenge}, nil)
+		return
+	}
+	c.Header("Authorization", "Bearer "+resp.AccessToken)
+	c.Header("X-Refresh-Token", resp.RefreshToken)
+	respond(c, http.StatusOK, gin.H{"Message": "You are logged in"}, nil)
+}
+
+// EnrollMFAHandler godoc
+// @Summary Set up two-factor authentication
+// @Description Creates a TOTP secret and recovery codes after checking the current password. Add the otpauth URI to an authenticator app and confirm with /users/me/mfa/verify; until then login does not ask for a code. Recovery codes are shown only once.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param request body dto.MFAEnroll true "Current password"
+// @Success 201 {object} dto.MFAEnrollment "Secret and recovery codes"
+// @Failure 400 {object} dto.HttpError "Bad request"
+// @Failure 401 {object} dto.HttpError "Unauthorized or wrong password"
+// @Failure 409 {object} dto.HttpError "Already enabled"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /users/me/mfa [post]
+func (h *MFAHandler) EnrollMFAHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.MFAEnroll)
+
+	enrollment, err := h.MFASvc.Enroll(c.Request.Context(), c.GetInt("user_id"), req.Password)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusCreated, dto.MFAEnrollment{OtpauthURI: enrollment.URI, RecoveryCodes: enrollment.RecoveryCodes}, nil)
+}
+
+// ActivateMFAHandler godoc
+// @Summary Turn on two-factor authentication
+// @Description Enables the pending enrollment once a code from the authenticator app is valid.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param request body dto.MFACode true "Code from the authenticator app"
+// @Success 200 {object} map[string]string "Enabled"
+// @Failure 400 {object} dto.HttpError "Bad request"
+// @Failure 401 {object} dto.HttpError "Unauthorized or invalid code"
+// @Failure 404 {object} dto.HttpError "Not enrolled"
+// @Failure 409 {object} dto.HttpError "Already enabled"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /users/me/mfa/verify [post]
+func (h *MFAHandler) ActivateMFAHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.MFACode)
+
+	if err := h.MFASvc.Activate(c.Request.Context(), c.GetInt("user_id"), req.Code); err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"Message": "Two-factor authentication enabled"}, nil)
+}
+
+// CompleteMFALoginHandler godoc
+// @Summary Finish a login with a second factor
+// @Description Trades the mfa_token from login and a TOTP or recovery code for the access and refresh tokens. The mfa_token works once, a wrong code means logging in again.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body dto.MFALogin true "MFA token and code"
+// @Success 200 {object} map[string]string "Logged in"
+// @Header 200 {string} Authorization "Bearer access token"
+// @Header 200 {string} X-Refresh-Token "Refresh token"
+// @Failure 400 {object} dto.HttpError "Bad request"
+// @Failure 401 {object} dto.HttpError "Invalid code or expired mfa_token"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /auth/mfa [post]
+func (h *MFAHandler) CompleteMFALoginHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.MFALogin)
+
+	resp, err := h.UserSvc.CompleteMFALogin(c.Request.Context(), req.MFAToken, req.Code)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respondLogin(c, resp)
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type OIDCHandler struct {
+	OIDCSvc *usecase.OIDCService
+	Logger  domain.LoggingRepository
+}
+
+func NewOIDCHandler(oidcsvc *usecase.OIDCService, logger domain.LoggingRepository) *OIDCHandler {
+	return &OIDCHandler{OIDCSvc: oidcsvc, Logger: logger}
+}
+
+// oidcStateCookie keeps the state in the browser that started the login, so
+// the callback can tell it apart from a callback URL someone else sent it.
+// It has to be Lax, not Strict: the provider's redirect back is a cross-site
+// navigation.
+const oidcStateCookie = "oidc_state"
+
+func (h *OIDCHandler) setStateCookie(c *gin.Context, state string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// OIDCLoginHandler godoc
+// @Summary Log in with the external identity provider
+// @Description Redirects the browser to the configured OpenID Connect provider (authorization code flow with PKCE)
+// @Tags Authentication
+// @Success 302 "Redirect to the provider, with the oidc_state cookie the callback checks"
+// @Failure 404 {object} dto.HttpError "Single sign-on is not configured"
+// @Failure 503 {object} dto.HttpError "Provider unreachable"
+// @Router /auth/oidc/login [get]
+func (h *OIDCHandler) OIDCLoginHandler(c *gin.Context) {
+	target, state, err := h.OIDCSvc.Start(c.Request.Context())
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	h.setStateCookie(c, state, int(h.OIDCSvc.StateTTL.Seconds()))
+	c.Redirect(http.StatusFound, target)
+}
+
+// OIDCLinkHandler godoc
+// @Summary Link the external identity provider to your account
+// @Description Returns the provider URL to open in the same browser, which also gets the oidc_state cookie the callback checks. After the provider login, the callback links that external account to the caller's account
+// @Tags Users
+// @Produce json
+// @Success 200 {object} map[string]string "authorization_url to open"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 404 {object} dto.HttpError "Single sign-on is not configured"
+// @Failure 503 {object} dto.HttpError "Provider unreachable"
+// @Router /users/me/oidc/link [post]
+func (h *OIDCHandler) OIDCLinkHandler(c *gin.Context) {
+	target, state, err := h.OIDCSvc.StartLink(c.Request.Context(), c.GetInt("user_id"))
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	h.setStateCookie(c, state, int(h.OIDCSvc.StateTTL.Seconds()))
+	respond(c, http.StatusOK, gin.H{"authorization_url": target}, nil)
+}
+
+// OIDCCallbackHandler godoc
+// @Summary Finish the external login
+// @Description The provider redirects here. Creates an account for a new verified email, links to an existing account only when the provider is trusted or the login was started from /users/me/oidc/link, and returns tokens like login
+// @Tags Authentication
+// @Produce json
+// @Param state query string true "State from the login redirect"
+// @Param code query string true "Authorization code"
+// @Success 200 {object} map[string]string "Logged in, or mfa_token when two-factor authentication is enabled"
+// @Header 200 {string} Authorization "Bearer access token"
+// @Header 200 {string} X-Refresh-Token "Refresh token"
+// @Failure 400 {object} dto.HttpError "Bad request"
+// @Failure 401 {object} dto.HttpError "Login rejected, expired, started in another browser or email not verified"
+// @Failure 409 {object} dto.HttpError "Email belongs to a local account that has to link the provider first, or the identity is linked to another account"
+// @Failure 503 {object} dto.HttpError "Provider unreachable"
+// @Router /auth/oidc/callback [get]
+func (h *OIDCHandler) OIDCCallbackHandler(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		respond(c, 0, nil, domain.NewDomainError(domain.ErrCodeUnauthorized, "login cancelled at provider: "+reason, nil))
+		return
+	}
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		respond(c, 0, nil, domain.NewDomainError(domain.ErrCodeValidation, "state and code are required", nil))
+		return
+	}
+
+	// A missing cookie reads as "", which the service refuses. The cookie is
+	// single use either way.
+	boundState, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1)
+
+	resp, err := h.OIDCSvc.Callback(c.Request.Context(), state, boundState, code)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respondLogin(c, resp)
+}
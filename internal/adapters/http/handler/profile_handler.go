@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/dto"
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type ProfileHandler struct {
+	ProfileSvc *usecase.ProfileService
+	Logger     domain.LoggingRepository
+}
+
+func NewProfileHandler(profilesvc *usecase.ProfileService, logger domain.LoggingRepository) *ProfileHandler {
+	return &ProfileHandler{ProfileSvc: profilesvc, Logger: logger}
+}
+
+func toProfile(u *domain.User) dto.Profile {
+	return dto.Profile{
+		ID:        u.ID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+		Plan:      u.Plan,
+		Role:      u.Role,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
+
+// etag derives the entity tag from updated_at, which every write bumps.
+func etag(updatedAt time.Time) string {
+	return fmt.Sprintf(`"%d"`, updatedAt.UnixMicro())
+}
+
+// ifMatch returns the version sent in If-Match, nil when the header is
+// missing or "*". Tags this server did not issue can never match.
+func ifMatch(c *gin.Context) (*time.Time, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	micros, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil {
+		return nil, domain.ErrStaleVersion
+	}
+	version := time.UnixMicro(micros).UTC()
+	return &version, nil
+}
+
+// respondVersioned sets the ETag and answers 304 to a GET whose
+// If-None-Match already holds it.
+func respondVersioned(c *gin.Context, updatedAt time.Time, body any) {
+	tag := etag(updatedAt)
+	c.Header("ETag", tag)
+	if c.Request.Method == http.MethodGet && c.GetHeader("If-None-Match") == tag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	respond(c, http.StatusOK, body, nil)
+}
+
+// GetProfileHandler godoc
+// @Summary Get your profile
+// @Tags Users
+// @Produce json
+// @Param If-None-Match header string false "ETag of a cached copy"
+// @Success 200 {object} dto.Profile "Profile, with its ETag header"
+// @Success 304 "Not modified"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 404 {object} dto.HttpError "User not found"
+// @Router /users/me [get]
+func (h *ProfileHandler) GetProfileHandler(c *gin.Context) {
+	user, err := h.ProfileSvc.GetProfile(c.Request.Context(), c.GetInt("user_id"))
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respondVersioned(c, user.UpdatedAt, toProfile(user))
+}
+
+// UpdateProfileHandler godoc
+// @Summary Update your profile
+// @Description Changes the first and last name, omitted fields are kept. Send the ETag from GET /users/me in If-Match to avoid overwriting a concurrent change.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param If-Match header string false "ETag of the profile being changed"
+// @Param request body dto.ProfileUpdate true "Fields to change"
+// @Success 200 {object} dto.Profile "Profile updated, with its new ETag header"
+// @Failure 400 {object} dto.HttpError "Bad request"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 412 {object} dto.HttpError "Profile was changed since it was read"
+// @Router /users/me [patch]
+func (h *ProfileHandler) UpdateProfileHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.ProfileUpdate)
+	version, err := ifMatch(c)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+
+	update := domain.ProfileUpdate{FirstName: req.FirstName, LastName: req.LastName}
+	user, err := h.ProfileSvc.UpdateProfile(c.Request.Context(), c.GetInt("user_id"), update, version)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respondVersioned(c, user.UpdatedAt, toProfile(user))
+}
+
+// GetPreferencesHandler godoc
+// @Summary Get your story preferences
+// @Tags Users
+// @Produce json
+// @Param If-None-Match header string false "ETag of a cached copy"
+// @Success 200 {object} dto.UserPreferencesResponse "Preferences, with their ETag header"
+// @Success 304 "Not modified"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 404 {object} dto.HttpError "User not found"
+// @Router /users/me/preferences [get]
+func (h *ProfileHandler) GetPreferencesHandler(c *gin.Context) {
+	prefs, err := h.ProfileSvc.GetPreferences(c.Request.Context(), c.GetInt("user_id"))
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respondVersioned(c, prefs.UpdatedAt, dto.UserPreferencesResponse{Preferences: prefs.UserPreferences, UpdatedAt: prefs.UpdatedAt})
+}
+
+// ReplacePreferencesHandler godoc
+// @Summary Replace your story preferences
+// @Description Replaces the whole preference list, validated like at registration. Send the ETag from GET /users/me/preferences in If-Match to avoid overwriting a concurrent change.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param If-Match header string false "ETag of the preferences being replaced"
+// @Param request body dto.UserPreferences true "New preferences"
+// @Success 200 {object} dto.UserPreferencesResponse "Preferences replaced, with their new ETag header"
+// @Failure 400 {object} dto.HttpError "Bad request"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 412 {object} dto.HttpError "Preferences were changed since they were read"
+// @Router /users/me/preferences [put]
+func (h *ProfileHandler) ReplacePreferencesHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.UserPreferences)
+	version, err := ifMatch(c)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+
+	prefs, err := h.ProfileSvc.ReplacePreferences(c.Request.Context(), c.GetInt("user_id"), req.Preferences, version)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respondVersioned(c, prefs.UpdatedAt, dto.UserPreferencesResponse{Preferences: prefs.UserPreferences, UpdatedAt: prefs.UpdatedAt})
+}
@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// respond writes body with status, or the HttpError err maps to. The error
+// is attached to the context so the access log reports it.
+func respond(c *gin.Context, status int, body any, err error) {
+	if err != nil {
+		httpErr := dto.MapErr(err)
+		_ = c.Error(err)
+		c.JSON(httpErr.StatusCode, httpErr)
+		return
+	}
+	if body == nil {
+		c.Status(status)
+		return
+	}
+	c.JSON(status, body)
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/dto"
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduleHandler struct {
+	ScheduleSvc *usecase.ScheduleService
+	Logger      domain.LoggingRepository
+}
+
+func NewScheduleHandler(schedulesvc *usecase.ScheduleService, logger domain.LoggingRepository) *ScheduleHandler {
+	return &ScheduleHandler{ScheduleSvc: schedulesvc, Logger: logger}
+}
+
+func toScheduleResponse(s *domain.StorySchedule) dto.ScheduleResponse {
+	return dto.ScheduleResponse{
+		ID:              s.ID,
+		CronExpr:        s.CronExpr,
+		TimeZone:        s.TimeZone,
+		MissedRunPolicy: s.MissedRunPolicy,
+		Enabled:         s.Enabled,
+		NextRunAt:       s.NextRunAt,
+		LastRunAt:       s.LastRunAt,
+	}
+}
+
+func toStorySchedule(req dto.Schedule, userID int) domain.StorySchedule {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return domain.StorySchedule{
+		UserID:          userID,
+		CronExpr:        req.CronExpr,
+		TimeZone:        req.TimeZone,
+		MissedRunPolicy: req.MissedRunPolicy,
+		Enabled:         enabled,
+	}
+}
+
+func scheduleID(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		return 0, domain.NewDomainError(domain.ErrCodeValidation, "invalid schedule id", err)
+	}
+	return id, nil
+}
+
+// CreateScheduleHandler godoc
+// @Summary Create a story schedule
+// @Description Creates a recurring story schedule from a cron expression evaluated in the given time zone
+// @Tags Schedules
+// @Accept json
+// @Produce json
+// @Param request body dto.Schedule true "Schedule payload"
+// @Success 201 {object} dto.ScheduleResponse "Schedule created"
+// @Failure 400 {object} dto.HttpError "Invalid cron expression or time zone"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /schedules [post]
+func (h *ScheduleHandler) CreateScheduleHandler(c *gin.Context) {
+	req := c.MustGet("payload").(dto.Schedule)
+	schedule, err := h.ScheduleSvc.CreateSchedule(c.Request.Context(), toStorySchedule(req, c.GetInt("user_id")))
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusCreated, toScheduleResponse(schedule), nil)
+}
+
+// ListSchedulesHandler godoc
+// @Summary List story schedules
+// @Description Lists the story schedules of the authenticated user
+// @Tags Schedules
+// @Produce json
+// @Success 200 {array} dto.ScheduleResponse "Schedules"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 500 {object} dto.HttpError "Internal server error"
+// @Router /schedules [get]
+func (h *ScheduleHandler) ListSchedulesHandler(c *gin.Context) {
+	schedules, err := h.ScheduleSvc.ListSchedules(c.Request.Context(), c.GetInt("user_id"))
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	resp := make([]dto.ScheduleResponse, 0, len(schedules))
+	for i := range schedules {
+		resp = append(resp, toScheduleResponse(&schedules[i]))
+	}
+	respond(c, http.StatusOK, resp, nil)
+}
+
+// GetScheduleHandler godoc
+// @Summary Get a story schedule
+// @Tags Schedules
+// @Produce json
+// @Param id path int true "Schedule ID"
+// @Success 200 {object} dto.ScheduleResponse "Schedule"
+// @Failure 400 {object} dto.HttpError "Invalid schedule id"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 404 {object} dto.HttpError "Schedule not found"
+// @Router /schedules/{id} [get]
+func (h *ScheduleHandler) GetScheduleHandler(c *gin.Context) {
+	id, err := scheduleID(c)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	schedule, err := h.ScheduleSvc.GetSchedule(c.Request.Context(), c.GetInt("user_id"), id)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusOK, toScheduleResponse(schedule), nil)
+}
+
+// UpdateScheduleHandler godoc
+// @Summary Replace a story schedule
+// @Description Replaces the cron expression, time zone, missed-run policy and enabled flag, and recomputes the next run
+// @Tags Schedules
+// @Accept json
+// @Produce json
+// @Param id path int true "Schedule ID"
+// @Param request body dto.Schedule true "Schedule payload"
+// @Success 200 {object} dto.ScheduleResponse "Schedule updated"
+// @Failure 400 {object} dto.HttpError "Invalid cron expression or time zone"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 404 {object} dto.HttpError "Schedule not found"
+// @Router /schedules/{id} [put]
+func (h *ScheduleHandler) UpdateScheduleHandler(c *gin.Context) {
+	id, err := scheduleID(c)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	req := c.MustGet("payload").(dto.Schedule)
+	s := toStorySchedule(req, c.GetInt("user_id"))
+	s.ID = id
+
+	schedule, err := h.ScheduleSvc.UpdateSchedule(c.Request.Context(), s)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusOK, toScheduleResponse(schedule), nil)
+}
+
+// DeleteScheduleHandler godoc
+// @Summary Delete a story schedule
+// @Tags Schedules
+// @Param id path int true "Schedule ID"
+// @Success 204 "Schedule deleted"
+// @Failure 400 {object} dto.HttpError "Invalid schedule id"
+// @Failure 401 {object} dto.HttpError "Unauthorized"
+// @Failure 404 {object} dto.HttpError "Schedule not found"
+// @Router /schedules/{id} [delete]
+func (h *ScheduleHandler) DeleteScheduleHandler(c *gin.Context) {
+	id, err := scheduleID(c)
+	if err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	if err := h.ScheduleSvc.DeleteSchedule(c.Request.Context(), c.GetInt("user_id"), id); err != nil {
+		respond(c, 0, nil, err)
+		return
+	}
+	respond(c, http.StatusNoContent, nil, nil)
+}
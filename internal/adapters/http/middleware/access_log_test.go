@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type logEntry struct {
+	level string
+	msg   string
+	attrs map[string]any
+}
+
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) record(level, msg string, args []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	attrs := make(map[string]any)
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs[args[i].(string)] = args[i+1]
+	}
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, attrs: attrs})
+}
+
+func (l *recordingLogger) Info(msg string, args ...interface{})  { l.record("info", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...interface{})  { l.record("warn", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) { l.record("error", msg, args) }
+func (l *recordingLogger) With(args ...interface{}) domain.LoggingRepository {
+	return l
+}
+
+func newAccessLogRouter(logger domain.LoggingRepository) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(AddRequestIDAndTime(), AccessLogMiddleware(logger), PanicRecoveryMiddleware(logger))
+	g.GET("/schedules/:id", func(c *gin.Context) {
+		c.Set("user_id", 7)
+		_ = c.Error(domain.NewDomainError(domain.ErrCodeNotFound, "schedule not found", nil))
+		c.JSON(http.StatusNotFound, gin.H{"Message": "schedule not found"})
+	})
+	g.GET("/panic", func(c *gin.Context) { panic("boom") })
+	return g
+}
+
+func serve(g *gin.Engine, path string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	g.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestAccessLogReportsHandlerErrors(t *testing.T) {
+	logger := &recordingLogger{}
+	serve(newAccessLogRouter(logger), "/schedules/3")
+
+	if len(logger.entries) != 1 {
+		t.Fatalf("got %d log entries, want 1", len(logger.entries))
+	}
+	entry := logger.entries[0]
+	want := map[string]any{
+		"http.request.path":         "/schedules/:id",
+		"url.path":                  "/schedules/3",
+		"http.response.status_code": http.StatusNotFound,
+		"http.request.id":           "req-1",
+		"user.id":                   7,
+		"error.code":                domain.ErrCodeNotFound,
+	}
+	for key, value := range want {
+		if entry.attrs[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry.attrs[key], value)
+		}
+	}
+	if entry.level != "warn" {
+		t.Errorf("level = %s, want warn", entry.level)
+	}
+}
+
+func TestAccessLogCoversUnmatchedRoutesAndPanics(t *testing.T) {
+	logger := &recordingLogger{}
+	g := newAccessLogRouter(logger)
+	serve(g, "/nowhere")
+	serve(g, "/panic")
+
+	var access []logEntry
+	for _, e := range logger.entries {
+		if _, ok := e.attrs["http.response.status_code"]; ok {
+			access = append(access, e)
+		}
+	}
+	if len(access) != 2 {
+		t.Fatalf("got %d access log entries, want 2", len(access))
+	}
+	if got := access[0].attrs["http.request.path"]; got != "unmatched" || access[0].attrs["http.response.status_code"] != http.StatusNotFound {
+		t.Errorf("unmatched route logged as %v", access[0].attrs)
+	}
+	if access[1].level != "error" || access[1].attrs["http.response.status_code"] != http.StatusInternalServerError {
+		t.Errorf("panic logged as %s %v", access[1].level, access[1].attrs)
+	}
+}
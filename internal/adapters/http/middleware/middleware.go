@@ -1,11 +1,15 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,27 +20,73 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func AuthenticateMiddleware(auth domain.JwtTokenRepository, secretKey []byte) gin.HandlerFunc {
+func AuthenticateMiddleware(auth domain.JwtTokenRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// token, err := c.Cookie("access-token")
 		authHeader := c.GetHeader("Authorization")
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
 			httpErr := dto.HttpError{Message: "Invalid Authorization format", Code: domain.ErrCodeUnauthorized, StatusCode: http.StatusUnauthorized}
-			c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+			abort(c, httpErr, nil)
 			return
 		}
 		tokenString := parts[1]
-		token, err := auth.VerifyJWTToken(tokenString, secretKey)
+		token, err := auth.VerifyJWTToken(tokenString)
 		if err != nil {
 			httpErr := dto.HttpError{Message: "Invalid or expired token", Code: domain.ErrCodeUnauthorized, StatusCode: http.StatusUnauthorized}
-			c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+			abort(c, httpErr, err)
 			return
 		}
 		user_id := token.UserID
 		c.Set("user_id", int(user_id))
+		c.Set("role", token.Role)
+		c.Request = c.Request.WithContext(observability.WithUserID(c.Request.Context(), int(user_id)))
+		c.Next()
+	}
+}
+
+// UserLookup reads the current state of a user, as opposed to what their
+// access token says.
+type UserLookup interface {
+	GetUserByID(ctx context.Context, id int) (*domain.User, error)
+}
+
+// RequireRole lets through users holding one of roles. It must run after
+// AuthenticateMiddleware; tokens issued before roles existed carry none and
+// are rejected until refreshed. The token role only short-cuts the rejection:
+// the role stored for the user must match too, so a demoted or deleted user
+// loses access right away instead of when the access token expires.
+func RequireRole(users UserLookup, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, c.GetString("role")) {
+			httpErr := dto.HttpError{Message: "insufficient role", Code: domain.ErrCodeForbidden, StatusCode: http.StatusForbidden}
+			abort(c, httpErr, nil)
+			return
+		}
+
+		user, err := users.GetUserByID(c.Request.Context(), c.GetInt("user_id"))
+		if errors.Is(err, domain.ErrUserNotFound) {
+			httpErr := dto.HttpError{Message: "Invalid or expired token", Code: domain.ErrCodeUnauthorized, StatusCode: http.StatusUnauthorized}
+			abort(c, httpErr, err)
+			return
+		}
+		if err != nil {
+			httpErr := dto.HttpError{Message: "failed to check role", Code: domain.ErrCodeInternal, StatusCode: http.StatusInternalServerError}
+			abort(c, httpErr, err)
+			return
+		}
+		if !slices.Contains(roles, user.Role) {
+			httpErr := dto.HttpError{Message: "insufficient role", Code: domain.ErrCodeForbidden, StatusCode: http.StatusForbidden}
+			abort(c, httpErr, nil)
+			return
+		}
 		c.Next()
 	}
 }
@@ -52,6 +102,7 @@ func AddRequestIDAndTime() gin.HandlerFunc {
 
 		ctx := observability.WithRequestID(c.Request.Context(), requestID)
 		ctx = observability.WithrequestStartTimeKey(ctx)
+		ctx = observability.WithClientIP(ctx, c.ClientIP())
 		c.Request = c.Request.WithContext(ctx)
 		c.Writer.Header().Set("X-Request-Id", requestID)
 		c.Set("RequestID", requestID)
@@ -81,7 +132,7 @@ func CheckContentType() gin.HandlerFunc {
 		parts := strings.Split(contentType, ";")
 		if len(parts) == 0 || strings.TrimSpace(strings.ToLower(parts[0])) != "application/json" {
 			httpErr := dto.HttpError{Message: "invalid content type, expected application/json", Code: domain.ErrCodeValidation, StatusCode: http.StatusBadRequest}
-			c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+			abort(c, httpErr, nil)
 			return
 		}
 		c.Next()
@@ -106,43 +157,43 @@ func CheckContentBody[T any](maxsize int) gin.HandlerFunc {
 
 			case errors.Is(err, io.EOF):
 				httpErr := dto.HttpError{Message: "body must not be empty", Code: domain.ErrCodeValidation, StatusCode: http.StatusBadRequest}
-				c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+				abort(c, httpErr, err)
 				return
 
 			case errors.Is(err, io.ErrUnexpectedEOF):
 				httpErr := dto.HttpError{Message: "body contains badly-formed json", Code: domain.ErrCodeValidation, StatusCode: http.StatusBadRequest}
-				c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+				abort(c, httpErr, err)
 				return
 
 			case err.Error() == "http: request body too large":
 				httpErr := dto.HttpError{Message: fmt.Sprintf("body must not be larger than %d bytes", maxsize), Code: domain.ErrCodeValidation, StatusCode: http.StatusRequestEntityTooLarge}
-				c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+				abort(c, httpErr, err)
 				return
 
 			case errors.As(err, &syntanxErr):
 				httpErr := dto.HttpError{Message: fmt.Sprintf("body contains badly-formed json at character %d", syntanxErr.Offset), Code: domain.ErrCodeValidation, StatusCode: http.StatusBadRequest}
-				c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+				abort(c, httpErr, err)
 				return
 
 			case errors.As(err, &unmarshalTypeErr):
 				httpErr := dto.HttpError{Message: fmt.Sprintf("body contains incorrect json type for %q at %d", unmarshalTypeErr.Field, unmarshalTypeErr.Offset), Code: domain.ErrCodeValidation, StatusCode: http.StatusBadRequest}
-				c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+				abort(c, httpErr, err)
 				return
 
 			case strings.HasPrefix(err.Error(), "json: unknown field"):
 				fieldname := strings.TrimPrefix(err.Error(), "json: unknown field")
 				httpErr := dto.HttpError{Message: fmt.Sprintf("body contains unknow key %s", fieldname), Code: domain.ErrCodeValidation, StatusCode: http.StatusBadRequest}
-				c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+				abort(c, httpErr, err)
 				return
 
 			case errors.As(err, &invalidmarshaltype):
 				httpErr := dto.HttpError{Message: fmt.Sprintf("error unmarshaling json: %s", invalidmarshaltype.Error()), Code: domain.ErrCodeValidation, StatusCode: http.StatusInternalServerError}
-				c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+				abort(c, httpErr, err)
 				return
 
 			default:
 				httpErr := dto.HttpError{Message: fmt.Sprintf("error happend: %s", err.Error()), Code: domain.ErrCodeValidation, StatusCode: http.StatusBadRequest}
-				c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+				abort(c, httpErr, err)
 				return
 
 			}
@@ -153,7 +204,7 @@ func CheckContentBody[T any](maxsize int) gin.HandlerFunc {
 		err = dec.Decode(&struct{}{})
 		if err != io.EOF {
 			httpErr := dto.HttpError{Message: "body must contain only one json value", Code: domain.ErrCodeValidation, StatusCode: http.StatusBadRequest}
-			c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+			abort(c, httpErr, nil)
 			return
 		}
 
@@ -161,19 +212,19 @@ func CheckContentBody[T any](maxsize int) gin.HandlerFunc {
 		err = validate.RegisterValidation("passwod_strength", utils.PasswordValidator)
 		if err != nil {
 			httpErr := dto.HttpError{Message: "failed to register validation", Code: domain.ErrCodeInternal, StatusCode: http.StatusInternalServerError}
-			c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+			abort(c, httpErr, err)
 			return
 		}
 		err = validate.RegisterValidation("user_preferences_check", utils.UserPreferencesValidation)
 		if err != nil {
 			httpErr := dto.HttpError{Message: "failed to register validation", Code: domain.ErrCodeInternal, StatusCode: http.StatusInternalServerError}
-			c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+			abort(c, httpErr, err)
 			return
 		}
 		err = validate.Struct(u)
 		if err != nil {
 			httpErr := dto.HttpError{Message: err.Error(), Code: domain.ErrCodeInternal, StatusCode: http.StatusBadRequest}
-			c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+			abort(c, httpErr, nil)
 			return
 		}
 		c.Set("payload", u)
@@ -182,114 +233,157 @@ func CheckContentBody[T any](maxsize int) gin.HandlerFunc {
 	}
 }
 
-func RateLimiterMiddelware(ipratelimiter *RedisRateLimiter, logger domain.LoggingRepository) gin.HandlerFunc {
+// routeLabel is the route template, so /schedules/1 and /schedules/2 share
+// one series. Unmatched paths are grouped as well to bound the cardinality.
+func routeLabel(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+// MetricsMiddleware counts requests and records their latency by route and
+// status.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := strconv.Itoa(c.Writer.Status())
+		route := routeLabel(c)
+		observability.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		observability.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// TracingMiddleware starts the server span of a request, continuing the trace
+// of the caller when it sends a traceparent header. It must run after
+// AddRequestIDAndTime so the span carries the request ID.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := routeLabel(c)
+		ctx, span := observability.Tracer().Start(ctx, fmt.Sprintf("%s %s", c.Request.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("http.request.id", observability.GetRequestID(ctx)),
+				attribute.String("client.address", c.ClientIP()),
+			))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+func RateLimiterMiddelware(ipratelimiter *RedisRateLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
-		log := logger.With(
-			"service.name", "rate_limiter_middleware",
-			"@timestamp", time.Now().UTC().Format(time.RFC3339Nano),
-			"event.category", []string{"authentication", "web"},
-			"http.request.method", c.Request.Method,
-			"http.request.path", c.FullPath(),
-			"http.request.agent", c.Request.UserAgent(),
-			"http.request.id", observability.GetRequestID(c.Request.Context()),
-			"client.ip", c.ClientIP(),
-		)
 		if ip == "" {
-			log.Error(
-				"invalid ip address",
-				"error.message", "invalid ip address",
-				"error.code", http.StatusBadRequest,
-				"event.action", "middleware.rate_limiter",
-				"event.outcome", "failed",
-				"event.type", []string{"end", "denied"},
-			)
 			httpErr := dto.HttpError{Message: "invalid ip", Code: domain.ErrCodeValidation, StatusCode: http.StatusBadRequest}
-			c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+			abort(c, httpErr, nil)
 			return
 		}
 		// rateLimiter := ipratelimiter.RequestRateLimiter(ip, capacity, fillrate)
 		ok, err := ipratelimiter.AllowRequest(c, ip)
 		if err != nil {
-			log.Error(
-				"redis is not available",
-				"error.message", "Service Unavailable",
-				"error.code", http.StatusServiceUnavailable,
-				"event.action", "middleware.rate_limiter",
-				"event.outcome", "failed",
-				"event.type", []string{"end", "denied"},
-			)
 			httpErr := dto.HttpError{Message: "Rate Limit Exceeded", Code: domain.ErrCodeExternal, StatusCode: http.StatusServiceUnavailable}
-			c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+			abort(c, httpErr, err)
 			return
 		}
 		if !ok {
-			log.Error(
-				"rate limit exceeded",
-				"error.message", "rate limit exceeded",
-				"error.code", http.StatusTooManyRequests,
-				"event.action", "middleware.rate_limiter",
-				"event.outcome", "failed",
-				"event.type", []string{"end", "denied"},
-			)
+			observability.RateLimitRejections.WithLabelValues(routeLabel(c)).Inc()
 			httpErr := dto.HttpError{Message: "Rate Limit Exceeded", Code: domain.ErrCodeRateLimited, StatusCode: http.StatusTooManyRequests}
-			c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+			abort(c, httpErr, nil)
 			return
 		}
 		c.Next()
 	}
 }
 
-// func LoggingRequestMiddleware(logger domain.LoggingRepository) gin.HandlerFunc {
-// 	return func(c *gin.Context) {
-
-// 		log := logger.With(
-// 			"service.name", "user_verification",
-// 			"@timestamp", time.Now().UTC().Format(time.RFC3339Nano),
-// 			"event.category", []string{"web"},
-// 			"http.request.method", c.Request.Method,
-// 			"http.request.path", c.FullPath(),
-// 			"http.request.agent", c.Request.UserAgent(),
-// 			"http.request.id", c.GetString("RequestID"),
-// 			"client.ip", c.ClientIP(),
-// 		)
-
-// 		log.Info(
-// 			"http request started",
-// 			"event.action", "http.request",
-// 			"event.type", "start",
-// 		)
-
-// 		c.Next()
-// 	}
-// }
+// abort answers with httpErr and attaches it, with its cause, for the access
+// log.
+func abort(c *gin.Context, httpErr dto.HttpError, cause error) {
+	_ = c.Error(domain.NewDomainError(httpErr.Code, httpErr.Message, cause))
+	c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+}
+
+// AccessLogMiddleware writes one ECS entry per request once the response is
+// done, including 404s and requests rejected by other middleware. Handlers
+// report failures with c.Error instead of logging them. It must run after
+// AddRequestIDAndTime and TracingMiddleware and before the panic recovery, so
+// recovered panics are logged as 500s.
+func AccessLogMiddleware(logger domain.LoggingRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		ctx := c.Request.Context()
+		var duration time.Duration
+		if start, ok := observability.GetrequestStartTimeKey(ctx); ok {
+			duration = time.Since(start)
+		}
+		status := c.Writer.Status()
+
+		args := []any{
+			"service.name", "http",
+			"event.category", []string{"web"},
+			"event.action", "http.request",
+			"event.duration", duration.Nanoseconds(),
+			"http.request.method", c.Request.Method,
+			"http.request.path", routeLabel(c),
+			"http.request.agent", c.Request.UserAgent(),
+			"http.request.id", observability.GetRequestID(ctx),
+			"http.response.status_code", status,
+			"http.response.body.bytes", max(c.Writer.Size(), 0),
+			"url.path", c.Request.URL.Path,
+			"client.ip", c.ClientIP(),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			args = append(args, "user.id", userID)
+		}
+		if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+			args = append(args, "trace.id", spanCtx.TraceID().String(), "span.id", spanCtx.SpanID().String())
+		}
+		if err := c.Errors.Last(); err != nil {
+			args = append(args, "error.message", err.Error(), "error.code", dto.MapErr(err.Err).Code)
+		}
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			logger.Error("http request failed", append(args, "event.outcome", "failure", "event.type", []string{"error", "end"})...)
+		case status >= http.StatusBadRequest:
+			logger.Warn("http request failed", append(args, "event.outcome", "failure", "event.type", []string{"end", "denied"})...)
+		default:
+			logger.Info("http request completed", append(args, "event.outcome", "success", "event.type", []string{"end"})...)
+		}
+	}
+}
 
 func PanicRecoveryMiddleware(logger domain.LoggingRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		defer func() {
-			log := logger.With(
-				"service.name", "middleware_panic_recovery",
-				"@timestamp", time.Now().UTC().Format(time.RFC3339Nano),
-				"event.category", []string{"authentication", "web"},
-				"http.request.method", c.Request.Method,
-				"http.request.path", c.FullPath(),
-				"http.request.agent", c.Request.UserAgent(),
-				"http.request.id", observability.GetRequestID(c.Request.Context()),
-				"client.ip", c.ClientIP(),
-			)
 			if r := recover(); r != nil {
-				log.Error(
+				logger.Error(
 					"internal server error",
 					"error.message", fmt.Sprintf("%v", r),
-					"error.code", http.StatusInternalServerError,
+					"error.stack_trace", string(debug.Stack()),
 					"event.action", "middleware.panic_recovery",
 					"event.outcome", "failed",
 					"event.type", []string{"end", "error"},
+					"http.request.id", observability.GetRequestID(c.Request.Context()),
 				)
 
 				httpErr := dto.HttpError{Message: "internal server error", Code: domain.ErrCodeInternal, StatusCode: http.StatusInternalServerError}
-				c.AbortWithStatusJSON(httpErr.StatusCode, httpErr)
+				abort(c, httpErr, fmt.Errorf("panic: %v", r))
 			}
 		}()
 
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/security"
+	"github.com/gin-gonic/gin"
+)
+
+// storedRoles maps user IDs to the role kept in the database; missing users
+// are deleted.
+type storedRoles map[int]string
+
+func (r storedRoles) GetUserByID(ctx context.Context, id int) (*domain.User, error) {
+	role, ok := r[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	return &domain.User{ID: id, Role: role}, nil
+}
+
+func TestRequireRoleChecksTheAccessTokenRole(t *testing.T) {
+	auth := security.JwtAuth{AccessSecret: []byte("access-secret"), RefreshSecret: []byte("refresh-secret"), Issuer: "test"}
+
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	users := storedRoles{7: ""}
+	g.GET("/admin", AuthenticateMiddleware(auth), RequireRole(users, domain.RoleAdmin, domain.RoleSupport), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		role string
+		want int
+	}{
+		{domain.RoleAdmin, http.StatusNoContent},
+		{domain.RoleSupport, http.StatusNoContent},
+		{domain.RoleUser, http.StatusForbidden},
+		// tokens issued before roles existed
+		{"", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		users[7] = tt.role
+		pair, err := auth.CreateJWTToken(7, "reza@example.com", tt.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rec := httptest.NewRecorder()
+		g.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("role %q: got %d, want %d", tt.role, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestRequireRoleChecksTheStoredRole(t *testing.T) {
+	auth := security.JwtAuth{AccessSecret: []byte("access-secret"), RefreshSecret: []byte("refresh-secret"), Issuer: "test"}
+
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	users := storedRoles{}
+	g.GET("/admin", AuthenticateMiddleware(auth), RequireRole(users, domain.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	// the token was issued while the user was still an admin
+	pair, err := auth.CreateJWTToken(7, "reza@example.com", domain.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		stored *string
+		want   int
+	}{
+		{"still admin", ptr(domain.RoleAdmin), http.StatusNoContent},
+		{"demoted", ptr(domain.RoleUser), http.StatusForbidden},
+		{"deleted", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		delete(users, 7)
+		if tt.stored != nil {
+			users[7] = *tt.stored
+		}
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rec := httptest.NewRecorder()
+		g.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+func ptr(s string) *string { return &s }
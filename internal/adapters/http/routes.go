@@ -1,12 +1,14 @@
 package router
 
 import (
+	"net/http"
 	"time"
 
 	_ "github.com/KianoushAmirpour/notification_server/docs"
 	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/dto"
 	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/handler"
 	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/middleware"
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -14,35 +16,82 @@ import (
 )
 
 type RouterConfig struct {
-	UserHandler *handler.UserHandler
+	UserHandler     *handler.UserHandler
+	ScheduleHandler *handler.ScheduleHandler
+	AdminHandler    *handler.AdminHandler
+	AccountHandler  *handler.AccountHandler
+	ProfileHandler  *handler.ProfileHandler
+	MagicLink       *handler.MagicLinkHandler
+	MFAHandler      *handler.MFAHandler
+	OIDCHandler     *handler.OIDCHandler
+	JWKSHandler     *handler.JWKSHandler
+	// Users backs the role check of the admin routes
+	Users     middleware.UserLookup
+	Liveness  http.Handler
+	Readiness http.Handler
 }
 
 func SetupRoutes(config RouterConfig) *gin.Engine {
 
-	g := gin.Default()
+	// not gin.Default: its logger writes the raw query, which carries magic
+	// link tokens and OIDC codes; AccessLogMiddleware logs the path only
+	g := gin.New()
 	g.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// probes skip the rate limiter, kubelets poll them from a handful of IPs
+	g.GET("/livez", gin.WrapH(config.Liveness))
+	g.GET("/readyz", gin.WrapH(config.Readiness))
+	g.GET("/.well-known/jwks.json", config.JWKSHandler.JWKSHandler)
 	g.Use(
+		middleware.MetricsMiddleware(),
 		cors.New(cors.Config{
 			AllowOrigins:     []string{"https://*", "http://*"},
-			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowHeaders:     []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+			AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowHeaders:     []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match"},
+			ExposeHeaders:    []string{"ETag"},
 			AllowCredentials: true,
 			MaxAge:           12 * time.Hour,
 		}),
 		middleware.AddRequestIDAndTime(),
+		middleware.TracingMiddleware(),
+		middleware.AccessLogMiddleware(config.UserHandler.Logger),
 		middleware.PanicRecoveryMiddleware(config.UserHandler.Logger),
-		middleware.RateLimiterMiddelware(
-			config.UserHandler.IpRateLimiter,
-			config.UserHandler.Logger),
-		// middleware.LoggingRequestMiddleware(config.UserHandler.Logger),
+		middleware.RateLimiterMiddelware(config.UserHandler.IpRateLimiter),
 	)
 
 	// protected routes
 	protected := g.Group("")
-	protected.Use(middleware.AuthenticateMiddleware(config.UserHandler.JwtHandler, []byte(config.UserHandler.JwtSecret)))
+	protected.Use(middleware.AuthenticateMiddleware(config.UserHandler.JwtHandler))
 	{
-		protected.Handle("DELETE", "/users", middleware.CheckContentType(), middleware.CheckContentBody[dto.DeleteUser](config.UserHandler.MaxAllowedSize), config.UserHandler.DeleteUserHandler)
+		protected.Handle("GET", "/users/me", config.ProfileHandler.GetProfileHandler)
+		protected.Handle("PATCH", "/users/me", middleware.CheckContentType(), middleware.CheckContentBody[dto.ProfileUpdate](config.UserHandler.MaxAllowedSize), config.ProfileHandler.UpdateProfileHandler)
+		protected.Handle("GET", "/users/me/preferences", config.ProfileHandler.GetPreferencesHandler)
+		protected.Handle("PUT", "/users/me/preferences", middleware.CheckContentType(), middleware.CheckContentBody[dto.UserPreferences](config.UserHandler.MaxAllowedSize), config.ProfileHandler.ReplacePreferencesHandler)
+		protected.Handle("DELETE", "/users/me", middleware.CheckContentType(), middleware.CheckContentBody[dto.DeleteAccount](config.UserHandler.MaxAllowedSize), config.UserHandler.DeleteAccountHandler)
+		protected.Handle("POST", "/users/me/deletion-otp", config.UserHandler.RequestAccountDeletionHandler)
+		protected.Handle("POST", "/users/me/email", middleware.CheckContentType(), middleware.CheckContentBody[dto.EmailChange](config.UserHandler.MaxAllowedSize), config.UserHandler.RequestEmailChangeHandler)
+		protected.Handle("POST", "/users/me/email/verify", middleware.CheckContentType(), middleware.CheckContentBody[dto.EmailChangeVerify](config.UserHandler.MaxAllowedSize), config.UserHandler.ConfirmEmailChangeHandler)
+		protected.Handle("GET", "/users/me/export", config.AccountHandler.ExportAccountHandler)
+		protected.Handle("POST", "/users/me/oidc/link", config.OIDCHandler.OIDCLinkHandler)
+		// MFAHandler is nil while MFA is off
+		if config.MFAHandler != nil {
+			protected.Handle("POST", "/users/me/mfa", middleware.CheckContentType(), middleware.CheckContentBody[dto.MFAEnroll](config.UserHandler.MaxAllowedSize), config.MFAHandler.EnrollMFAHandler)
+			protected.Handle("POST", "/users/me/mfa/verify", middleware.CheckContentType(), middleware.CheckContentBody[dto.MFACode](config.UserHandler.MaxAllowedSize), config.MFAHandler.ActivateMFAHandler)
+		}
 		protected.Handle("POST", "/stories", config.UserHandler.StoryGenerationHandler)
+
+		protected.Handle("POST", "/schedules", middleware.CheckContentType(), middleware.CheckContentBody[dto.Schedule](config.UserHandler.MaxAllowedSize), config.ScheduleHandler.CreateScheduleHandler)
+		protected.Handle("GET", "/schedules", config.ScheduleHandler.ListSchedulesHandler)
+		protected.Handle("GET", "/schedules/:id", config.ScheduleHandler.GetScheduleHandler)
+		protected.Handle("PUT", "/schedules/:id", middleware.CheckContentType(), middleware.CheckContentBody[dto.Schedule](config.UserHandler.MaxAllowedSize), config.ScheduleHandler.UpdateScheduleHandler)
+		protected.Handle("DELETE", "/schedules/:id", config.ScheduleHandler.DeleteScheduleHandler)
+	}
+
+	admin := g.Group("/admin")
+	admin.Use(middleware.AuthenticateMiddleware(config.UserHandler.JwtHandler))
+	{
+		admin.Handle("GET", "/audit-events", middleware.RequireRole(config.Users, domain.RoleAdmin, domain.RoleSupport), config.AdminHandler.ListAuditEventsHandler)
+		admin.Handle("DELETE", "/users/:id", middleware.RequireRole(config.Users, domain.RoleAdmin), config.UserHandler.DeleteUserHandler)
+		admin.Handle("PUT", "/users/:id/role", middleware.RequireRole(config.Users, domain.RoleAdmin), middleware.CheckContentType(), middleware.CheckContentBody[dto.UserRole](config.UserHandler.MaxAllowedSize), config.AdminHandler.ChangeUserRoleHandler)
 	}
 
 	// auth and register routes
@@ -51,7 +100,14 @@ func SetupRoutes(config RouterConfig) *gin.Engine {
 	{
 		auth.Handle("POST", "/register", middleware.CheckContentBody[dto.RegisteredUser](config.UserHandler.MaxAllowedSize), config.UserHandler.RegisterHandler)
 		auth.Handle("POST", "/verify", middleware.CheckContentBody[dto.RegisterVerify](config.UserHandler.MaxAllowedSize), config.UserHandler.VerificationHandler)
+		auth.Handle("POST", "/verify/resend", middleware.CheckContentBody[dto.ResendVerification](config.UserHandler.MaxAllowedSize), config.UserHandler.ResendVerificationHandler)
 		auth.Handle("POST", "/login", middleware.CheckContentBody[dto.LoginUser](config.UserHandler.MaxAllowedSize), config.UserHandler.LoginHandler)
+		if config.MFAHandler != nil {
+			auth.Handle("POST", "/mfa", middleware.CheckContentBody[dto.MFALogin](config.UserHandler.MaxAllowedSize), config.MFAHandler.CompleteMFALoginHandler)
+		}
+		auth.Handle("POST", "/restore", middleware.CheckContentBody[dto.RestoreAccount](config.UserHandler.MaxAllowedSize), config.AccountHandler.RestoreAccountHandler)
+		auth.Handle("POST", "/restore/otp", middleware.CheckContentBody[dto.RestoreAccountOTP](config.UserHandler.MaxAllowedSize), config.AccountHandler.RequestRestoreOTPHandler)
+		auth.Handle("POST", "/magic-link", middleware.CheckContentBody[dto.MagicLinkRequest](config.UserHandler.MaxAllowedSize), config.MagicLink.RequestMagicLinkHandler)
 
 	}
 
@@ -59,6 +115,11 @@ func SetupRoutes(config RouterConfig) *gin.Engine {
 	g.Handle("GET", "/home", config.UserHandler.HomePageHandler)
 	g.Handle("GET", "/health", config.UserHandler.HealthHandler)
 	g.Handle("POST", "/refresh", config.UserHandler.JwtRefreshHandler)
+	// opened from an email client, so it carries no JSON body
+	g.Handle("GET", "/auth/magic-link/callback", config.MagicLink.MagicLinkCallbackHandler)
+	// browser redirects to and from the identity provider
+	g.Handle("GET", "/auth/oidc/login", config.OIDCHandler.OIDCLoginHandler)
+	g.Handle("GET", "/auth/oidc/callback", config.OIDCHandler.OIDCCallbackHandler)
 
 	return g
 
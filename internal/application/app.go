@@ -5,164 +5,229 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
-	router "github.com/KianoushAmirpour/notification_server/internal/adapters/http"
-	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/handler"
-	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/middleware"
-	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/ai"
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
 	config "github.com/KianoushAmirpour/notification_server/internal/infrastructure/configs"
-	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/notification"
-	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/queue"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/memory"
 	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/postgres"
 	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/redis"
-	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/security"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/utils"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
 	"github.com/KianoushAmirpour/notification_server/internal/usecase"
 	"github.com/KianoushAmirpour/notification_server/pkg/logger"
+	"github.com/jackc/pgx/v5/pgxpool"
+	goredis "github.com/redis/go-redis/v9"
 )
 
+const (
+	StoryStream = "story"
+	EmailStream = "email"
+)
+
+var ErrMemoryBackendSplit = errors.New("the memory queue backend only works when every role runs in one process, use the all command")
+
 type App struct {
 	Cfg *config.Config
 }
 
-func (a App) Run() {
-
-	rootctx, rootcancel := context.WithCancel(context.Background())
-	defer rootcancel()
+// Run starts the API, the workers of every stream and the schedulers in one
+// process.
+func (a App) Run() error {
+	return a.run("all", a.api, a.workers(StoryStream, EmailStream), a.schedulers)
+}
 
-	logger := logger.NewLogger(a.Cfg.LogFile)
+// Serve runs only the HTTP API.
+func (a App) Serve() error {
+	return a.run("serve", a.api)
+}
 
-	dbPool, err := postgres.OpenDatabaseConnPool(a.Cfg.DatabaseDSN)
-	if err != nil {
-		logger.Error("database connection failed", "reason", err.Error())
-		panic(err)
+// Work runs the worker pools of the given streams, so they can be scaled
+// independently from the API.
+func (a App) Work(streams []string) error {
+	if len(streams) == 0 {
+		return fmt.Errorf("no stream to work on, expected %s or %s", StoryStream, EmailStream)
 	}
-	defer dbPool.Close()
-
-	redisConn, err := redis.ConnectToRedis(fmt.Sprintf("localhost:%d", a.Cfg.RedisPort), a.Cfg.RedisDB)
-	if err != nil {
-		logger.Error("redis connection failed", slog.String("reason", err.Error()))
-		panic(err)
+	for _, s := range streams {
+		if s != StoryStream && s != EmailStream {
+			return fmt.Errorf("unknown stream %q, expected %s or %s", s, StoryStream, EmailStream)
+		}
 	}
-	defer redisConn.Close()
+	return a.run("worker", a.workers(streams...))
+}
+
+// Schedule runs the retry schedulers, the outbox relay and the story schedule
+// runner.
+func (a App) Schedule() error {
+	return a.run("scheduler", a.schedulers)
+}
+
+// role is one part of the service. Building a role starts it; stop returns
+// once everything the role started has exited.
+type role struct {
+	name string
+	stop func()
+}
+
+type roleBuilder func(rootctx context.Context, d *deps) role
 
-	bcryptPasswordHasher := security.Hasher{Cost: a.Cfg.BcryptCost}
+// deps holds the connections and repositories every role shares.
+type deps struct {
+	logger          *logger.Logger
+	shutdownTracing func(context.Context) error
+	db              *pgxpool.Pool
+	redis           *goredis.Client
+	storyTask       taskStream
+	emailTask       taskStream
 
-	otpService := redis.NewRedisClient(redisConn, bcryptPasswordHasher)
+	userRepo     *postgres.UserRepo
+	storyRepo    *postgres.StoryRepo
+	scheduleRepo *postgres.ScheduleRepo
+}
+
+func (a App) run(command string, builders ...roleBuilder) error {
+	if command != "all" && a.Cfg.QueueBackend == "memory" {
+		return ErrMemoryBackendSplit
+	}
+
+	rootctx, rootcancel := context.WithCancel(context.Background())
+	defer rootcancel()
 
-	storyGenerationTask := &redis.Task{Client: redisConn, GroupName: a.Cfg.StoryConsumerGroup}
-	emailNotificationTask := &redis.Task{Client: redisConn, GroupName: a.Cfg.EmailConsumerGroup}
+	d := a.open(command)
 
-	mailer := notification.Mailer{
-		Host:      a.Cfg.SmtpHost,
-		Port:      a.Cfg.SmtpPort,
-		Username:  a.Cfg.SmtpUsername,
-		Password:  a.Cfg.SmtpPassword,
-		FromEmail: a.Cfg.FromEmail,
-		Logger:    logger}
+	roles := make([]role, 0, len(builders))
+	for _, build := range builders {
+		roles = append(roles, build(rootctx, d))
+	}
 
-	// iplimiter := middleware.NewIpLimiter()
-	redisRateLimier := middleware.NewRedisRateLimiter(redisConn, a.Cfg.RataLimitCapacity, a.Cfg.RataLimitFillRate, time.Hour)
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigchan
 
-	UserRepo := postgres.NewUserRepo(dbPool)
-	UserVerificationRepo := postgres.NewUserVerificationRepo(dbPool)
-	StoryRepo := postgres.NewStoryRepo(dbPool)
-	RefreshTokenRepo := postgres.NewRefreshTokenRepo(dbPool)
+	// roles stop in the order they were built: the API stops taking requests
+	// before the workers drain, and the schedulers flush what the workers
+	// produced while draining
+	for _, r := range roles {
+		d.logger.Info(fmt.Sprintf("stopping %s", r.name), "event.action", "shutdown", "event.type", []string{"end"})
+		r.stop()
+	}
 
-	otpgenerator := security.Otpgen{OTPLength: a.Cfg.OTPLength}
+	shutdownctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.shutdownTracing(shutdownctx); err != nil {
+		d.logger.Error("failed to flush traces", "reason", err.Error())
+	}
 
-	jwttoken := security.JwtAuth{AccessSecret: []byte(a.Cfg.JwtAccessSecret), RefreshSecret: []byte(a.Cfg.JwtRefreshSecret), Issuer: a.Cfg.JwtISS}
+	if err := d.redis.Close(); err != nil {
+		d.logger.Error("redis connection closed with error", "reason", err.Error())
+	}
+	d.db.Close()
 
-	userRegisterSvc := usecase.NewUserRegisterService(UserRepo, UserVerificationRepo, bcryptPasswordHasher, mailer, otpService, otpgenerator, jwttoken, RefreshTokenRepo, logger)
+	d.logger.Info("check number of goroutine", "number", runtime.NumGoroutine())
+	return nil
+}
 
-	gemeniClient, err := ai.NewGemeniClient(rootctx, a.Cfg.GeminiAPI, a.Cfg.GeminiModel)
+func (a App) open(command string) *deps {
+	logger, err := logger.NewLogger(logger.Options{
+		Level:      a.Cfg.LogLevel,
+		Output:     a.Cfg.LogOutput,
+		FilePath:   logFile(a.Cfg.LogFile, command),
+		MaxSizeMB:  a.Cfg.LogMaxSizeMB,
+		MaxAgeDays: a.Cfg.LogMaxAgeDays,
+		MaxBackups: a.Cfg.LogMaxBackups,
+		Compress:   a.Cfg.LogCompress,
+	})
 	if err != nil {
-		logger.Error("failed to create gemeni client", "reason", err.Error())
 		panic(err)
 	}
 
-	storyJobExecuter := usecase.NewStoryGenerationService(
-		UserRepo,
-		StoryRepo,
-		gemeniClient,
-		logger)
-	storyJobCompletionHandler := usecase.NewStoryGenerationJobCompletion(
-		StoryRepo,
-		storyGenerationTask,
-		a.Cfg.StoryGenerationStream,
-		a.Cfg.EmailNotificationStream,
-		a.Cfg.StoryDLQStream,
-		logger)
-
-	emailJobExecuter := usecase.NewEmailSenderService(mailer, logger)
-	emailJobCompletionHandler := usecase.NewEmailNotificationJobCompletion(
-		StoryRepo,
-		emailNotificationTask,
-		a.Cfg.EmailNotificationStream,
-		a.Cfg.EmailDLQStream,
-		logger)
-
-	// resultchan := make(chan domain.EmailNotificationJob, 100)
-	storyWorkerPool := queue.NewWorkerPool(rootctx, a.Cfg.WorkerCounts, logger, storyGenerationTask,
-		storyJobExecuter, storyJobCompletionHandler, a.Cfg.StoryGenerationStream, a.Cfg.StoryConsumerGroup, a.Cfg.JobRetryCount)
-	emailWorkerPool := queue.NewWorkerPool(rootctx, a.Cfg.WorkerCounts, logger, emailNotificationTask, emailJobExecuter, emailJobCompletionHandler,
-		a.Cfg.EmailNotificationStream, a.Cfg.EmailConsumerGroup, a.Cfg.JobRetryCount)
-	storyWorkerPool.Start()
-	emailWorkerPool.Start()
-	// emailWorkerPool := queue.NewEmailWorkerPool(rootctx, a.Cfg.WorkerCounts, a.Cfg.JobQueueSize, logger)
-	// emailWorkerPool.Start(resultchan)
-	// workerPool := queue.NewWorkerPool(rootctx, a.Cfg.WorkerCounts, a.Cfg.JobQueueSize, logger, mailer)
-	// workerPool.Start(resultchan)
-
-	schedulerStoryConsumer := queue.NewShedulerWorkerPool(rootctx, a.Cfg.SchedulerWorkerCounts, logger, a.Cfg.StoryRetryStream, storyGenerationTask, a.Cfg.StoryGenerationStream)
-	schedulerStoryConsumer.Start()
-	schedulerEmailConsumer := queue.NewShedulerWorkerPool(rootctx, a.Cfg.SchedulerWorkerCounts, logger, a.Cfg.EmailRetryStream, emailNotificationTask, a.Cfg.EmailNotificationStream)
-	schedulerEmailConsumer.Start()
-
-	storyScheduleService := usecase.NewStorySchedulerService(UserRepo, StoryRepo, storyGenerationTask, logger, a.Cfg.StoryGenerationStream)
-
-	h := handler.NewUserHandler(userRegisterSvc, storyScheduleService, redisRateLimier, jwttoken, logger,
-		a.Cfg.OTPExpiration, a.Cfg.JwtISS, a.Cfg.JwtAccessSecret, a.Cfg.JwtRefreshSecret, a.Cfg.RataLimitCapacity, a.Cfg.RataLimitFillRate,
-		a.Cfg.MaxAllowedSize)
-
-	routerCfg := router.RouterConfig{UserHandler: h}
-
-	g := router.SetupRoutes(routerCfg)
-
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", a.Cfg.ServerPort),
-		Handler: g,
+	shutdownTracing, err := observability.SetupTracing(context.Background(), "notification-server-"+command,
+		a.Cfg.TracingExporter, a.Cfg.TracingOTLPEndpoint, a.Cfg.TracingSampleRatio)
+	if err != nil {
+		logger.Error("tracing setup failed", "reason", err.Error())
+		panic(err)
 	}
 
-	go func() {
-		serverErr := server.ListenAndServe()
-		if serverErr != nil && !errors.Is(serverErr, http.ErrServerClosed) {
-			logger.Error("failed to start the server", "reason", err.Error())
-		}
-		logger.Info("successfully start the server")
-	}()
+	dbPool, err := postgres.OpenDatabaseConnPool(a.Cfg.DatabaseDSN)
+	if err != nil {
+		logger.Error("database connection failed", "reason", err.Error())
+		panic(err)
+	}
 
-	sigchan := make(chan os.Signal, 1)
-	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigchan
+	redisConn, err := redis.ConnectToRedis(fmt.Sprintf("localhost:%d", a.Cfg.RedisPort), a.Cfg.RedisDB)
+	if err != nil {
+		logger.Error("redis connection failed", slog.String("reason", err.Error()))
+		panic(err)
+	}
 
-	shutdownctx, shutdowncancelFunc := context.WithTimeout(context.Background(), time.Duration(a.Cfg.ServerShutdownTimeout)*time.Second)
-	defer shutdowncancelFunc()
-	if err := server.Shutdown(shutdownctx); err != nil {
-		logger.Error("server closed with error", "reason", err.Error())
+	memoryBroker := memory.NewBroker()
+
+	return &deps{
+		logger:          logger,
+		shutdownTracing: shutdownTracing,
+		db:              dbPool,
+		redis:           redisConn,
+		storyTask:       a.newTaskStreamHandler(redisConn, dbPool, memoryBroker, a.Cfg.StoryConsumerGroup),
+		emailTask:       a.newTaskStreamHandler(redisConn, dbPool, memoryBroker, a.Cfg.EmailConsumerGroup),
+		userRepo:        postgres.NewUserRepo(dbPool),
+		storyRepo:       postgres.NewStoryRepo(dbPool),
+		scheduleRepo:    postgres.NewScheduleRepo(dbPool),
 	}
+}
+
+func (a App) storyScheduler(d *deps) *usecase.StorySchedulerService {
+	return usecase.NewStorySchedulerService(d.userRepo, d.storyRepo, d.logger, a.Cfg.StoryGenerationStream, a.Cfg.MaxActiveStoryJobs)
+}
+
+func (a App) scheduleService(d *deps) *usecase.ScheduleService {
+	return usecase.NewScheduleService(d.scheduleRepo, utils.NewCronParser(), a.storyScheduler(d), d.logger,
+		a.Cfg.ScheduleBatchSize, time.Duration(a.Cfg.ScheduleMissedRunGrace)*time.Second)
+}
 
-	storyWorkerPool.Cancel()
-	emailWorkerPool.Cancel()
+func (a App) accountDataService(d *deps) *usecase.AccountDataService {
+	return usecase.NewAccountDataService(postgres.NewAccountDataRepo(d.db), postgres.NewAuditRepo(d.db), d.logger,
+		time.Duration(a.Cfg.AccountDeletionGraceDays)*24*time.Hour, a.Cfg.AccountPurgeBatchSize)
+}
 
-	storyWorkerPool.Wait()
-	emailWorkerPool.Wait()
+// logFile gives every command but all its own log file, e.g. logs/app.log
+// becomes logs/app.worker.log, so processes sharing a host do not truncate
+// each other's logs.
+func logFile(path string, command string) string {
+	if command == "all" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(path, ext), command, ext)
+}
 
-	logger.Info("check number of goroutine", "number", runtime.NumGoroutine())
+type taskStream interface {
+	domain.StreamTaskHandler
+	domain.StreamStatsReader
+	domain.ConsumerGroupChecker
+}
 
+func (a App) newTaskStreamHandler(redisConn *goredis.Client, dbPool *pgxpool.Pool, broker *memory.Broker, group string) taskStream {
+	readBlock := time.Duration(a.Cfg.StreamReadBlock) * time.Second
+	visibility := time.Duration(a.Cfg.QueueVisibilityTimeout) * time.Second
+	switch a.Cfg.QueueBackend {
+	case "memory":
+		task := memory.NewTask(broker, group)
+		task.ReadBlock = readBlock
+		task.ClaimIdle = visibility
+		return task
+	case "postgres":
+		return postgres.NewTask(dbPool, group,
+			visibility,
+			time.Duration(a.Cfg.QueuePollInterval)*time.Second,
+			readBlock,
+			a.Cfg.StoryDLQStream, a.Cfg.EmailDLQStream)
+	default:
+		return &redis.Task{Client: redisConn, GroupName: group, ReadBlock: readBlock, ClaimIdle: visibility}
+	}
 }
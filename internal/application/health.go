@@ -0,0 +1,235 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/queue"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+)
+
+const (
+	healthOK          = "ok"
+	healthDegraded    = "degraded"
+	healthUnavailable = "unavailable"
+)
+
+// healthCheck probes one dependency. Only a failing critical check turns the
+// probe into a 503; the others report the probe as degraded.
+type healthCheck struct {
+	critical bool
+	check    func(ctx context.Context) error
+	// details is reported next to the result, e.g. connection pool stats.
+	details func() any
+}
+
+// probes are the checks behind /livez and /readyz. Liveness covers the
+// process itself and should only fail when a restart helps; readiness covers
+// the dependencies the role needs to do its work.
+type probes struct {
+	live  map[string]healthCheck
+	ready map[string]healthCheck
+}
+
+func newProbes() probes {
+	return probes{live: map[string]healthCheck{}, ready: map[string]healthCheck{}}
+}
+
+type checkResult struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	Details   any     `json:"details,omitempty"`
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// healthHandler runs every check concurrently on each request and answers 503
+// when a critical one fails.
+func healthHandler(checks map[string]healthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		resp := healthResponse{Status: healthOK, Checks: make(map[string]checkResult, len(checks))}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for name, hc := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result := runCheck(ctx, hc)
+				mu.Lock()
+				resp.Checks[name] = result
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		for _, result := range resp.Checks {
+			if result.Status == healthOK {
+				continue
+			}
+			if result.Critical {
+				resp.Status = healthUnavailable
+				status = http.StatusServiceUnavailable
+			} else if resp.Status == healthOK {
+				resp.Status = healthDegraded
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+func runCheck(ctx context.Context, hc healthCheck) checkResult {
+	started := time.Now()
+	err := hc.check(ctx)
+	result := checkResult{
+		Status:    healthOK,
+		Critical:  hc.critical,
+		LatencyMs: float64(time.Since(started).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = healthUnavailable
+		result.Error = err.Error()
+	}
+	if hc.details != nil {
+		result.Details = hc.details()
+	}
+	return result
+}
+
+// startHealthServer serves the probes and GET /metrics on an internal port,
+// away from the public API. GET /health is kept as an alias of /readyz.
+func startHealthServer(logger domain.LoggingRepository, port int, p probes) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /livez", healthHandler(p.live))
+	mux.Handle("GET /readyz", healthHandler(p.ready))
+	mux.Handle("GET /health", healthHandler(p.ready))
+	mux.Handle("GET /metrics", observability.MetricsHandler())
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to start the health server", "reason", err.Error())
+		}
+	}()
+	return server
+}
+
+func stopHealthServer(logger domain.LoggingRepository, server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("health server closed with error", "reason", err.Error())
+	}
+}
+
+// connectionChecks pings the connections every role depends on.
+func connectionChecks(d *deps) map[string]healthCheck {
+	return map[string]healthCheck{
+		"postgres": {
+			critical: true,
+			check:    d.db.Ping,
+			details: func() any {
+				stat := d.db.Stat()
+				return map[string]int64{
+					"total_conns":    int64(stat.TotalConns()),
+					"idle_conns":     int64(stat.IdleConns()),
+					"acquired_conns": int64(stat.AcquiredConns()),
+					"max_conns":      int64(stat.MaxConns()),
+					"empty_acquires": stat.EmptyAcquireCount(),
+				}
+			},
+		},
+		"redis": {
+			critical: true,
+			check: func(ctx context.Context) error {
+				return d.redis.Ping(ctx).Err()
+			},
+		},
+	}
+}
+
+// smtpCheck only opens a TCP connection to the SMTP server, so probes do not
+// authenticate on every request.
+func smtpCheck(host string, port int, critical bool) healthCheck {
+	return healthCheck{
+		critical: critical,
+		check: func(ctx context.Context) error {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+	}
+}
+
+// consumerGroupCheck fails when group is gone from stream, which happens when
+// the stream key is deleted while the workers keep running.
+func consumerGroupCheck(checker domain.ConsumerGroupChecker, stream, group string) healthCheck {
+	return healthCheck{
+		critical: true,
+		check: func(ctx context.Context) error {
+			exists, err := checker.ConsumerGroupExists(ctx, stream, group)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("consumer group %s does not exist on %s", group, stream)
+			}
+			return nil
+		},
+	}
+}
+
+// workerHeartbeatCheck fails when the pool has no worker or one of them has
+// not gone around its loop within maxAge.
+func workerHeartbeatCheck(pool *queue.WorkerPool, maxAge time.Duration) healthCheck {
+	return healthCheck{
+		critical: true,
+		check: func(ctx context.Context) error {
+			heartbeats := pool.Heartbeats()
+			if len(heartbeats) == 0 {
+				return fmt.Errorf("no %s worker is running", pool.Stream)
+			}
+			for id, beat := range heartbeats {
+				if age := time.Since(beat); age > maxAge {
+					return fmt.Errorf("%s worker %d has not reported for %s", pool.Stream, id, age.Round(time.Second))
+				}
+			}
+			return nil
+		},
+		details: func() any {
+			ages := make(map[string]float64)
+			for id, beat := range pool.Heartbeats() {
+				ages[strconv.Itoa(id)] = time.Since(beat).Round(time.Millisecond).Seconds()
+			}
+			return map[string]any{"heartbeat_age_seconds": ages}
+		},
+	}
+}
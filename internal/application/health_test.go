@@ -0,0 +1,115 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/queue"
+)
+
+func serveHealth(t *testing.T, checks map[string]healthCheck) (int, healthResponse) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	healthHandler(checks).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var resp healthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, resp
+}
+
+func passing(ctx context.Context) error { return nil }
+
+func TestHealthHandlerReportsFailingChecks(t *testing.T) {
+	code, resp := serveHealth(t, map[string]healthCheck{
+		"postgres": {critical: true, check: passing},
+		"redis":    {critical: true, check: func(ctx context.Context) error { return errors.New("connection refused") }},
+	})
+
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if resp.Status != healthUnavailable {
+		t.Errorf("status = %s, want %s", resp.Status, healthUnavailable)
+	}
+	if resp.Checks["postgres"].Status != healthOK || resp.Checks["redis"].Error != "connection refused" {
+		t.Errorf("checks = %v", resp.Checks)
+	}
+}
+
+func TestHealthHandlerDegradesOnNonCriticalCheck(t *testing.T) {
+	code, resp := serveHealth(t, map[string]healthCheck{
+		"postgres": {critical: true, check: passing, details: func() any { return map[string]int{"idle_conns": 2} }},
+		"smtp":     {check: func(ctx context.Context) error { return errors.New("i/o timeout") }},
+	})
+
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if resp.Status != healthDegraded {
+		t.Errorf("status = %s, want %s", resp.Status, healthDegraded)
+	}
+	if resp.Checks["smtp"].Status != healthUnavailable || resp.Checks["smtp"].Critical {
+		t.Errorf("smtp check = %+v", resp.Checks["smtp"])
+	}
+	if resp.Checks["postgres"].Details == nil {
+		t.Errorf("postgres check has no details")
+	}
+}
+
+func TestWorkerHeartbeatCheckReportsStuckWorker(t *testing.T) {
+	pool := queue.NewWorkerPool(context.Background(), 1, nopLogger{}, blockingTask{}, nil, nil, "story", "story_workers", 1, nil)
+	pool.Resize(1)
+	t.Cleanup(func() {
+		pool.Cancel()
+		pool.Wait()
+	})
+
+	check := workerHeartbeatCheck(pool, time.Hour)
+	if err := check.check(context.Background()); err != nil {
+		t.Fatalf("fresh worker reported as stuck: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	check = workerHeartbeatCheck(pool, 10*time.Millisecond)
+	if err := check.check(context.Background()); err == nil {
+		t.Fatal("worker blocked in read was not reported")
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+func (l nopLogger) With(args ...interface{}) domain.LoggingRepository {
+	return l
+}
+
+// blockingTask never returns from Read until the pool is canceled, like a
+// worker stuck on a job.
+type blockingTask struct {
+	domain.StreamTaskHandler
+}
+
+func (blockingTask) Read(ctx context.Context, consumerId int, streams []string, block bool) (domain.Message, string, error) {
+	<-ctx.Done()
+	return domain.Message{}, "", ctx.Err()
+}
+
+func TestLogFilePerCommand(t *testing.T) {
+	if got := logFile("logs/app.log", "worker"); got != "logs/app.worker.log" {
+		t.Errorf("worker log file = %s", got)
+	}
+	if got := logFile("logs/app.log", "all"); got != "logs/app.log" {
+		t.Errorf("all log file = %s", got)
+	}
+}
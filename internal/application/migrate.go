@@ -0,0 +1,30 @@
+package application
+
+import (
+	"context"
+
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/postgres"
+	"github.com/KianoushAmirpour/notification_server/migrations"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+)
+
+// Migrate runs a goose command (up, down, status, version, ...) against the
+// embedded migrations. It only needs the database, so it can run as a job
+// before the other commands start.
+func (a App) Migrate(command string, args ...string) error {
+	dbPool, err := postgres.OpenDatabaseConnPool(a.Cfg.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer dbPool.Close()
+
+	db := stdlib.OpenDBFromPool(dbPool)
+	defer db.Close()
+
+	goose.SetBaseFS(migrations.FS)
+	if err := goose.SetDialect("postgres"); err != nil {
+		return err
+	}
+	return goose.RunContext(context.Background(), command, db, ".", args...)
+}
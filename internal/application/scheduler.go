@@ -0,0 +1,61 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/queue"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/postgres"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/redis"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+)
+
+// schedulers runs the loops that move jobs into the streams: the retry
+// schedulers, the outbox relay and the story schedule runner, next to the
+// account purger and the registration janitor. It serves the probes on SCHEDULER_HEALTH_PORT.
+func (a App) schedulers(rootctx context.Context, d *deps) role {
+	logger := d.logger
+
+	schedulerStoryConsumer := queue.NewShedulerWorkerPool(rootctx, a.Cfg.SchedulerWorkerCounts, logger, a.Cfg.StoryRetryStream, d.storyTask, d.storyTask, a.Cfg.StoryGenerationStream)
+	schedulerStoryConsumer.Start()
+	schedulerEmailConsumer := queue.NewShedulerWorkerPool(rootctx, a.Cfg.SchedulerWorkerCounts, logger, a.Cfg.EmailRetryStream, d.emailTask, d.emailTask, a.Cfg.EmailNotificationStream)
+	schedulerEmailConsumer.Start()
+
+	outboxRelay := queue.NewOutboxRelay(rootctx, logger, postgres.NewOutboxRepo(d.db), d.storyTask, a.Cfg.OutboxBatchSize,
+		time.Duration(a.Cfg.OutboxPollInterval)*time.Second, time.Duration(a.Cfg.OutboxLeaseTimeout)*time.Second)
+	outboxRelay.Start()
+
+	scheduleRunner := queue.NewScheduleRunner(rootctx, logger, redis.NewLock(d.redis), a.scheduleService(d), a.Cfg.ScheduleLockKey,
+		time.Duration(a.Cfg.SchedulePollInterval)*time.Second, time.Duration(a.Cfg.ScheduleLockTTL)*time.Second)
+	scheduleRunner.Start()
+
+	accountPurger := queue.NewAccountPurger(rootctx, logger, a.accountDataService(d), time.Duration(a.Cfg.AccountPurgeInterval)*time.Second)
+	accountPurger.Start()
+
+	registrationJanitor := queue.NewRegistrationJanitor(rootctx, logger,
+		usecase.NewRegistrationCleanupService(postgres.NewUserVerificationRepo(d.db), logger, time.Duration(a.Cfg.RegistrationMaxAge)*time.Second),
+		time.Duration(a.Cfg.RegistrationCleanupInterval)*time.Second)
+	registrationJanitor.Start()
+
+	p := newProbes()
+	p.ready = connectionChecks(d)
+	healthServer := startHealthServer(logger, a.Cfg.SchedulerHealthPort, p)
+
+	return role{name: "schedulers", stop: func() {
+		stopHealthServer(logger, healthServer)
+
+		registrationJanitor.Cancel()
+		accountPurger.Cancel()
+		scheduleRunner.Cancel()
+		outboxRelay.Cancel()
+		schedulerStoryConsumer.Cancel()
+		schedulerEmailConsumer.Cancel()
+
+		registrationJanitor.Wait()
+		accountPurger.Wait()
+		scheduleRunner.Wait()
+		outboxRelay.Wait()
+		schedulerStoryConsumer.Wait()
+		schedulerEmailConsumer.Wait()
+	}}
+}
@@ -0,0 +1,185 @@
+package application
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	router "github.com/KianoushAmirpour/notification_server/internal/adapters/http"
+	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/handler"
+	"github.com/KianoushAmirpour/notification_server/internal/adapters/http/middleware"
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/notification"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/oidc"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/postgres"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/redis"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/security"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+)
+
+// api serves the HTTP routes and the probes of the API on SERVER_PORT. The
+// probes and GET /metrics are also served on API_HEALTH_PORT, which is not
+// meant to be exposed publicly.
+func (a App) api(rootctx context.Context, d *deps) role {
+	logger := d.logger
+
+	bcryptPasswordHasher := security.Hasher{Cost: a.Cfg.BcryptCost}
+
+	otpService := redis.NewRedisClient(d.redis, bcryptPasswordHasher)
+
+	mailer := notification.Mailer{
+		Host:      a.Cfg.SmtpHost,
+		Port:      a.Cfg.SmtpPort,
+		Username:  a.Cfg.SmtpUsername,
+		Password:  a.Cfg.SmtpPassword,
+		FromEmail: a.Cfg.FromEmail,
+		Logger:    logger}
+
+	// iplimiter := middleware.NewIpLimiter()
+	redisRateLimier := middleware.NewRedisRateLimiter(d.redis, a.Cfg.RataLimitCapacity, a.Cfg.RataLimitFillRate, time.Hour)
+
+	UserVerificationRepo := postgres.NewUserVerificationRepo(d.db)
+	RefreshTokenRepo := postgres.NewRefreshTokenRepo(d.db)
+	auditRepo := postgres.NewAuditRepo(d.db)
+
+	otpgenerator := security.Otpgen{OTPLength: a.Cfg.OTPLength}
+	tokengenerator := security.RandomToken{Size: 32}
+
+	jwttoken := a.jwtAuth(d)
+
+	mfaSvc := a.mfaService(d, bcryptPasswordHasher, otpService, tokengenerator, auditRepo)
+
+	userRegisterSvc := usecase.NewUserRegisterService(d.userRepo, UserVerificationRepo, bcryptPasswordHasher, mailer, otpService, otpgenerator, tokengenerator, jwttoken, RefreshTokenRepo, mfaSvc, auditRepo, logger)
+
+	h := handler.NewUserHandler(userRegisterSvc, a.storyScheduler(d), redisRateLimier, jwttoken, logger,
+		a.Cfg.OTPExpiration, time.Duration(a.Cfg.VerificationResendCooldown)*time.Second, a.Cfg.JwtISS, a.Cfg.RataLimitCapacity, a.Cfg.RataLimitFillRate,
+		a.Cfg.MaxAllowedSize)
+
+	sh := handler.NewScheduleHandler(a.scheduleService(d), logger)
+	gracePeriod := time.Duration(a.Cfg.AccountDeletionGraceDays) * 24 * time.Hour
+	acch := handler.NewAccountHandler(userRegisterSvc, a.accountDataService(d), gracePeriod,
+		a.Cfg.OTPExpiration, time.Duration(a.Cfg.VerificationResendCooldown)*time.Second, logger)
+	ph := handler.NewProfileHandler(usecase.NewProfileService(d.userRepo, logger), logger)
+	mlh := handler.NewMagicLinkHandler(userRegisterSvc, a.Cfg.MagicLinkURL, a.Cfg.MagicLinkExpiration, time.Duration(a.Cfg.MagicLinkCooldown)*time.Second, logger)
+	var mfah *handler.MFAHandler
+	if mfaSvc != nil {
+		mfah = handler.NewMFAHandler(mfaSvc, userRegisterSvc, logger)
+	}
+	oidch := handler.NewOIDCHandler(usecase.NewOIDCService(a.identityProvider(), otpService, postgres.NewIdentityRepo(d.db), d.userRepo,
+		tokengenerator, userRegisterSvc, time.Duration(a.Cfg.OIDCStateTTL)*time.Second, a.Cfg.OIDCTrustEmails, auditRepo, logger), logger)
+	ah := handler.NewAdminHandler(usecase.NewAuditService(auditRepo, logger), usecase.NewAdminService(d.userRepo, auditRepo, logger), logger)
+
+	p := newProbes()
+	p.ready = connectionChecks(d)
+	// registration still works without SMTP, only the verification email is lost
+	p.ready["smtp"] = smtpCheck(a.Cfg.SmtpHost, a.Cfg.SmtpPort, false)
+
+	routerCfg := router.RouterConfig{
+		UserHandler:     h,
+		ScheduleHandler: sh,
+		AdminHandler:    ah,
+		AccountHandler:  acch,
+		ProfileHandler:  ph,
+		MagicLink:       mlh,
+		MFAHandler:      mfah,
+		OIDCHandler:     oidch,
+		JWKSHandler:     handler.NewJWKSHandler(jwttoken),
+		Users:           d.userRepo,
+		Liveness:        healthHandler(p.live),
+		Readiness:       healthHandler(p.ready),
+	}
+
+	g := router.SetupRoutes(routerCfg)
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", a.Cfg.ServerPort),
+		Handler: g,
+	}
+
+	healthServer := startHealthServer(logger, a.Cfg.APIHealthPort, p)
+
+	go func() {
+		serverErr := server.ListenAndServe()
+		if serverErr != nil && !errors.Is(serverErr, http.ErrServerClosed) {
+			logger.Error("failed to start the server", "reason", serverErr.Error())
+		}
+		logger.Info("successfully start the server")
+	}()
+
+	return role{name: "api", stop: func() {
+		stopHealthServer(logger, healthServer)
+
+		shutdownctx, shutdowncancelFunc := context.WithTimeout(context.Background(), time.Duration(a.Cfg.ServerShutdownTimeout)*time.Second)
+		defer shutdowncancelFunc()
+		if err := server.Shutdown(shutdownctx); err != nil {
+			logger.Error("server closed with error", "reason", err.Error())
+		}
+	}}
+}
+
+// mfaService returns nil, turning MFA off, while MFA_ENCRYPTION_KEY is unset.
+func (a App) mfaService(d *deps, hasher security.Hasher, challenges domain.OTPService, tokens domain.TokenGenerator, audit domain.AuditRepository) *usecase.MFAService {
+	if a.Cfg.MFAEncryptionKey == "" {
+		d.logger.Info("mfa disabled, MFA_ENCRYPTION_KEY is not set")
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(a.Cfg.MFAEncryptionKey)
+	if err != nil {
+		d.logger.Error("invalid mfa encryption key", "reason", err.Error())
+		panic(err)
+	}
+	cipher, err := security.NewAESCipher(key)
+	if err != nil {
+		d.logger.Error("invalid mfa encryption key", "reason", err.Error())
+		panic(err)
+	}
+	return usecase.NewMFAService(d.userRepo, postgres.NewMFARepo(d.db), security.TOTP{Issuer: a.Cfg.MFAIssuer}, cipher, hasher,
+		challenges, tokens, security.RandomToken{Size: 8}, a.Cfg.MFAChallengeExpiration, audit, d.logger)
+}
+
+// identityProvider is nil, turning single sign-on off, while no issuer is
+// configured.
+func (a App) identityProvider() domain.IdentityProvider {
+	if a.Cfg.OIDCIssuer == "" {
+		return nil
+	}
+	return oidc.NewProvider(a.Cfg.OIDCProviderName, a.Cfg.OIDCIssuer, a.Cfg.OIDCClientID, a.Cfg.OIDCClientSecret, a.Cfg.OIDCRedirectURL,
+		strings.Fields(a.Cfg.OIDCScopes), &http.Client{Timeout: 10 * time.Second})
+}
+
+// jwtAuth signs access tokens with JWT_SIGNING_KEY_FILE when set, otherwise
+// with the JWT_ACCESS_SECRET shared secret. With a signing key the secret
+// still verifies older tokens until JWT_LEGACY_SECRET_UNTIL. That is a fixed
+// time, so restarting the server does not extend it.
+func (a App) jwtAuth(d *deps) security.JwtAuth {
+	auth := security.JwtAuth{AccessSecret: []byte(a.Cfg.JwtAccessSecret), RefreshSecret: []byte(a.Cfg.JwtRefreshSecret), Issuer: a.Cfg.JwtISS}
+	if a.Cfg.JwtSigningKeyFile == "" {
+		return auth
+	}
+
+	var verificationKeyFiles []string
+	for _, file := range strings.Split(a.Cfg.JwtVerificationKeyFiles, ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			verificationKeyFiles = append(verificationKeyFiles, file)
+		}
+	}
+	signingKey, verificationKeys, err := security.LoadSigningKeys(a.Cfg.JwtSigningKeyFile, verificationKeyFiles)
+	if err != nil {
+		d.logger.Error("failed to load jwt keys", "reason", err.Error())
+		panic(err)
+	}
+	auth.SigningKey, auth.VerificationKeys = signingKey, verificationKeys
+	if a.Cfg.JwtLegacySecretUntil != "" {
+		until, err := time.Parse(time.RFC3339, a.Cfg.JwtLegacySecretUntil)
+		if err != nil {
+			d.logger.Error("invalid JWT_LEGACY_SECRET_UNTIL", "reason", err.Error())
+			panic(err)
+		}
+		auth.LegacySecretUntil = until
+	}
+	return auth
+}
@@ -0,0 +1,133 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/ai"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/notification"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/queue"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+)
+
+// workers runs a worker pool and its autoscaler for each stream, and serves
+// the probes on WORKER_HEALTH_PORT.
+func (a App) workers(streams ...string) roleBuilder {
+	return func(rootctx context.Context, d *deps) role {
+		logger := d.logger
+
+		lanes := []domain.PriorityLane{
+			{Priority: domain.PriorityHigh, Weight: a.Cfg.PriorityHighWeight},
+			{Priority: domain.PriorityNormal, Weight: a.Cfg.PriorityNormalWeight},
+		}
+
+		pools := make(map[string]*queue.WorkerPool, len(streams))
+		var autoscalers []*queue.Autoscaler
+		p := newProbes()
+		p.ready = connectionChecks(d)
+		heartbeatTimeout := time.Duration(a.Cfg.WorkerHeartbeatTimeout) * time.Second
+
+		for _, stream := range streams {
+			var pool *queue.WorkerPool
+			var task taskStream
+			switch stream {
+			case StoryStream:
+				pool, task = a.storyWorkerPool(rootctx, d, lanes), d.storyTask
+			case EmailStream:
+				pool, task = a.emailWorkerPool(rootctx, d, lanes), d.emailTask
+				p.ready["smtp"] = smtpCheck(a.Cfg.SmtpHost, a.Cfg.SmtpPort, true)
+			}
+			pool.Start()
+
+			autoscaler := queue.NewAutoscaler(rootctx, logger, pool, task, a.Cfg.MinWorkerCounts, a.Cfg.MaxWorkerCounts,
+				a.Cfg.AutoscaleJobsPerWorker, time.Duration(a.Cfg.AutoscaleInterval)*time.Second)
+			autoscaler.Start()
+
+			pools[stream] = pool
+			autoscalers = append(autoscalers, autoscaler)
+			p.live[fmt.Sprintf("%s_workers", stream)] = workerHeartbeatCheck(pool, heartbeatTimeout)
+			for _, laneStream := range pool.Streams() {
+				p.ready[fmt.Sprintf("%s_group", laneStream)] = consumerGroupCheck(task, laneStream, pool.ConsumerGroup)
+			}
+		}
+
+		healthServer := startHealthServer(logger, a.Cfg.WorkerHealthPort, p)
+
+		return role{name: "workers", stop: func() {
+			stopHealthServer(logger, healthServer)
+
+			// nothing may resize the pools while they drain
+			for _, autoscaler := range autoscalers {
+				autoscaler.Cancel()
+			}
+			for _, autoscaler := range autoscalers {
+				autoscaler.Wait()
+			}
+
+			// workers stop reading and finish their current job; whatever is
+			// still running at the deadline stays unacked and is claimed after
+			// a restart
+			drainctx, draincancelFunc := context.WithTimeout(context.Background(), time.Duration(a.Cfg.WorkerShutdownTimeout)*time.Second)
+			defer draincancelFunc()
+			var drainWg sync.WaitGroup
+			for name, pool := range pools {
+				drainWg.Add(1)
+				go func() {
+					defer drainWg.Done()
+					if err := pool.Shutdown(drainctx); err != nil {
+						logger.Warn(fmt.Sprintf("%s workers did not drain in time, unfinished jobs left for redelivery", name), "reason", err.Error())
+					}
+				}()
+			}
+			drainWg.Wait()
+		}}
+	}
+}
+
+func (a App) storyWorkerPool(rootctx context.Context, d *deps, lanes []domain.PriorityLane) *queue.WorkerPool {
+	gemeniClient, err := ai.NewGemeniClient(rootctx, a.Cfg.GeminiAPI, a.Cfg.GeminiModel)
+	if err != nil {
+		d.logger.Error("failed to create gemeni client", "reason", err.Error())
+		panic(err)
+	}
+
+	storyJobExecuter := usecase.NewStoryGenerationService(
+		d.userRepo,
+		d.storyRepo,
+		gemeniClient,
+		d.logger)
+	storyJobCompletionHandler := usecase.NewStoryGenerationJobCompletion(
+		d.storyRepo,
+		d.storyTask,
+		a.Cfg.StoryGenerationStream,
+		a.Cfg.EmailNotificationStream,
+		a.Cfg.StoryDLQStream,
+		d.logger)
+
+	return queue.NewWorkerPool(rootctx, a.Cfg.WorkerCounts, d.logger, d.storyTask,
+		storyJobExecuter, storyJobCompletionHandler, a.Cfg.StoryGenerationStream, a.Cfg.StoryConsumerGroup, a.Cfg.JobRetryCount, lanes)
+}
+
+func (a App) emailWorkerPool(rootctx context.Context, d *deps, lanes []domain.PriorityLane) *queue.WorkerPool {
+	mailer := notification.Mailer{
+		Host:      a.Cfg.SmtpHost,
+		Port:      a.Cfg.SmtpPort,
+		Username:  a.Cfg.SmtpUsername,
+		Password:  a.Cfg.SmtpPassword,
+		FromEmail: a.Cfg.FromEmail,
+		Logger:    d.logger}
+
+	emailJobExecuter := usecase.NewEmailSenderService(d.userRepo, mailer, d.logger)
+	emailJobCompletionHandler := usecase.NewEmailNotificationJobCompletion(
+		d.storyRepo,
+		d.emailTask,
+		a.Cfg.EmailNotificationStream,
+		a.Cfg.EmailDLQStream,
+		d.logger)
+
+	return queue.NewWorkerPool(rootctx, a.Cfg.WorkerCounts, d.logger, d.emailTask, emailJobExecuter, emailJobCompletionHandler,
+		a.Cfg.EmailNotificationStream, a.Cfg.EmailConsumerGroup, a.Cfg.JobRetryCount, lanes)
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// UserExport is everything stored about a user, handed out on request.
+type UserExport struct {
+	Profile     ExportedProfile
+	Preferences []string
+	Stories     []ExportedStory
+	StoryJobs   []ExportedJob
+	EmailJobs   []ExportedJob
+	Schedules   []StorySchedule
+	ExportedAt  time.Time
+}
+
+type ExportedProfile struct {
+	ID        int
+	FirstName string
+	LastName  string
+	Email     string
+	Plan      string
+	Role      string
+	CreatedAt time.Time
+}
+
+type ExportedStory struct {
+	ID        int
+	FileName  string
+	Story     string
+	CreatedAt time.Time
+}
+
+type ExportedJob struct {
+	ID      int
+	StoryID int
+	Status  string
+}
+
+type AccountDataRepository interface {
+	ExportUserData(ctx context.Context, userID int) (*UserExport, error)
+	// PurgeDeletedUsers removes up to limit users soft-deleted before
+	// deletedBefore, with everything that references them, and returns
+	// their IDs.
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) ([]int, error)
+}
+
+type AccountPurgeExecuter interface {
+	PurgeDeletedAccounts(ctx context.Context, now time.Time) error
+}
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Audit event types. They are stored as is, so only add new ones. Whether the
+// action succeeded is recorded in the outcome.
+const (
+	AuditUserRegistration   string = "user.registration"
+	AuditUserVerification   string = "user.verification"
+	AuditVerificationResend string = "user.verification_resend"
+	AuditLogin              string = "auth.login"
+	AuditMagicLinkRequest   string = "auth.magic_link_request"
+	AuditTokenRefresh       string = "auth.token_refresh"
+	AuditUserDeletion       string = "user.deletion"
+	AuditUserRestoration    string = "user.restoration"
+	AuditUserPurge          string = "user.purge"
+	AuditUserDataExport     string = "user.data_export"
+	AuditEmailChange        string = "user.email_change"
+	AuditMFAEnrollment      string = "user.mfa_enrollment"
+	AuditAuditLogQuery      string = "admin.audit_log_query"
+	AuditRoleChange         string = "admin.role_change"
+)
+
+const (
+	AuditOutcomeSuccess string = "success"
+	AuditOutcomeFailure string = "failure"
+)
+
+// AuditEvent records who did what. ActorID is the authenticated caller, nil
+// for anonymous requests such as a login; UserID is the account the event is
+// about. Neither references users, so events outlive deleted accounts.
+type AuditEvent struct {
+	ID        int64
+	EventType string
+	Outcome   string
+	ActorID   *int
+	UserID    *int
+	RequestID string
+	ClientIP  string
+	Metadata  map[string]string
+	CreatedAt time.Time
+}
+
+// AuditFilter selects events newest first. BeforeID is the keyset cursor: the
+// ID of the last event of the previous page, 0 for the first page.
+type AuditFilter struct {
+	UserID    *int
+	EventType string
+	From      time.Time
+	To        time.Time
+	BeforeID  int64
+	Limit     int
+}
+
+// AuditRepository is append-only: events are never updated or deleted.
+type AuditRepository interface {
+	RecordAuditEvent(ctx context.Context, e AuditEvent) error
+	ListAuditEvents(ctx context.Context, f AuditFilter) ([]AuditEvent, error)
+}
@@ -13,6 +13,9 @@ type TokenPair struct {
 type IdentityToken struct {
 	UserID int
 	Email  string
+	// Role is only carried by access tokens; refresh reads it from the users
+	// table so a role change applies from the next refresh on.
+	Role string
 }
 
 type RefreshToken struct {
@@ -25,13 +28,34 @@ type RefreshToken struct {
 }
 
 type JwtTokenRepository interface {
-	CreateJWTToken(id int, email string) (*TokenPair, error)
-	VerifyJWTToken(tokenString string, secretKey []byte) (*IdentityToken, error)
-	VerifyRefreshToken(tokenString string, secretKey []byte) (*IdentityToken, error)
+	CreateJWTToken(id int, email string, role string) (*TokenPair, error)
+	VerifyJWTToken(tokenString string) (*IdentityToken, error)
+	VerifyRefreshToken(tokenString string) (*IdentityToken, error)
 }
 
 type RefreshTokenRepository interface {
 	StoreRefreshToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
 	RetrieveRefreshToken(ctx context.Context, userID int) (*RefreshToken, error)
 	UpdateRefreshToken(ctx context.Context, userID int, revokedAt time.Time) error
+	// RevokeUserRefreshTokens revokes every refresh token of the user that
+	// is not revoked yet.
+	RevokeUserRefreshTokens(ctx context.Context, userID int, revokedAt time.Time) error
+}
+
+// JSONWebKey is a public verification key as published on the JWKS endpoint.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type KeySetProvider interface {
+	// PublicKeys lists the keys access tokens are verified with; empty while
+	// tokens are signed with a shared secret.
+	PublicKeys() ([]JSONWebKey, error)
 }
@@ -1,6 +1,13 @@
 package domain
 
+import "context"
+
 type Mailer interface {
-	SendVerificationEmail(email string, otp string) error
-	SendNotificationEmail(email string) error
+	SendVerificationEmail(ctx context.Context, email string, otp string) error
+	SendNotificationEmail(ctx context.Context, email string) error
+	SendAccountDeletionEmail(ctx context.Context, email string, otp string) error
+	SendAccountRestorationEmail(ctx context.Context, email string, otp string) error
+	SendEmailChangeEmail(ctx context.Context, email string, otp string) error
+	SendEmailChangedEmail(ctx context.Context, oldEmail string, newEmail string) error
+	SendMagicLinkEmail(ctx context.Context, email string, link string) error
 }
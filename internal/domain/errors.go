@@ -14,6 +14,7 @@ const (
 	ErrCodeExternal     string = "EXTERNAL_SERVICE_ERROR"
 	ErrCodeRateLimited  string = "RATE_LIMITED"
 	ErrCodePersisting   string = "PERSIST_IN_DATABASE"
+	ErrCodePrecondition string = "PRECONDITION_FAILED"
 )
 
 type DomainError struct {
@@ -43,6 +44,8 @@ var (
 	ErrInvalidOtp              = &DomainError{Code: ErrCodeValidation, Message: "invalid otp", Cause: nil}
 	ErrInvalidCredentials      = &DomainError{Code: ErrCodeUnauthorized, Message: "invalid credentials", Cause: nil}
 	ErrUserNotFound            = &DomainError{Code: ErrCodeNotFound, Message: "user not found", Cause: nil}
+	ErrInvalidRole             = &DomainError{Code: ErrCodeValidation, Message: "invalid role", Cause: nil}
+	ErrOwnRoleChange           = &DomainError{Code: ErrCodeForbidden, Message: "admins cannot change their own role", Cause: nil}
 	ErrEmailNotFound           = &DomainError{Code: ErrCodeNotFound, Message: "email not found", Cause: nil}
 	ErrDbConnection            = &DomainError{Code: ErrCodeInternal, Message: "db connectin failed", Cause: nil}
 	ErrPersistUser             = &DomainError{Code: ErrCodePersisting, Message: "persisting user failed", Cause: nil}
@@ -50,7 +53,7 @@ var (
 	ErrUnableToDeleteUser      = &DomainError{Code: ErrCodeInternal, Message: "unable to delete user from database", Cause: nil}
 	ErrPersistStory            = &DomainError{Code: ErrCodePersisting, Message: "persisting story failed", Cause: nil}
 	ErrPersistOtp              = &DomainError{Code: ErrCodePersisting, Message: "failed to save otp", Cause: nil}
-	ErrRequestIDNotFound       = &DomainError{Code: ErrCodeNotFound, Message: "request id not found", Cause: nil}
+	ErrVerificationNotFound    = &DomainError{Code: ErrCodeNotFound, Message: "verification not found or expired", Cause: nil}
 	ErrOtpKeyNotFound          = &DomainError{Code: ErrCodeNotFound, Message: "key not found", Cause: nil}
 	ErrTypeConvertion          = &DomainError{Code: ErrCodeValidation, Message: "failed to convert the type", Cause: nil}
 	ErrFailedIncrementOtpRetry = &DomainError{Code: ErrCodeInternal, Message: "failed to increment the retry attempts", Cause: nil}
@@ -58,5 +61,34 @@ var (
 	ErrInvalidJWTMethod        = &DomainError{Code: ErrCodeUnauthorized, Message: "invalid jwt method", Cause: nil}
 	ErrPersistRefreshToken     = &DomainError{Code: ErrCodePersisting, Message: "persisting refresh token failed", Cause: nil}
 	ErrStoryNotFound           = &DomainError{Code: ErrCodeNotFound, Message: "story not found", Cause: nil}
-	ErrNoMessageFound          = &DomainError{Code: ErrCodeNotFound, Message: "no message found in retry queue", Cause: nil}
+	ErrNoMessageFound          = &DomainError{Code: ErrCodeNotFound, Message: "no message found", Cause: nil}
+	ErrDeletionGraceExpired    = &DomainError{Code: ErrCodeNotFound, Message: "account can no longer be restored", Cause: nil}
+	ErrDeletedByAdmin          = &DomainError{Code: ErrCodeForbidden, Message: "account was deleted by an admin and cannot be restored", Cause: nil}
+	ErrStaleVersion            = &DomainError{Code: ErrCodePrecondition, Message: "resource was modified, fetch it again and retry", Cause: nil}
+	ErrNothingToUpdate         = &DomainError{Code: ErrCodeValidation, Message: "nothing to update", Cause: nil}
+	ErrRegistrationPending     = &DomainError{Code: ErrCodeConflict, Message: "registration is waiting for verification, ask for a new code instead", Cause: nil}
+	ErrResendCooldown          = &DomainError{Code: ErrCodeRateLimited, Message: "a code was sent recently, wait before asking for another", Cause: nil}
+	ErrEmailTaken              = &DomainError{Code: ErrCodeConflict, Message: "email already exists", Cause: nil}
+	ErrSameEmail               = &DomainError{Code: ErrCodeValidation, Message: "new email is the current one", Cause: nil}
+	ErrNoEmailChange           = &DomainError{Code: ErrCodeNotFound, Message: "no email change in progress", Cause: nil}
+	ErrInvalidMagicLink        = &DomainError{Code: ErrCodeUnauthorized, Message: "sign-in link is invalid or expired", Cause: nil}
+	ErrMFANotEnrolled          = &DomainError{Code: ErrCodeNotFound, Message: "two-factor authentication is not set up", Cause: nil}
+	ErrMFAAlreadyEnabled       = &DomainError{Code: ErrCodeConflict, Message: "two-factor authentication is already enabled", Cause: nil}
+	ErrInvalidMFACode          = &DomainError{Code: ErrCodeUnauthorized, Message: "invalid authentication code", Cause: nil}
+	ErrInvalidMFAChallenge     = &DomainError{Code: ErrCodeUnauthorized, Message: "mfa challenge is invalid or expired, log in again", Cause: nil}
+	ErrIdentityNotFound        = &DomainError{Code: ErrCodeNotFound, Message: "external identity is not linked", Cause: nil}
+	ErrIdentityLinked          = &DomainError{Code: ErrCodeConflict, Message: "external identity is already linked", Cause: nil}
+	ErrInvalidOIDCState        = &DomainError{Code: ErrCodeUnauthorized, Message: "login attempt is invalid or expired, start again", Cause: nil}
+	ErrUnverifiedIdentity      = &DomainError{Code: ErrCodeUnauthorized, Message: "provider did not verify the email", Cause: nil}
+	ErrIdentityLinkRequired    = &DomainError{Code: ErrCodeConflict, Message: "an account with this email exists, log in to it and link the provider from there", Cause: nil}
+	ErrOIDCDisabled            = &DomainError{Code: ErrCodeNotFound, Message: "single sign-on is not configured", Cause: nil}
+	ErrAccountPendingDeletion  = &DomainError{Code: ErrCodeConflict, Message: "email belongs to an account pending deletion, restore it instead", Cause: nil}
+	ErrJobCancelled            = &DomainError{Code: ErrCodeNotFound, Message: "job cancelled, its user no longer exists", Cause: nil}
+	ErrPersistOutbox           = &DomainError{Code: ErrCodePersisting, Message: "persisting outbox message failed", Cause: nil}
+	ErrOutboxMessageNotFound   = &DomainError{Code: ErrCodeNotFound, Message: "outbox message not found", Cause: nil}
+	ErrTooManyActiveJobs       = &DomainError{Code: ErrCodeRateLimited, Message: "too many stories in progress, try again once they are ready", Cause: nil}
+	ErrScheduleNotFound        = &DomainError{Code: ErrCodeNotFound, Message: "schedule not found", Cause: nil}
+	ErrPersistSchedule         = &DomainError{Code: ErrCodePersisting, Message: "persisting schedule failed", Cause: nil}
+	ErrInvalidCronExpr         = &DomainError{Code: ErrCodeValidation, Message: "invalid cron expression", Cause: nil}
+	ErrInvalidTimeZone         = &DomainError{Code: ErrCodeValidation, Message: "invalid time zone", Cause: nil}
 )
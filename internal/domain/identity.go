@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ExternalIdentity is what an OpenID provider tells us about a user after
+// the authorization code was exchanged and the ID token verified.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Nonce         string
+}
+
+// OIDCState is kept between redirecting to the provider and its callback.
+// LinkUserID is set when a logged in user links the provider to their account.
+type OIDCState struct {
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	LinkUserID   int    `json:"link_user_id,omitempty"`
+}
+
+type IdentityProvider interface {
+	Name() string
+	AuthCodeURL(ctx context.Context, state string, codeChallenge string, nonce string) (string, error)
+	Exchange(ctx context.Context, code string, codeVerifier string) (*ExternalIdentity, error)
+}
+
+type OIDCStateStore interface {
+	SaveOIDCState(ctx context.Context, state string, s OIDCState, ttl time.Duration) error
+	// TakeOIDCState returns and deletes the state, so every callback can be
+	// used once.
+	TakeOIDCState(ctx context.Context, state string) (*OIDCState, error)
+}
+
+type IdentityRepository interface {
+	GetUserIDByIdentity(ctx context.Context, provider string, subject string) (int, error)
+	LinkIdentity(ctx context.Context, userID int, identity ExternalIdentity) error
+	// CreateUserWithIdentity creates a user without a password, so it can
+	// only log in through the provider.
+	CreateUserWithIdentity(ctx context.Context, identity ExternalIdentity) (int, error)
+}
@@ -2,6 +2,13 @@ package domain
 
 import (
 	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	PriorityHigh   string = "high"
+	PriorityNormal string = "normal"
 )
 
 type Job struct {
@@ -12,6 +19,24 @@ type Job struct {
 	UserPreferences string
 	RetryCounts     int
 	RequestID       string
+	Priority        string
+	// TraceContext carries the W3C trace context of the request that created
+	// the job, so workers continue the same trace.
+	TraceContext map[string]string
+}
+
+type PriorityLane struct {
+	Priority string
+	Weight   int
+}
+
+// PriorityStream returns the stream that holds jobs of the given priority.
+// Normal priority keeps the base stream name so existing streams stay valid.
+func PriorityStream(stream string, priority string) string {
+	if priority == "" || priority == PriorityNormal {
+		return stream
+	}
+	return fmt.Sprintf("%s:%s", stream, priority)
 }
 
 type WorkerPool interface {
@@ -28,13 +53,39 @@ type Message struct {
 type StreamTaskHandler interface {
 	CreateConsumerGroup(ctx context.Context, stream string, group string) error
 	Add(ctx context.Context, job Job, stream string) error
-	Read(ctx context.Context, consumerId int, stream string) (Message, error)
+	// Read returns the first message found on streams, trying them in the
+	// given order, together with the stream it came from. With block set it
+	// waits up to the handler's read block for a message on any of them,
+	// otherwise it returns ErrNoMessageFound straight away.
+	Read(ctx context.Context, consumerId int, streams []string, block bool) (Message, string, error)
 	Ack(ctx context.Context, messageID string, stream string) error
 	ScheduleRetry(ctx context.Context, payload Job, stream string) error
 	ReEnqueue(ctx context.Context, queue string, stream string) error
 	Delete(ctx context.Context, messageID string, stream string) error
 }
 
+// StreamStats is the backlog of one consumer group: Lag counts messages not
+// yet delivered to the group, Pending counts delivered but unacked ones.
+type StreamStats struct {
+	Lag     int64
+	Pending int64
+}
+
+type StreamStatsReader interface {
+	StreamStats(ctx context.Context, stream string, group string) (StreamStats, error)
+	// RetrySetSize counts the retries of stream waiting in queue for their
+	// backoff to pass.
+	RetrySetSize(ctx context.Context, queue string, stream string) (int64, error)
+}
+
+// ConsumerGroupChecker tells readiness probes whether a consumer group can
+// still read its stream, e.g. after the stream was deleted.
+type ConsumerGroupChecker interface {
+	ConsumerGroupExists(ctx context.Context, stream string, group string) (bool, error)
+}
+
+// JobExecuter returns ErrJobCancelled for jobs that must not run anymore, e.g.
+// because their user deleted the account after the job was enqueued.
 type JobExecuter interface {
 	Execute(ctx context.Context, job Job) error
 }
@@ -43,4 +94,21 @@ type JobComplettionHandler interface {
 	OnSuccess(ctx context.Context, job Job, MessageID string) error
 	OnFailure(ctx context.Context, job Job, MessageID string) error
 	SendToDQL(ctx context.Context, job Job, MessageID string) error
+	// OnCancel drops the message without retrying or dead-lettering it.
+	OnCancel(ctx context.Context, job Job, MessageID string) error
+}
+
+type OutboxMessage struct {
+	ID      int
+	Stream  string
+	Payload Job
+}
+
+// OutboxRepository hands out outbox rows written in the same transaction as
+// their job rows. A claimed row is leased for the given duration so a relay
+// that dies before MarkSent lets another relay pick it up again; MarkSent
+// removes the row.
+type OutboxRepository interface {
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkSent(ctx context.Context, id int) error
 }
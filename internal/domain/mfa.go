@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// MFA is a user's TOTP enrollment. Secret is encrypted and RecoveryCodes
+// holds hashes of the unused codes; EnabledAt stays nil until the user proved
+// the authenticator app works. LastTOTPStep is the step of the last accepted
+// code.
+type MFA struct {
+	UserID        int
+	Secret        []byte
+	RecoveryCodes []string
+	EnabledAt     *time.Time
+	LastTOTPStep  *int64
+}
+
+type MFAEnrollment struct {
+	URI           string
+	RecoveryCodes []string
+}
+
+type MFARepository interface {
+	// SaveMFAEnrollment starts or restarts an enrollment; it fails with
+	// ErrMFAAlreadyEnabled once MFA is enabled.
+	SaveMFAEnrollment(ctx context.Context, userID int, secret []byte, recoveryCodes []string) error
+	GetMFA(ctx context.Context, userID int) (*MFA, error)
+	EnableMFA(ctx context.Context, userID int) error
+	// UseRecoveryCode removes codeHash, so every recovery code works once.
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) error
+	// UseTOTPStep records step as the last accepted TOTP step; it fails with
+	// ErrInvalidMFACode unless step is after the one recorded, so every code
+	// works once.
+	UseTOTPStep(ctx context.Context, userID int, step int64) error
+}
+
+type TOTPService interface {
+	GenerateSecret() ([]byte, error)
+	ProvisioningURI(secret []byte, account string) string
+	// Validate reports whether code is valid at the given time and for which
+	// time step, so callers can refuse a code that was already used.
+	Validate(secret []byte, code string, at time.Time) (int64, bool)
+}
+
+// SecretCipher encrypts secrets that have to be read back, unlike passwords.
+type SecretCipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
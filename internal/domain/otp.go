@@ -1,12 +1,24 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type OTPService interface {
 	SaveOTP(ctx context.Context, email string, otp string, expiration int) error
 	VerifyOTP(ctx context.Context, email string, sentopt string) error
+	// ReserveResend starts a cooldown for key and reports false while the
+	// previous one is still running.
+	ReserveResend(ctx context.Context, key string, cooldown time.Duration) (bool, error)
 }
 
 type OTPGenerator interface {
 	GenerateOTP() (string, error)
 }
+
+// TokenGenerator creates opaque url-safe tokens, too long to be guessed like
+// an OTP can be.
+type TokenGenerator interface {
+	GenerateToken() (string, error)
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	MissedRunSkip    string = "skip"
+	MissedRunRunOnce string = "run_once"
+)
+
+type StorySchedule struct {
+	ID              int
+	UserID          int
+	CronExpr        string
+	TimeZone        string
+	MissedRunPolicy string
+	Enabled         bool
+	NextRunAt       time.Time
+	LastRunAt       *time.Time
+}
+
+type ScheduleRepository interface {
+	CreateSchedule(ctx context.Context, s *StorySchedule) (int, error)
+	GetSchedule(ctx context.Context, userID, id int) (*StorySchedule, error)
+	ListSchedules(ctx context.Context, userID int) ([]StorySchedule, error)
+	UpdateSchedule(ctx context.Context, s *StorySchedule) error
+	DeleteSchedule(ctx context.Context, userID, id int) error
+	ListDueSchedules(ctx context.Context, now time.Time, limit int) ([]StorySchedule, error)
+	MarkScheduleRun(ctx context.Context, id int, lastRunAt, nextRunAt time.Time) error
+}
+
+// CronParser computes the next fire time of a cron expression evaluated in
+// the given IANA time zone.
+type CronParser interface {
+	Next(expr string, timeZone string, after time.Time) (time.Time, error)
+}
+
+// LockRepository is a lease-based lock shared by every instance. Only the
+// owner that acquired a key can refresh or release it.
+type LockRepository interface {
+	AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	RefreshLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	ReleaseLock(ctx context.Context, key, owner string) error
+}
+
+type ScheduleExecuter interface {
+	RunDueSchedules(ctx context.Context, now time.Time) error
+}
@@ -11,17 +11,27 @@ type Story struct {
 }
 
 type UploadStory struct {
-	UserID int
-	Story  string
+	StoryID int
+	UserID  int
+	Story   string
+}
+
+type StoryJobStats struct {
+	Active int
+	Total  int
 }
 
 type StoryRepository interface {
 	SaveStoryInfo(ctx context.Context, s *Story) (int, error)
 	UploadStory(ctx context.Context, s *UploadStory) error
 	SaveStoryJob(ctx context.Context, storyID int, status string) (int, error)
+	// ScheduleStoryJob returns ErrTooManyActiveJobs when the user already has
+	// maxActive jobs pending or processing.
+	ScheduleStoryJob(ctx context.Context, s *Story, job Job, stream string, maxActive int) (int, int, error)
 	SaveEmailJob(ctx context.Context, storyID, userID int, status string) (int, error)
 	UpdateStoryJob(ctx context.Context, storyID int, status string) error
 	UpdateEmailJob(ctx context.Context, storyID int, userID int, status string) error
+	GetStoryJobStats(ctx context.Context, userID int) (*StoryJobStats, error)
 }
 
 type GenerateStoryRepository interface {
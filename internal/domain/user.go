@@ -2,17 +2,48 @@ package domain
 
 import (
 	"context"
+	"time"
 )
 
+const (
+	PlanFree    string = "free"
+	PlanPremium string = "premium"
+)
+
+// Roles a user can hold. Every account starts as RoleUser; support staff can
+// look into accounts and admins can also change them.
+const (
+	RoleUser    string = "user"
+	RoleAdmin   string = "admin"
+	RoleSupport string = "support"
+)
+
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin || role == RoleSupport
+}
+
 type User struct {
 	ID          int
 	FirstName   string
 	LastName    string
 	Email       string
 	Password    string
+	Plan        string
+	Role        string
 	Preferences []string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	// DeletedAt is set while a deleted account waits for the purger.
+	DeletedAt *time.Time
+	// DeletedBy says who deleted it, DeletedBySelf or DeletedByAdmin.
+	DeletedBy string
 }
 
+const (
+	DeletedBySelf  string = "self"
+	DeletedByAdmin string = "admin"
+)
+
 type RegisteredUser struct {
 	FirstName   string
 	LastName    string
@@ -25,10 +56,21 @@ type Preferences struct {
 	ID              int
 	UserID          int
 	UserPreferences []string
+	UpdatedAt       time.Time
 }
 
+// ProfileUpdate holds the profile fields to change, nil ones are kept.
+type ProfileUpdate struct {
+	FirstName *string
+	LastName  *string
+}
+
+// RegisterVerify names the registration by the VerificationID returned at
+// registration or, when that is lost, by its Email.
 type RegisterVerify struct {
-	SentOtpbyUser string
+	VerificationID string
+	Email          string
+	SentOtpbyUser  string
 }
 
 type LoginUser struct {
@@ -36,23 +78,73 @@ type LoginUser struct {
 	Password string
 }
 
+// DeleteUser is a self-service deletion, confirmed with either the password
+// or an OTP sent by RequestAccountDeletion.
 type DeleteUser struct {
-	ID int
+	ID       int
+	Password string
+	OTP      string
+}
+
+// RestoreUser asks to restore a deleted account, proven with either its
+// password or an OTP sent by RequestAccountRestoration.
+type RestoreUser struct {
+	Email    string
+	Password string
+	OTP      string
+}
+
+// EmailChange asks to move the account to Email. The password is checked
+// again because the email is what password resets will be sent to.
+type EmailChange struct {
+	UserID   int
+	Email    string
+	Password string
+}
+
+type RegistrationCleanupExecuter interface {
+	CleanupStaleRegistrations(ctx context.Context, now time.Time) error
 }
 
+// UserRepository only sees active users, except for GetDeletedUserByEmail.
+// DeleteUserByID soft-deletes and records deletedBy; the account is
+// restorable until it is purged.
+// The update methods take the updated_at the caller last saw as version; a
+// non-nil version that no longer matches fails with ErrStaleVersion.
 type UserRepository interface {
 	GetUserByID(ctx context.Context, id int) (*User, error)
-	DeleteUserByID(ctx context.Context, id int) error
+	DeleteUserByID(ctx context.Context, id int, deletedBy string) error
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetDeletedUserByEmail(ctx context.Context, email string) (*User, error)
+	RestoreUserByID(ctx context.Context, id int) error
 	GetUserPreferencesByID(ctx context.Context, id int) (*Preferences, error)
+	UpdateUserRole(ctx context.Context, id int, role string) error
+	UpdateUserProfile(ctx context.Context, id int, update ProfileUpdate, version *time.Time) (*User, error)
+	ReplaceUserPreferences(ctx context.Context, userID int, preferences []string, version *time.Time) (*Preferences, error)
 }
 
 type UserVerificationRepository interface {
 	CreateUser(ctx context.Context, u *User) error
-	SaveVerificationData(ctx context.Context, reqid, email string) error
-	RetrieveVerificationData(ctx context.Context, reqid string) (string, error)
+	// SaveVerificationData returns the verification id of the registration.
+	SaveVerificationData(ctx context.Context, email string, expiresAt time.Time) (string, error)
+	// RetrieveVerificationData finds the email of an unexpired registration
+	// by verification id or, when that is empty, by email.
+	RetrieveVerificationData(ctx context.Context, verificationID, email string) (string, error)
 	PersistUserInfo(ctx context.Context, email string) (int, []string, error)
 	PersistUserPreferenes(ctx context.Context, user_id int, preferences []string) error
 	DeleteUserFromStaging(ctx context.Context, email string) error
 	DeleteUserVerificationData(ctx context.Context, email string) error
+	// RenewVerificationData extends the pending registration of email until
+	// expiresAt, keeping its verification id, and keeps it from being cleaned
+	// up as abandoned.
+	RenewVerificationData(ctx context.Context, email string, expiresAt time.Time) error
+	// DeleteStaleRegistrations drops registrations not verified or renewed
+	// since before, with their verification data.
+	DeleteStaleRegistrations(ctx context.Context, before time.Time) (int64, error)
+	// StageEmailChange replaces any email change the user already started.
+	StageEmailChange(ctx context.Context, userID int, email string) error
+	GetStagedEmailChange(ctx context.Context, userID int) (string, error)
+	// ConfirmEmailChange swaps in newEmail and returns the old one, provided
+	// newEmail is still the staged email and was staged less than maxAge ago.
+	ConfirmEmailChange(ctx context.Context, userID int, newEmail string, maxAge time.Duration) (string, error)
 }
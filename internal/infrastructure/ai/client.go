@@ -3,8 +3,12 @@ package ai
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/genai"
 )
 
@@ -44,8 +48,14 @@ func NewGemeniClient(ctx context.Context, apikey, model string) (*GemeniClient,
 	return &GemeniClient{Client: client, Model: model}, nil
 }
 
-func (g GemeniClient) GenerateStory(ctx context.Context, preferences string) (string, error) {
+func (g GemeniClient) GenerateStory(ctx context.Context, preferences string) (story string, err error) {
+	ctx, span := observability.Tracer().Start(ctx, "gemini generate_content",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("gen_ai.system", "gemini"), attribute.String("gen_ai.request.model", g.Model)))
+	defer func() { observability.EndSpan(span, err) }()
+
 	prompt := fmt.Sprintf(StoryGenerationPrompt, preferences)
+	started := time.Now()
 	result, err := g.Client.Models.GenerateContent(
 		ctx,
 		g.Model,
@@ -53,8 +63,17 @@ func (g GemeniClient) GenerateStory(ctx context.Context, preferences string) (st
 		nil)
 
 	if err != nil {
+		observability.AIRequestDuration.WithLabelValues(g.Model, observability.OutcomeFailure).Observe(time.Since(started).Seconds())
 		return "", domain.NewDomainError(domain.ErrCodeExternal, "failed to generate story from ai model", err)
 	}
+	observability.AIRequestDuration.WithLabelValues(g.Model, observability.OutcomeSuccess).Observe(time.Since(started).Seconds())
+	if usage := result.UsageMetadata; usage != nil {
+		observability.AITokens.WithLabelValues(g.Model, "prompt").Add(float64(usage.PromptTokenCount))
+		observability.AITokens.WithLabelValues(g.Model, "response").Add(float64(usage.CandidatesTokenCount))
+		span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", int(usage.PromptTokenCount)),
+			attribute.Int("gen_ai.usage.output_tokens", int(usage.CandidatesTokenCount)))
+	}
 
 	return result.Text(), nil
 
@@ -1,46 +1,104 @@
 package config
 
 import (
+	"encoding/base64"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	ServerHost              string  `mapstructure:"SERVER_HOST" validate:"required"`
-	ServerPort              int     `mapstructure:"SERVER_PORT" validate:"required,gte=1023,lte=65535"`
-	DatabaseDSN             string  `mapstructure:"DB_DSN" validate:"required"`
-	RedisPort               int     `mapstructure:"REDIS_PORT" validate:"required,gte=1023,lte=65535"`
-	RedisDB                 int     `mapstructure:"REDIS_DB" validate:"gte=0,lte=16"`
-	JwtAccessSecret         string  `mapstructure:"JWT_ACCESS_SECRET" validate:"required,min=32"`
-	JwtRefreshSecret        string  `mapstructure:"JWT_REFRESH_SECRET" validate:"required,min=32"`
-	SmtpHost                string  `mapstructure:"SMTP_HOST" validate:"required"`
-	SmtpPort                int     `mapstructure:"SMTP_PORT" validate:"required"`
-	SmtpUsername            string  `mapstructure:"SMTP_USERNAME" validate:"required"`
-	SmtpPassword            string  `mapstructure:"SMTP_PASSWORD" validate:"required"`
-	RataLimitCapacity       float64 `mapstructure:"RATE_LIMITER_CAPACITY" validate:"required,gte=0"`
-	RataLimitFillRate       float64 `mapstructure:"RATE_LIMITER_FILL_RATE" validate:"required,gte=0"`
-	OTPLength               int     `mapstructure:"OTP_LENGTH" validate:"required,gte=0"`
-	OTPExpiration           int     `mapstructure:"EXPIRATION" validate:"required,gte=0"`
-	BcryptCost              int     `mapstructure:"BCRYPT_COST" validate:"required,gte=0"`
-	GeminiModel             string  `mapstructure:"GEMINI_MODEL" validate:"required"`
-	GeminiAPI               string  `mapstructure:"GEMINI_API" validate:"required"`
-	WorkerCounts            int     `mapstructure:"NUM_WORKERS" validate:"required"`
-	JobQueueSize            int     `mapstructure:"JOB_QUEUE_SIZE" validate:"required"`
-	MaxAllowedSize          int     `mapstructure:"JSON_BODY_MAX_SIZE" validate:"required,gte=0"`
-	FromEmail               string  `mapstructure:"FROM_EMAIL" validate:"required"`
-	JwtISS                  string  `mapstructure:"ISS" validate:"required"`
-	LogFile                 string  `mapstructure:"LOGGING_FILE" validate:"required"`
-	ServerShutdownTimeout   int     `mapstructure:"SERVER_SHUTDOWN_TIMEOUT" validate:"required,gte=0"`
-	StoryGenerationStream   string  `mapstructure:"STORY_GENERATION_STREAM" validate:"required"`
-	EmailNotificationStream string  `mapstructure:"EMAIL_NOTIFICATION_STREAM" validate:"required"`
-	StoryDLQStream          string  `mapstructure:"STORY_DLQ_STREAM" validate:"required"`
-	EmailDLQStream          string  `mapstructure:"EMAIL_DLQ_STREAM" validate:"required"`
-	StoryConsumerGroup      string  `mapstructure:"STORY_CONSUMER_GROUP" validate:"required"`
-	EmailConsumerGroup      string  `mapstructure:"EMAIL_CONSUMER_GROUP" validate:"required"`
-	StoryRetryStream        string  `mapstructure:"STORY_RETRY_STREAM" validate:"required"`
-	EmailRetryStream        string  `mapstructure:"EMAIL_RETRY_STREAM" validate:"required"`
-	SchedulerWorkerCounts   int     `mapstructure:"SCHEDULER_NUM_WORKERS" validate:"required"`
-	JobRetryCount           int     `mapstructure:"JOB_RETRY_COUNT" validate:"required"`
+	ServerHost                  string  `mapstructure:"SERVER_HOST" validate:"required"`
+	ServerPort                  int     `mapstructure:"SERVER_PORT" validate:"required,gte=1023,lte=65535"`
+	APIHealthPort               int     `mapstructure:"API_HEALTH_PORT" validate:"required,gte=1023,lte=65535,nefield=ServerPort"`
+	WorkerHealthPort            int     `mapstructure:"WORKER_HEALTH_PORT" validate:"required,gte=1023,lte=65535,nefield=ServerPort,nefield=APIHealthPort"`
+	SchedulerHealthPort         int     `mapstructure:"SCHEDULER_HEALTH_PORT" validate:"required,gte=1023,lte=65535,nefield=ServerPort,nefield=APIHealthPort,nefield=WorkerHealthPort"`
+	DatabaseDSN                 string  `mapstructure:"DB_DSN" validate:"required"`
+	RedisPort                   int     `mapstructure:"REDIS_PORT" validate:"required,gte=1023,lte=65535"`
+	RedisDB                     int     `mapstructure:"REDIS_DB" validate:"gte=0,lte=16"`
+	JwtAccessSecret             string  `mapstructure:"JWT_ACCESS_SECRET" validate:"required_without=JwtSigningKeyFile,omitempty,min=32"`
+	JwtSigningKeyFile           string  `mapstructure:"JWT_SIGNING_KEY_FILE"`
+	JwtVerificationKeyFiles     string  `mapstructure:"JWT_VERIFICATION_KEY_FILES"`
+	JwtLegacySecretUntil        string  `mapstructure:"JWT_LEGACY_SECRET_UNTIL" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	JwtRefreshSecret            string  `mapstructure:"JWT_REFRESH_SECRET" validate:"required,min=32"`
+	SmtpHost                    string  `mapstructure:"SMTP_HOST" validate:"required"`
+	SmtpPort                    int     `mapstructure:"SMTP_PORT" validate:"required"`
+	SmtpUsername                string  `mapstructure:"SMTP_USERNAME" validate:"required"`
+	SmtpPassword                string  `mapstructure:"SMTP_PASSWORD" validate:"required"`
+	RataLimitCapacity           float64 `mapstructure:"RATE_LIMITER_CAPACITY" validate:"required,gte=0"`
+	RataLimitFillRate           float64 `mapstructure:"RATE_LIMITER_FILL_RATE" validate:"required,gte=0"`
+	OTPLength                   int     `mapstructure:"OTP_LENGTH" validate:"required,gte=0"`
+	OTPExpiration               int     `mapstructure:"EXPIRATION" validate:"required,gte=0"`
+	VerificationResendCooldown  int     `mapstructure:"VERIFICATION_RESEND_COOLDOWN" validate:"required,gte=1"`
+	MagicLinkURL                string  `mapstructure:"MAGIC_LINK_URL" validate:"required,url"`
+	MagicLinkExpiration         int     `mapstructure:"MAGIC_LINK_EXPIRATION" validate:"required,gte=1"`
+	MagicLinkCooldown           int     `mapstructure:"MAGIC_LINK_COOLDOWN" validate:"required,gte=1"`
+	MFAEncryptionKey            string  `mapstructure:"MFA_ENCRYPTION_KEY" validate:"omitempty,base64,aes_key"`
+	MFAIssuer                   string  `mapstructure:"MFA_ISSUER" validate:"required"`
+	MFAChallengeExpiration      int     `mapstructure:"MFA_CHALLENGE_EXPIRATION" validate:"required,gte=1"`
+	OIDCProviderName            string  `mapstructure:"OIDC_PROVIDER_NAME" validate:"required_with=OIDCIssuer"`
+	OIDCIssuer                  string  `mapstructure:"OIDC_ISSUER" validate:"omitempty,url"`
+	OIDCClientID                string  `mapstructure:"OIDC_CLIENT_ID" validate:"required_with=OIDCIssuer"`
+	OIDCClientSecret            string  `mapstructure:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL             string  `mapstructure:"OIDC_REDIRECT_URL" validate:"required_with=OIDCIssuer,omitempty,url"`
+	OIDCScopes                  string  `mapstructure:"OIDC_SCOPES" validate:"required_with=OIDCIssuer"`
+	OIDCStateTTL                int     `mapstructure:"OIDC_STATE_TTL" validate:"required,gte=1"`
+	OIDCTrustEmails             bool    `mapstructure:"OIDC_TRUST_EMAILS"`
+	BcryptCost                  int     `mapstructure:"BCRYPT_COST" validate:"required,gte=0"`
+	GeminiModel                 string  `mapstructure:"GEMINI_MODEL" validate:"required"`
+	GeminiAPI                   string  `mapstructure:"GEMINI_API" validate:"required"`
+	WorkerCounts                int     `mapstructure:"NUM_WORKERS" validate:"required"`
+	JobQueueSize                int     `mapstructure:"JOB_QUEUE_SIZE" validate:"required"`
+	MaxAllowedSize              int     `mapstructure:"JSON_BODY_MAX_SIZE" validate:"required,gte=0"`
+	FromEmail                   string  `mapstructure:"FROM_EMAIL" validate:"required"`
+	JwtISS                      string  `mapstructure:"ISS" validate:"required"`
+	LogLevel                    string  `mapstructure:"LOGGING_LEVEL" validate:"required,oneof=debug info warn error"`
+	LogOutput                   string  `mapstructure:"LOGGING_OUTPUT" validate:"required,oneof=stdout file both"`
+	LogFile                     string  `mapstructure:"LOGGING_FILE" validate:"required_unless=LogOutput stdout"`
+	LogMaxSizeMB                int     `mapstructure:"LOGGING_MAX_SIZE_MB" validate:"gte=0"`
+	LogMaxAgeDays               int     `mapstructure:"LOGGING_MAX_AGE_DAYS" validate:"gte=0"`
+	LogMaxBackups               int     `mapstructure:"LOGGING_MAX_BACKUPS" validate:"gte=0"`
+	LogCompress                 bool    `mapstructure:"LOGGING_COMPRESS"`
+	ServerShutdownTimeout       int     `mapstructure:"SERVER_SHUTDOWN_TIMEOUT" validate:"required,gte=0"`
+	WorkerShutdownTimeout       int     `mapstructure:"WORKER_SHUTDOWN_TIMEOUT" validate:"required,gte=1"`
+	StoryGenerationStream       string  `mapstructure:"STORY_GENERATION_STREAM" validate:"required"`
+	EmailNotificationStream     string  `mapstructure:"EMAIL_NOTIFICATION_STREAM" validate:"required"`
+	StoryDLQStream              string  `mapstructure:"STORY_DLQ_STREAM" validate:"required"`
+	EmailDLQStream              string  `mapstructure:"EMAIL_DLQ_STREAM" validate:"required"`
+	StoryConsumerGroup          string  `mapstructure:"STORY_CONSUMER_GROUP" validate:"required"`
+	EmailConsumerGroup          string  `mapstructure:"EMAIL_CONSUMER_GROUP" validate:"required"`
+	StoryRetryStream            string  `mapstructure:"STORY_RETRY_STREAM" validate:"required"`
+	EmailRetryStream            string  `mapstructure:"EMAIL_RETRY_STREAM" validate:"required"`
+	SchedulerWorkerCounts       int     `mapstructure:"SCHEDULER_NUM_WORKERS" validate:"required"`
+	JobRetryCount               int     `mapstructure:"JOB_RETRY_COUNT" validate:"required"`
+	OutboxBatchSize             int     `mapstructure:"OUTBOX_BATCH_SIZE" validate:"required,gte=1"`
+	OutboxPollInterval          int     `mapstructure:"OUTBOX_POLL_INTERVAL" validate:"required,gte=1"`
+	OutboxLeaseTimeout          int     `mapstructure:"OUTBOX_LEASE_TIMEOUT" validate:"required,gte=1"`
+	QueueBackend                string  `mapstructure:"QUEUE_BACKEND" validate:"required,oneof=redis postgres memory"`
+	QueueVisibilityTimeout      int     `mapstructure:"QUEUE_VISIBILITY_TIMEOUT" validate:"required,gte=1"`
+	QueuePollInterval           int     `mapstructure:"QUEUE_POLL_INTERVAL" validate:"required,gte=1"`
+	StreamReadBlock             int     `mapstructure:"STREAM_READ_BLOCK" validate:"required,gte=1"`
+	PriorityHighWeight          int     `mapstructure:"PRIORITY_HIGH_WEIGHT" validate:"required,gte=1"`
+	PriorityNormalWeight        int     `mapstructure:"PRIORITY_NORMAL_WEIGHT" validate:"required,gte=1"`
+	MaxActiveStoryJobs          int     `mapstructure:"MAX_ACTIVE_STORY_JOBS_PER_USER" validate:"required,gte=1"`
+	MinWorkerCounts             int     `mapstructure:"MIN_NUM_WORKERS" validate:"required,gte=1"`
+	MaxWorkerCounts             int     `mapstructure:"MAX_NUM_WORKERS" validate:"required,gtefield=MinWorkerCounts"`
+	AutoscaleInterval           int     `mapstructure:"AUTOSCALE_INTERVAL" validate:"required,gte=1"`
+	AutoscaleJobsPerWorker      int     `mapstructure:"AUTOSCALE_JOBS_PER_WORKER" validate:"required,gte=1"`
+	WorkerHeartbeatTimeout      int     `mapstructure:"WORKER_HEARTBEAT_TIMEOUT" validate:"required,gte=1"`
+	SchedulePollInterval        int     `mapstructure:"SCHEDULE_POLL_INTERVAL" validate:"required,gte=1"`
+	ScheduleLockTTL             int     `mapstructure:"SCHEDULE_LOCK_TTL" validate:"required,gtfield=SchedulePollInterval"`
+	ScheduleLockKey             string  `mapstructure:"SCHEDULE_LOCK_KEY" validate:"required"`
+	ScheduleBatchSize           int     `mapstructure:"SCHEDULE_BATCH_SIZE" validate:"required,gte=1"`
+	ScheduleMissedRunGrace      int     `mapstructure:"SCHEDULE_MISSED_RUN_GRACE" validate:"required,gte=1"`
+	AccountDeletionGraceDays    int     `mapstructure:"ACCOUNT_DELETION_GRACE_DAYS" validate:"required,gte=1"`
+	AccountPurgeInterval        int     `mapstructure:"ACCOUNT_PURGE_INTERVAL" validate:"required,gte=1"`
+	AccountPurgeBatchSize       int     `mapstructure:"ACCOUNT_PURGE_BATCH_SIZE" validate:"required,gte=1"`
+	RegistrationMaxAge          int     `mapstructure:"REGISTRATION_MAX_AGE" validate:"required,gte=1"`
+	RegistrationCleanupInterval int     `mapstructure:"REGISTRATION_CLEANUP_INTERVAL" validate:"required,gte=1"`
+	TracingExporter             string  `mapstructure:"TRACING_EXPORTER" validate:"required,oneof=none stdout otlp"`
+	TracingOTLPEndpoint         string  `mapstructure:"TRACING_OTLP_ENDPOINT" validate:"omitempty,url"`
+	TracingSampleRatio          float64 `mapstructure:"TRACING_SAMPLE_RATIO" validate:"gte=0,lte=1"`
 }
 
 func LoadConfigs(path string) (*Config, error) {
@@ -59,6 +117,10 @@ func LoadConfigs(path string) (*Config, error) {
 	}
 
 	validate := validator.New()
+	err = validate.RegisterValidation("aes_key", aesKeyValidator)
+	if err != nil {
+		return nil, err
+	}
 
 	err = validate.Struct(Cfg)
 	if err != nil {
@@ -68,3 +130,16 @@ func LoadConfigs(path string) (*Config, error) {
 	return &Cfg, nil
 
 }
+
+// aesKeyValidator accepts a base64 encoded AES-128, AES-192 or AES-256 key.
+func aesKeyValidator(fl validator.FieldLevel) bool {
+	key, err := base64.StdEncoding.DecodeString(fl.Field().String())
+	if err != nil {
+		return false
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestAESKeyValidator(t *testing.T) {
+	validate := validator.New()
+	if err := validate.RegisterValidation("aes_key", aesKeyValidator); err != nil {
+		t.Fatal(err)
+	}
+
+	key := func(n int) string { return base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", n))) }
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"unset", "", true},
+		{"aes-128", key(16), true},
+		{"aes-192", key(24), true},
+		{"aes-256", key(32), true},
+		{"too short", key(8), false},
+		{"too long", key(48), false},
+		{"not base64", "not a key!", false},
+	}
+	for _, tt := range tests {
+		err := validate.Var(tt.value, "omitempty,base64,aes_key")
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestLegacySecretUntilMustBeATimestamp(t *testing.T) {
+	validate := validator.New()
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"", true},
+		{"2026-10-19T15:00:00Z", true},
+		{"2026-10-19T17:00:00+02:00", true},
+		{"3600", false},
+		{"2026-10-19", false},
+	}
+	for _, tt := range tests {
+		err := validate.Var(tt.value, "omitempty,datetime=2006-01-02T15:04:05Z07:00")
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: got %v, want ok %v", tt.value, err, tt.ok)
+		}
+	}
+}
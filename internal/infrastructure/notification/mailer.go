@@ -1,9 +1,13 @@
 package notification
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	gomail "gopkg.in/mail.v2"
 )
 
@@ -16,44 +20,70 @@ type Mailer struct {
 	Logger    domain.LoggingRepository
 }
 
-func (m Mailer) SendVerificationEmail(email string, otp string) error {
-	message := gomail.NewMessage()
-	message.SetHeader("From", m.FromEmail)
-	message.SetHeader("To", email)
-	message.SetHeader("Subject", "verificatoin code")
+func (m Mailer) SendVerificationEmail(ctx context.Context, email string, otp string) error {
+	return m.send(ctx, "verification", email, "verificatoin code", fmt.Sprintf("Thanks for your register. your code is %s", otp))
+}
 
-	message.SetBody("text/plain", fmt.Sprintf("Thanks for your register. your code is %s", otp))
+func (m Mailer) SendNotificationEmail(ctx context.Context, email string) error {
+	return m.send(ctx, "notification", email, "Notification", "Your story is ready.🎉🎂")
+}
 
-	dialer := gomail.NewDialer(m.Host, m.Port, m.Username, m.Password)
+func (m Mailer) SendAccountDeletionEmail(ctx context.Context, email string, otp string) error {
+	return m.send(ctx, "account_deletion", email, "Confirm account deletion",
+		fmt.Sprintf("Someone asked to delete your account. If it was you, confirm with the code %s. Otherwise you can ignore this email.", otp))
+}
 
-	if err := dialer.DialAndSend(message); err != nil {
-		m.Logger.Error("verification_email_failed", "to", email, "reason", err.Error())
-		return domain.NewDomainError(domain.ErrCodeExternal, "failed to send email", err)
-	} else {
-		// fmt.Println("HTML Email sent successfully with a plain-text alternative!")
-		m.Logger.Info("verification_email_sent_successfully", "to", email)
-		return nil
-	}
+func (m Mailer) SendAccountRestorationEmail(ctx context.Context, email string, otp string) error {
+	return m.send(ctx, "account_restoration", email, "Restore your account",
+		fmt.Sprintf("Someone asked to restore your deleted account. If it was you, confirm with the code %s. Otherwise you can ignore this email.", otp))
+}
+
+func (m Mailer) SendEmailChangeEmail(ctx context.Context, email string, otp string) error {
+	return m.send(ctx, "email_change", email, "Confirm your new email",
+		fmt.Sprintf("Someone asked to use this address for their account. If it was you, confirm with the code %s.", otp))
+}
 
+func (m Mailer) SendEmailChangedEmail(ctx context.Context, oldEmail string, newEmail string) error {
+	return m.send(ctx, "email_changed", oldEmail, "Your email was changed",
+		fmt.Sprintf("The email of your account was changed to %s and you were logged out everywhere. If it was not you, contact support.", newEmail))
 }
 
-func (m Mailer) SendNotificationEmail(email string) error {
+func (m Mailer) SendMagicLinkEmail(ctx context.Context, email string, link string) error {
+	return m.send(ctx, "magic_link", email, "Your sign-in link",
+		fmt.Sprintf("Open this link to sign in: %s\nIt works once and expires soon. If you did not ask for it, ignore this email.", link))
+}
+
+// send delivers one plain-text email; kind labels the span, the metrics and
+// the log entry.
+func (m Mailer) send(ctx context.Context, kind string, email string, subject string, body string) (err error) {
+	_, span := m.startSpan(ctx, kind)
+	defer func() { observability.EndSpan(span, err) }()
+
 	message := gomail.NewMessage()
 	message.SetHeader("From", m.FromEmail)
 	message.SetHeader("To", email)
-	message.SetHeader("Subject", "Notification")
+	message.SetHeader("Subject", subject)
 
-	message.SetBody("text/plain", "Your story is ready.🎉🎂")
+	message.SetBody("text/plain", body)
 
 	dialer := gomail.NewDialer(m.Host, m.Port, m.Username, m.Password)
 
-	if err := dialer.DialAndSend(message); err != nil {
-		m.Logger.Error("notification_email_failed", "to", email, "reason", err.Error())
+	if err = dialer.DialAndSend(message); err != nil {
+		observability.EmailSends.WithLabelValues(kind, observability.OutcomeFailure).Inc()
+		m.Logger.Error(kind+"_email_failed", "to", email, "reason", err.Error())
 		return domain.NewDomainError(domain.ErrCodeExternal, "failed to send email", err)
-	} else {
-		// fmt.Println("HTML Email sent successfully with a plain-text alternative!")
-		m.Logger.Info("notification_email_sent_successfully", "to", email)
-		return nil
 	}
+	observability.EmailSends.WithLabelValues(kind, observability.OutcomeSuccess).Inc()
+	m.Logger.Info(kind+"_email_sent_successfully", "to", email)
+	return nil
+}
 
+func (m Mailer) startSpan(ctx context.Context, kind string) (context.Context, trace.Span) {
+	return observability.Tracer().Start(ctx, "smtp send "+kind,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("email.kind", kind),
+			attribute.String("server.address", m.Host),
+			attribute.Int("server.port", m.Port),
+		))
 }
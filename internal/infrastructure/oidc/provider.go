@@ -0,0 +1,245 @@
+// Package oidc logs users in with any OpenID Connect provider that supports
+// discovery, using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Provider struct {
+	ProviderName string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Client       *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]*rsa.PublicKey
+}
+
+func NewProvider(name, issuer, clientID, clientSecret, redirectURL string, scopes []string, client *http.Client) *Provider {
+	return &Provider{ProviderName: name, Issuer: strings.TrimSuffix(issuer, "/"), ClientID: clientID, ClientSecret: clientSecret,
+		RedirectURL: redirectURL, Scopes: scopes, Client: client}
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+func (p *Provider) Name() string {
+	return p.ProviderName
+}
+
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, codeChallenge string, nonce string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", domain.NewDomainError(domain.ErrCodeExternal, "invalid authorization endpoint", err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems code at the token endpoint and verifies the returned ID
+// token: signature, issuer, audience and expiry. The nonce is left to the
+// caller, which knows what it sent.
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string) (*domain.ExternalIdentity, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to build token request", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusBadRequest || status == http.StatusUnauthorized {
+		return nil, domain.NewDomainError(domain.ErrCodeUnauthorized, "authorization code rejected by provider",
+			fmt.Errorf("%s: %s", tokens.Error, tokens.ErrorDescription))
+	}
+	if status != http.StatusOK || tokens.IDToken == "" {
+		return nil, domain.NewDomainError(domain.ErrCodeExternal, "provider returned no id token", fmt.Errorf("status %d", status))
+	}
+
+	var claims idTokenClaims
+	_, err = jwt.ParseWithClaims(tokens.IDToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, d.JwksURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeUnauthorized, "invalid id token", err)
+	}
+
+	identity := &domain.ExternalIdentity{
+		Provider:      p.ProviderName,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+		Nonce:         claims.Nonce,
+	}
+	if identity.FirstName == "" && identity.LastName == "" {
+		identity.FirstName, identity.LastName, _ = strings.Cut(claims.Name, " ")
+	}
+	return identity, nil
+}
+
+// discover fetches the provider metadata once; failures are retried on the
+// next login instead of stopping the server from starting.
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to build discovery request", err)
+	}
+	var d discovery
+	status, err := p.doJSON(req, &d)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, domain.NewDomainError(domain.ErrCodeExternal, "oidc discovery failed", fmt.Errorf("status %d", status))
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.Issuer {
+		return nil, domain.NewDomainError(domain.ErrCodeExternal, "oidc discovery returned another issuer", fmt.Errorf("got %q", d.Issuer))
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key returns the signing key kid, refetching the key set when kid is
+// unknown because the provider rotated its keys.
+func (p *Provider) key(ctx context.Context, jwksURI string, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks: status %d", status)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("no signing key %q", kid)
+	}
+	return key, nil
+}
+
+// doJSON sends req and decodes the body into v for any status; the caller
+// decides what the status means.
+func (p *Provider) doJSON(req *http.Request, v any) (int, error) {
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeExternal, "oidc provider unreachable", err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return resp.StatusCode, domain.NewDomainError(domain.ErrCodeExternal, "invalid response from oidc provider", err)
+	}
+	return resp.StatusCode, nil
+}
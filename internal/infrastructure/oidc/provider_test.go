@@ -0,0 +1,132 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a minimal OpenID provider: discovery, a key set and a
+// token endpoint that checks the PKCE verifier against the last challenge.
+type mockProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	audience  string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{key: key, audience: "client-1"}
+	mux := http.NewServeMux()
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "code-1" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            m.URL,
+			"aud":            m.audience,
+			"sub":            "subject-1",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"email":          "reza@example.com",
+			"email_verified": true,
+			"name":           "Reza Amiri",
+			"nonce":          m.nonce,
+		})
+		token.Header["kid"] = "key-1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	return m
+}
+
+// authorize plays the browser: it follows the auth URL and remembers what
+// the provider would have stored.
+func (m *mockProvider) authorize(t *testing.T, authURL string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "client-1" || q.Get("state") != "state-1" {
+		t.Fatalf("unexpected authorization url %s", authURL)
+	}
+	m.challenge, m.nonce = q.Get("code_challenge"), q.Get("nonce")
+}
+
+func challengeOf(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestExchangeVerifiesTheIDToken(t *testing.T) {
+	ctx := context.Background()
+	m := newMockProvider(t)
+	p := NewProvider("mock", m.URL, "client-1", "secret", "http://localhost/cb", []string{"openid", "email"}, m.Client())
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", challengeOf("verifier-1"), "nonce-1")
+	if err != nil {
+		t.Fatalf("auth url: %v", err)
+	}
+	m.authorize(t, authURL)
+
+	identity, err := p.Exchange(ctx, "code-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if identity.Subject != "subject-1" || identity.Email != "reza@example.com" || !identity.EmailVerified ||
+		identity.Nonce != "nonce-1" || identity.FirstName != "Reza" || identity.LastName != "Amiri" || identity.Provider != "mock" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	if _, err := p.Exchange(ctx, "code-1", "another-verifier"); err == nil {
+		t.Error("exchange with the wrong PKCE verifier succeeded")
+	}
+
+	m.audience = "someone-else"
+	if _, err := p.Exchange(ctx, "code-1", "verifier-1"); err == nil {
+		t.Error("id token for another client accepted")
+	}
+}
@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+// AccountPurger permanently removes soft-deleted accounts once their grace
+// period is over. Purging is idempotent, so every scheduler instance runs one
+// without a lock.
+type AccountPurger struct {
+	Ctx        context.Context
+	CancelFunc context.CancelFunc
+	Wg         *sync.WaitGroup
+	Logger     domain.LoggingRepository
+	Executer   domain.AccountPurgeExecuter
+	Interval   time.Duration
+}
+
+func NewAccountPurger(
+	ctx context.Context,
+	logger domain.LoggingRepository,
+	executer domain.AccountPurgeExecuter,
+	interval time.Duration,
+) *AccountPurger {
+	ctx, cancelFunc := context.WithCancel(ctx)
+
+	return &AccountPurger{
+		Ctx:        ctx,
+		CancelFunc: cancelFunc,
+		Wg:         &sync.WaitGroup{},
+		Logger:     logger,
+		Executer:   executer,
+		Interval:   interval,
+	}
+}
+
+func (p *AccountPurger) Start() {
+	p.Wg.Add(1)
+	p.Run()
+}
+
+func (p *AccountPurger) Cancel() {
+	p.CancelFunc()
+}
+
+func (p *AccountPurger) Wait() {
+	p.Wg.Wait()
+}
+
+func (p *AccountPurger) Run() {
+	go func() {
+		defer p.Wg.Done()
+
+		log := p.Logger.With("service", "account-purger")
+		log.Info("account purger started", "event.category", []string{"process"})
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Error(
+					"account purger paniced",
+					"event.action", "panic_recovery",
+					"event.type", []string{"error", "end"},
+					"event.outcome", "failed",
+					"error.message", fmt.Sprintf("%v", rec))
+			}
+		}()
+
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.Ctx.Done():
+				log.Info("account purger stopped", "event.type", []string{"end"})
+				return
+			case <-ticker.C:
+				_ = p.Executer.PurgeDeletedAccounts(p.Ctx, time.Now())
+			}
+		}
+	}()
+}
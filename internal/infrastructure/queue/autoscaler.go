@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+)
+
+// Autoscaler resizes a WorkerPool from the backlog of its consumer group. It
+// scales up to the desired size at once but removes at most one worker per
+// tick, so a short lull does not drain the pool right before the next burst.
+type Autoscaler struct {
+	Ctx           context.Context
+	CancelFunc    context.CancelFunc
+	Wg            *sync.WaitGroup
+	Logger        domain.LoggingRepository
+	Pool          *WorkerPool
+	Stats         domain.StreamStatsReader
+	MinWorkers    int
+	MaxWorkers    int
+	JobsPerWorker int
+	Interval      time.Duration
+}
+
+func NewAutoscaler(
+	ctx context.Context,
+	logger domain.LoggingRepository,
+	pool *WorkerPool,
+	stats domain.StreamStatsReader,
+	minWorkers int,
+	maxWorkers int,
+	jobsPerWorker int,
+	interval time.Duration,
+) *Autoscaler {
+	ctx, cancelFunc := context.WithCancel(ctx)
+
+	return &Autoscaler{
+		Ctx:           ctx,
+		CancelFunc:    cancelFunc,
+		Wg:            &sync.WaitGroup{},
+		Logger:        logger,
+		Pool:          pool,
+		Stats:         stats,
+		MinWorkers:    minWorkers,
+		MaxWorkers:    maxWorkers,
+		JobsPerWorker: jobsPerWorker,
+		Interval:      interval,
+	}
+}
+
+func (a *Autoscaler) Start() {
+	a.Wg.Add(1)
+	a.Run()
+}
+
+func (a *Autoscaler) Cancel() {
+	a.CancelFunc()
+}
+
+func (a *Autoscaler) Wait() {
+	a.Wg.Wait()
+}
+
+func (a *Autoscaler) Run() {
+	go func() {
+		defer a.Wg.Done()
+
+		log := a.Logger.With("service", fmt.Sprintf("autoscaler-%s", a.Pool.Stream))
+		log.Info("autoscaler started", "event.category", []string{"process"})
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Error(
+					"autoscaler paniced",
+					"event.action", "panic_recovery",
+					"event.type", []string{"error", "end"},
+					"event.outcome", "failed",
+					"error.message", fmt.Sprintf("%v", rec))
+			}
+		}()
+
+		ticker := time.NewTicker(a.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.Ctx.Done():
+				log.Info("autoscaler stopped", "event.type", []string{"end"})
+				return
+			case <-ticker.C:
+				a.scale(log)
+			}
+		}
+	}()
+}
+
+func (a *Autoscaler) scale(log domain.LoggingRepository) {
+	var backlog int64
+	for _, stream := range a.Pool.Streams() {
+		stats, err := a.Stats.StreamStats(a.Ctx, stream, a.Pool.ConsumerGroup)
+		if err != nil {
+			log.Error(
+				fmt.Sprintf("failed to read stats of %s stream", stream),
+				"event.action", "read_stream_stats",
+				"event.type", []string{"error"},
+				"event.outcome", "failed",
+				"error.message", err.Error())
+			return
+		}
+		observability.StreamLag.WithLabelValues(stream).Set(float64(stats.Lag))
+		observability.StreamPending.WithLabelValues(stream).Set(float64(stats.Pending))
+		backlog += stats.Lag + stats.Pending
+	}
+
+	current := a.Pool.Size()
+	target := a.desired(backlog, current)
+	if target == current {
+		return
+	}
+
+	log.Info(
+		fmt.Sprintf("resizing pool from %d to %d workers", current, target),
+		"stream.backlog", backlog,
+		"event.action", "resize_pool",
+		"event.type", []string{"change"},
+		"event.outcome", "success")
+	a.Pool.Resize(target)
+}
+
+// desired returns the pool size for a backlog: one worker per JobsPerWorker
+// messages, clamped to the bounds, shrinking by one worker at a time.
+func (a *Autoscaler) desired(backlog int64, current int) int {
+	want := int((backlog + int64(a.JobsPerWorker) - 1) / int64(a.JobsPerWorker))
+	want = min(max(want, a.MinWorkers), a.MaxWorkers)
+	if want < current {
+		want = max(current-1, a.MinWorkers)
+	}
+	return want
+}
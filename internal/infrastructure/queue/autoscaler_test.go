@@ -0,0 +1,122 @@
+package queue_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/queue"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/memory"
+)
+
+// gatedExecuter blocks every job until the gate is opened or the job's
+// context is done.
+type gatedExecuter struct {
+	gate chan struct{}
+	mu   sync.Mutex
+	done int
+}
+
+func (e *gatedExecuter) Execute(ctx context.Context, job domain.Job) error {
+	select {
+	case <-e.gate:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.done++
+	return nil
+}
+
+func (e *gatedExecuter) Done() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.done
+}
+
+type ackingCompletion struct {
+	task   domain.StreamTaskHandler
+	stream string
+}
+
+func (c ackingCompletion) OnSuccess(ctx context.Context, job domain.Job, messageID string) error {
+	_ = c.task.Ack(ctx, messageID, c.stream)
+	return c.task.Delete(ctx, messageID, c.stream)
+}
+
+func (c ackingCompletion) OnFailure(ctx context.Context, job domain.Job, messageID string) error {
+	return c.OnSuccess(ctx, job, messageID)
+}
+
+func (c ackingCompletion) SendToDQL(ctx context.Context, job domain.Job, messageID string) error {
+	return c.OnSuccess(ctx, job, messageID)
+}
+
+func (c ackingCompletion) OnCancel(ctx context.Context, job domain.Job, messageID string) error {
+	return c.OnSuccess(ctx, job, messageID)
+}
+
+func newGatedPool(t *testing.T, workers int) (*queue.WorkerPool, *memory.Task, *gatedExecuter) {
+	t.Helper()
+
+	broker := memory.NewBroker()
+	task := memory.NewTask(broker, storyGroup)
+	task.ReadBlock = 10 * time.Millisecond
+	executer := &gatedExecuter{gate: make(chan struct{})}
+
+	pool := queue.NewWorkerPool(context.Background(), workers, nopLogger{}, task, executer,
+		ackingCompletion{task: task, stream: storyStream}, storyStream, storyGroup, 3, nil)
+	pool.Start()
+	t.Cleanup(func() {
+		pool.Cancel()
+		pool.Wait()
+	})
+	return pool, task, executer
+}
+
+func TestWorkerPoolResizeDrainsRemovedWorkers(t *testing.T) {
+	pool, task, executer := newGatedPool(t, 3)
+
+	for i := 1; i <= 3; i++ {
+		_ = task.Add(context.Background(), domain.Job{JobID: i}, storyStream)
+	}
+	eventually(t, func() bool { return len(task.Broker.Pending(storyStream, storyGroup)) == 3 },
+		"workers never picked up all three jobs")
+
+	pool.Resize(1)
+	if got := pool.Size(); got != 1 {
+		t.Fatalf("size after shrink = %d, want 1", got)
+	}
+
+	close(executer.gate)
+	eventually(t, func() bool { return executer.Done() == 3 },
+		"in-flight jobs of removed workers did not finish, done %d", executer.Done())
+	eventually(t, func() bool { return len(task.Broker.Messages(storyStream)) == 0 },
+		"stream still holds messages after drain")
+}
+
+func TestAutoscalerFollowsBacklog(t *testing.T) {
+	pool, task, executer := newGatedPool(t, 1)
+
+	stats := memory.NewTask(task.Broker, storyGroup)
+	scaler := queue.NewAutoscaler(context.Background(), nopLogger{}, pool, stats, 1, 4, 2, 10*time.Millisecond)
+	scaler.Start()
+	t.Cleanup(func() {
+		scaler.Cancel()
+		scaler.Wait()
+	})
+
+	for i := 1; i <= 20; i++ {
+		_ = task.Add(context.Background(), domain.Job{JobID: i}, storyStream)
+	}
+	eventually(t, func() bool { return pool.Size() == 4 }, "pool never grew to the max, size %d", pool.Size())
+
+	close(executer.gate)
+	eventually(t, func() bool { return pool.Size() == 1 }, "pool never shrank to the min, size %d", pool.Size())
+	if got := executer.Done(); got != 20 {
+		t.Errorf("executed %d jobs, want 20", got)
+	}
+}
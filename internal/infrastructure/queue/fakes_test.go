@@ -0,0 +1,260 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+func (l nopLogger) With(args ...interface{}) domain.LoggingRepository {
+	return l
+}
+
+var errInjected = errors.New("injected failure")
+
+// fakeStoryRepo records the status history of every story and email job.
+type fakeStoryRepo struct {
+	mu          sync.Mutex
+	nextID      int
+	stories     map[int]string
+	owners      map[int]int
+	storyStatus map[int][]string
+	emailStatus map[int][]string
+}
+
+func newFakeStoryRepo() *fakeStoryRepo {
+	return &fakeStoryRepo{
+		stories:     make(map[int]string),
+		owners:      make(map[int]int),
+		storyStatus: make(map[int][]string),
+		emailStatus: make(map[int][]string),
+	}
+}
+
+func (r *fakeStoryRepo) SaveStoryInfo(ctx context.Context, s *domain.Story) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	r.stories[r.nextID] = s.Story
+	r.owners[r.nextID] = s.UserID
+	return r.nextID, nil
+}
+
+func (r *fakeStoryRepo) UploadStory(ctx context.Context, s *domain.UploadStory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// mirror WHERE id = $2 AND user_id = $3
+	if owner, ok := r.owners[s.StoryID]; !ok || owner != s.UserID {
+		return domain.ErrStoryNotFound
+	}
+	r.stories[s.StoryID] = s.Story
+	return nil
+}
+
+func (r *fakeStoryRepo) Story(storyID int) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stories[storyID]
+}
+
+func (r *fakeStoryRepo) SaveStoryJob(ctx context.Context, storyID int, status string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.storyStatus[storyID] = append(r.storyStatus[storyID], status)
+	return storyID, nil
+}
+
+func (r *fakeStoryRepo) ScheduleStoryJob(ctx context.Context, s *domain.Story, job domain.Job, stream string, maxActive int) (int, int, error) {
+	storyID, _ := r.SaveStoryInfo(ctx, s)
+	jobID, _ := r.SaveStoryJob(ctx, storyID, "pending")
+	return storyID, jobID, nil
+}
+
+func (r *fakeStoryRepo) SaveEmailJob(ctx context.Context, storyID, userID int, status string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.emailStatus[storyID] = append(r.emailStatus[storyID], status)
+	return storyID, nil
+}
+
+func (r *fakeStoryRepo) UpdateStoryJob(ctx context.Context, storyID int, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.storyStatus[storyID] = append(r.storyStatus[storyID], status)
+	return nil
+}
+
+func (r *fakeStoryRepo) UpdateEmailJob(ctx context.Context, storyID int, userID int, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.emailStatus[storyID] = append(r.emailStatus[storyID], status)
+	return nil
+}
+
+func (r *fakeStoryRepo) GetStoryJobStats(ctx context.Context, userID int) (*domain.StoryJobStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := &domain.StoryJobStats{Total: len(r.storyStatus)}
+	for _, statuses := range r.storyStatus {
+		if s := statuses[len(statuses)-1]; s == "pending" || s == "processing" {
+			stats.Active++
+		}
+	}
+	return stats, nil
+}
+
+func (r *fakeStoryRepo) StoryStatus(storyID int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.storyStatus[storyID]...)
+}
+
+func (r *fakeStoryRepo) EmailStatus(storyID int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.emailStatus[storyID]...)
+}
+
+// fakeUserRepo knows every user except the deleted ones.
+type fakeUserRepo struct {
+	mu      sync.Mutex
+	deleted map[int]bool
+}
+
+func (r *fakeUserRepo) GetUserByID(ctx context.Context, id int) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.deleted[id] {
+		return nil, domain.ErrUserNotFound
+	}
+	return &domain.User{ID: id, Email: userEmail, Role: domain.RoleUser}, nil
+}
+
+func (r *fakeUserRepo) DeleteUserByID(ctx context.Context, id int, deletedBy string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.deleted == nil {
+		r.deleted = make(map[int]bool)
+	}
+	r.deleted[id] = true
+	return nil
+}
+
+func (r *fakeUserRepo) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return nil, domain.ErrEmailNotFound
+}
+
+func (r *fakeUserRepo) GetUserPreferencesByID(ctx context.Context, id int) (*domain.Preferences, error) {
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *fakeUserRepo) UpdateUserRole(ctx context.Context, id int, role string) error {
+	return nil
+}
+
+func (r *fakeUserRepo) GetDeletedUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return nil, domain.ErrEmailNotFound
+}
+
+func (r *fakeUserRepo) RestoreUserByID(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.deleted, id)
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateUserProfile(ctx context.Context, id int, update domain.ProfileUpdate, version *time.Time) (*domain.User, error) {
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *fakeUserRepo) ReplaceUserPreferences(ctx context.Context, userID int, preferences []string, version *time.Time) (*domain.Preferences, error) {
+	return nil, domain.ErrUserNotFound
+}
+
+// fakeStoryGenerator fails the first Failures calls, then returns Story.
+type fakeStoryGenerator struct {
+	mu       sync.Mutex
+	Failures int
+	Story    string
+	calls    int
+}
+
+func (g *fakeStoryGenerator) GenerateStory(ctx context.Context, preferences string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls++
+	if g.calls <= g.Failures {
+		return "", domain.NewDomainError(domain.ErrCodeExternal, "failed to generate story from ai model", errInjected)
+	}
+	return g.Story, nil
+}
+
+func (g *fakeStoryGenerator) Calls() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.calls
+}
+
+// fakeMailer fails the first Failures notification emails and records the
+// recipients of the ones it sends.
+type fakeMailer struct {
+	mu       sync.Mutex
+	Failures int
+	calls    int
+	sent     []string
+}
+
+func (m *fakeMailer) SendVerificationEmail(ctx context.Context, email string, otp string) error {
+	return nil
+}
+
+func (m *fakeMailer) SendEmailChangeEmail(ctx context.Context, email string, otp string) error {
+	return nil
+}
+
+func (m *fakeMailer) SendEmailChangedEmail(ctx context.Context, oldEmail string, newEmail string) error {
+	return nil
+}
+
+func (m *fakeMailer) SendMagicLinkEmail(ctx context.Context, email string, link string) error {
+	return nil
+}
+
+func (m *fakeMailer) SendAccountDeletionEmail(ctx context.Context, email string, otp string) error {
+	return nil
+}
+
+func (m *fakeMailer) SendAccountRestorationEmail(ctx context.Context, email string, otp string) error {
+	return nil
+}
+
+func (m *fakeMailer) SendNotificationEmail(ctx context.Context, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.calls <= m.Failures {
+		return domain.NewDomainError(domain.ErrCodeExternal, "failed to send email", errInjected)
+	}
+	m.sent = append(m.sent, email)
+	return nil
+}
+
+func (m *fakeMailer) Calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+func (m *fakeMailer) Sent() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.sent...)
+}
@@ -0,0 +1,60 @@
+package queue
+
+import "github.com/KianoushAmirpour/notification_server/internal/domain"
+
+type lane struct {
+	stream  string
+	weight  int
+	current int
+}
+
+// laneScheduler picks which priority stream a worker reads next using smooth
+// weighted round-robin, so a lane with weight 3 is tried first three times as
+// often as a lane with weight 1 without starving it.
+type laneScheduler struct {
+	lanes []*lane
+	total int
+}
+
+func newLaneScheduler(stream string, lanes []domain.PriorityLane) *laneScheduler {
+	ls := &laneScheduler{}
+	for _, l := range lanes {
+		weight := l.Weight
+		if weight < 1 {
+			weight = 1
+		}
+		ls.lanes = append(ls.lanes, &lane{stream: domain.PriorityStream(stream, l.Priority), weight: weight})
+		ls.total += weight
+	}
+	return ls
+}
+
+// order returns every lane stream, starting with the one whose turn it is.
+// The remaining lanes follow so an idle lane never leaves the worker idle.
+func (ls *laneScheduler) order() []string {
+	best := 0
+	for i, l := range ls.lanes {
+		l.current += l.weight
+		if l.current > ls.lanes[best].current {
+			best = i
+		}
+	}
+	ls.lanes[best].current -= ls.total
+
+	streams := make([]string, 0, len(ls.lanes))
+	streams = append(streams, ls.lanes[best].stream)
+	for i, l := range ls.lanes {
+		if i != best {
+			streams = append(streams, l.stream)
+		}
+	}
+	return streams
+}
+
+func (ls *laneScheduler) streams() []string {
+	streams := make([]string, 0, len(ls.lanes))
+	for _, l := range ls.lanes {
+		streams = append(streams, l.stream)
+	}
+	return streams
+}
@@ -0,0 +1,27 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+func TestLaneSchedulerFollowsWeights(t *testing.T) {
+	ls := newLaneScheduler("jobs", []domain.PriorityLane{
+		{Priority: domain.PriorityHigh, Weight: 3},
+		{Priority: domain.PriorityNormal, Weight: 1},
+	})
+
+	first := map[string]int{}
+	for i := 0; i < 8; i++ {
+		order := ls.order()
+		if len(order) != 2 {
+			t.Fatalf("order = %v, want both lanes", order)
+		}
+		first[order[0]]++
+	}
+
+	if first["jobs:high"] != 6 || first["jobs"] != 2 {
+		t.Errorf("first picks = %v, want jobs:high 6 and jobs 2", first)
+	}
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+type OutboxRelay struct {
+	Ctx               context.Context
+	CancelFunc        context.CancelFunc
+	Wg                *sync.WaitGroup
+	Logger            domain.LoggingRepository
+	Outbox            domain.OutboxRepository
+	TaskStreamHandler domain.StreamTaskHandler
+	BatchSize         int
+	Interval          time.Duration
+	Lease             time.Duration
+}
+
+func NewOutboxRelay(
+	ctx context.Context,
+	logger domain.LoggingRepository,
+	outbox domain.OutboxRepository,
+	taskStreamHandler domain.StreamTaskHandler,
+	batchSize int,
+	interval time.Duration,
+	lease time.Duration,
+) *OutboxRelay {
+	ctx, cancelFunc := context.WithCancel(ctx)
+
+	return &OutboxRelay{
+		Ctx:               ctx,
+		CancelFunc:        cancelFunc,
+		Wg:                &sync.WaitGroup{},
+		Logger:            logger,
+		Outbox:            outbox,
+		TaskStreamHandler: taskStreamHandler,
+		BatchSize:         batchSize,
+		Interval:          interval,
+		Lease:             lease,
+	}
+}
+
+func (r *OutboxRelay) Start() {
+	r.Wg.Add(1)
+	r.Run()
+}
+
+func (r *OutboxRelay) Cancel() {
+	r.CancelFunc()
+}
+
+func (r *OutboxRelay) Wait() {
+	r.Wg.Wait()
+}
+
+func (r *OutboxRelay) Run() {
+	go func() {
+		defer r.Wg.Done()
+
+		log := r.Logger.With("service", "outbox-relay")
+		log.Info("outbox relay started", "event.category", []string{"process"})
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Error(
+					"outbox relay paniced",
+					"event.action", "panic_recovery",
+					"event.type", []string{"error", "end"},
+					"event.outcome", "failed",
+					"error.message", fmt.Sprintf("%v", rec))
+			}
+		}()
+
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Ctx.Done():
+				log.Warn("outbox relay stopped",
+					"event.action", "context_canceled",
+					"event.type", []string{"error", "end"},
+					"event.outcome", "failed",
+					"error.message", r.Ctx.Err().Error())
+				return
+			case <-ticker.C:
+				r.relay(log)
+			}
+		}
+	}()
+}
+
+func (r *OutboxRelay) relay(log domain.LoggingRepository) {
+	messages, err := r.Outbox.ClaimPending(r.Ctx, r.BatchSize, r.Lease)
+	if err != nil {
+		log.Error("failed to claim outbox messages",
+			"event.action", "claim_outbox_messages",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return
+	}
+
+	for _, msg := range messages {
+		// A message published here but not marked sent is published again once
+		// its lease runs out, so consumers must tolerate duplicates.
+		if err := r.TaskStreamHandler.Add(r.Ctx, msg.Payload, msg.Stream); err != nil {
+			log.Error(fmt.Sprintf("failed to publish outbox message to %s stream", msg.Stream),
+				"outbox.message.id", msg.ID,
+				"story.job.id", msg.Payload.JobID,
+				"event.action", "publish_outbox_message",
+				"event.type", []string{"error", "end"},
+				"event.outcome", "failed",
+				"error.message", err.Error())
+			continue
+		}
+
+		if err := r.Outbox.MarkSent(r.Ctx, msg.ID); err != nil {
+			log.Error("failed to mark outbox message as sent",
+				"outbox.message.id", msg.ID,
+				"story.job.id", msg.Payload.JobID,
+				"event.action", "mark_outbox_message_sent",
+				"event.type", []string{"error", "end"},
+				"event.outcome", "failed",
+				"error.message", err.Error())
+			continue
+		}
+	}
+}
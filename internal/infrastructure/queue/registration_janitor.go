@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+// RegistrationJanitor deletes registrations that were never verified. Like
+// the account purger it is idempotent and runs on every scheduler instance.
+type RegistrationJanitor struct {
+	Ctx        context.Context
+	CancelFunc context.CancelFunc
+	Wg         *sync.WaitGroup
+	Logger     domain.LoggingRepository
+	Executer   domain.RegistrationCleanupExecuter
+	Interval   time.Duration
+}
+
+func NewRegistrationJanitor(
+	ctx context.Context,
+	logger domain.LoggingRepository,
+	executer domain.RegistrationCleanupExecuter,
+	interval time.Duration,
+) *RegistrationJanitor {
+	ctx, cancelFunc := context.WithCancel(ctx)
+
+	return &RegistrationJanitor{
+		Ctx:        ctx,
+		CancelFunc: cancelFunc,
+		Wg:         &sync.WaitGroup{},
+		Logger:     logger,
+		Executer:   executer,
+		Interval:   interval,
+	}
+}
+
+func (j *RegistrationJanitor) Start() {
+	j.Wg.Add(1)
+	j.Run()
+}
+
+func (j *RegistrationJanitor) Cancel() {
+	j.CancelFunc()
+}
+
+func (j *RegistrationJanitor) Wait() {
+	j.Wg.Wait()
+}
+
+func (j *RegistrationJanitor) Run() {
+	go func() {
+		defer j.Wg.Done()
+
+		log := j.Logger.With("service", "registration-janitor")
+		log.Info("registration janitor started", "event.category", []string{"process"})
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Error(
+					"registration janitor paniced",
+					"event.action", "panic_recovery",
+					"event.type", []string{"error", "end"},
+					"event.outcome", "failed",
+					"error.message", fmt.Sprintf("%v", rec))
+			}
+		}()
+
+		ticker := time.NewTicker(j.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.Ctx.Done():
+				log.Info("registration janitor stopped", "event.type", []string{"end"})
+				return
+			case <-ticker.C:
+				_ = j.Executer.CleanupStaleRegistrations(j.Ctx, time.Now())
+			}
+		}
+	}()
+}
@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/google/uuid"
+)
+
+// ScheduleRunner fires due story schedules. Every instance runs one, but only
+// the holder of the shared lock does any work, so a schedule is never fired
+// twice by two instances.
+type ScheduleRunner struct {
+	Ctx        context.Context
+	CancelFunc context.CancelFunc
+	Wg         *sync.WaitGroup
+	Logger     domain.LoggingRepository
+	Lock       domain.LockRepository
+	Executer   domain.ScheduleExecuter
+	LockKey    string
+	Owner      string
+	Interval   time.Duration
+	LockTTL    time.Duration
+	leader     bool
+}
+
+func NewScheduleRunner(
+	ctx context.Context,
+	logger domain.LoggingRepository,
+	lock domain.LockRepository,
+	executer domain.ScheduleExecuter,
+	lockKey string,
+	interval time.Duration,
+	lockTTL time.Duration,
+) *ScheduleRunner {
+	ctx, cancelFunc := context.WithCancel(ctx)
+
+	hostname, _ := os.Hostname()
+
+	return &ScheduleRunner{
+		Ctx:        ctx,
+		CancelFunc: cancelFunc,
+		Wg:         &sync.WaitGroup{},
+		Logger:     logger,
+		Lock:       lock,
+		Executer:   executer,
+		LockKey:    lockKey,
+		Owner:      fmt.Sprintf("%s:%s", hostname, uuid.NewString()),
+		Interval:   interval,
+		LockTTL:    lockTTL,
+	}
+}
+
+func (r *ScheduleRunner) Start() {
+	r.Wg.Add(1)
+	r.Run()
+}
+
+func (r *ScheduleRunner) Cancel() {
+	r.CancelFunc()
+}
+
+func (r *ScheduleRunner) Wait() {
+	r.Wg.Wait()
+}
+
+func (r *ScheduleRunner) Run() {
+	go func() {
+		defer r.Wg.Done()
+
+		log := r.Logger.With("service", "schedule-runner", "lock.owner", r.Owner)
+		log.Info("schedule runner started", "event.category", []string{"process"})
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Error(
+					"schedule runner paniced",
+					"event.action", "panic_recovery",
+					"event.type", []string{"error", "end"},
+					"event.outcome", "failed",
+					"error.message", fmt.Sprintf("%v", rec))
+			}
+		}()
+		defer r.resign(log)
+
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Ctx.Done():
+				log.Info("schedule runner stopped", "event.type", []string{"end"})
+				return
+			case <-ticker.C:
+				if !r.elect(log) {
+					continue
+				}
+				_ = r.Executer.RunDueSchedules(r.Ctx, time.Now())
+			}
+		}
+	}()
+}
+
+// elect acquires the lock, or refreshes it when this instance already leads.
+func (r *ScheduleRunner) elect(log domain.LoggingRepository) bool {
+	var ok bool
+	var err error
+	if r.leader {
+		ok, err = r.Lock.RefreshLock(r.Ctx, r.LockKey, r.Owner, r.LockTTL)
+	} else {
+		ok, err = r.Lock.AcquireLock(r.Ctx, r.LockKey, r.Owner, r.LockTTL)
+	}
+	if err != nil {
+		log.Error(
+			"failed to acquire scheduler lock",
+			"event.action", "acquire_lock",
+			"event.type", []string{"error"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		ok = false
+	}
+
+	if ok != r.leader {
+		if ok {
+			log.Info("became schedule leader", "event.action", "acquire_lock", "event.outcome", "success")
+		} else {
+			log.Warn("lost schedule leadership", "event.action", "acquire_lock", "event.outcome", "failed")
+		}
+	}
+	r.leader = ok
+	return ok
+}
+
+// resign hands the lock back on shutdown so another instance takes over
+// without waiting for the TTL to run out.
+func (r *ScheduleRunner) resign(log domain.LoggingRepository) {
+	if !r.leader {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Lock.ReleaseLock(ctx, r.LockKey, r.Owner); err != nil {
+		log.Error(
+			"failed to release scheduler lock",
+			"event.action", "release_lock",
+			"event.type", []string{"error"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+	}
+	r.leader = false
+}
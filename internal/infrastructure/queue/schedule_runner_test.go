@@ -0,0 +1,93 @@
+package queue_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/queue"
+)
+
+type fakeLock struct {
+	mu    sync.Mutex
+	owner string
+}
+
+func (l *fakeLock) AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.owner != "" {
+		return false, nil
+	}
+	l.owner = owner
+	return true, nil
+}
+
+func (l *fakeLock) RefreshLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.owner == owner, nil
+}
+
+func (l *fakeLock) ReleaseLock(ctx context.Context, key, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.owner == owner {
+		l.owner = ""
+	}
+	return nil
+}
+
+func (l *fakeLock) Owner() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.owner
+}
+
+type countingExecuter struct {
+	mu   sync.Mutex
+	runs int
+}
+
+func (e *countingExecuter) RunDueSchedules(ctx context.Context, now time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.runs++
+	return nil
+}
+
+func (e *countingExecuter) Runs() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.runs
+}
+
+func TestScheduleRunnerOnlyLeaderRuns(t *testing.T) {
+	lock := &fakeLock{}
+	first, second := &countingExecuter{}, &countingExecuter{}
+
+	ctx := context.Background()
+	leader := queue.NewScheduleRunner(ctx, nopLogger{}, lock, first, "leader", 10*time.Millisecond, time.Second)
+	follower := queue.NewScheduleRunner(ctx, nopLogger{}, lock, second, "leader", 10*time.Millisecond, time.Second)
+
+	leader.Start()
+	eventually(t, func() bool { return first.Runs() > 0 }, "leader never ran")
+	follower.Start()
+	t.Cleanup(func() {
+		follower.Cancel()
+		follower.Wait()
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	if got := second.Runs(); got != 0 {
+		t.Fatalf("follower ran %d times while the leader held the lock", got)
+	}
+
+	leader.Cancel()
+	leader.Wait()
+	eventually(t, func() bool { return second.Runs() > 0 }, "follower never took over after the leader released the lock")
+	if got := lock.Owner(); got != follower.Owner {
+		t.Errorf("lock owner = %q, want follower %q", got, follower.Owner)
+	}
+}
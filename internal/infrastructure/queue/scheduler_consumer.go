@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
 )
 
 type SchedulerWorkPool struct {
@@ -17,11 +18,13 @@ type SchedulerWorkPool struct {
 	Wg                *sync.WaitGroup
 	Logger            domain.LoggingRepository
 	TaskStreamHandler domain.StreamTaskHandler
+	Stats             domain.StreamStatsReader
 	Queue             string
 	Stream            string
+	Interval          time.Duration
 }
 
-func NewShedulerWorkerPool(ctx context.Context, workerCounts int, logger domain.LoggingRepository, queue string, taskStreamHandler domain.StreamTaskHandler, stream string) *SchedulerWorkPool {
+func NewShedulerWorkerPool(ctx context.Context, workerCounts int, logger domain.LoggingRepository, queue string, taskStreamHandler domain.StreamTaskHandler, stats domain.StreamStatsReader, stream string) *SchedulerWorkPool {
 	ctx, cancelFunc := context.WithCancel(ctx)
 
 	return &SchedulerWorkPool{
@@ -31,8 +34,10 @@ func NewShedulerWorkerPool(ctx context.Context, workerCounts int, logger domain.
 		Wg:                &sync.WaitGroup{},
 		Logger:            logger,
 		TaskStreamHandler: taskStreamHandler,
+		Stats:             stats,
 		Queue:             queue,
 		Stream:            stream,
+		Interval:          time.Second * 2,
 	}
 }
 
@@ -69,7 +74,7 @@ func (sp *SchedulerWorkPool) Run(workerID int) {
 			}
 		}()
 
-		ticker := time.NewTicker(time.Second * 2)
+		ticker := time.NewTicker(sp.Interval)
 		defer ticker.Stop()
 		for {
 			select {
@@ -81,6 +86,9 @@ func (sp *SchedulerWorkPool) Run(workerID int) {
 					"error.message", sp.Ctx.Err().Error())
 				return
 			case <-ticker.C:
+				if workerID == 1 {
+					sp.recordRetrySetSize(log)
+				}
 				err := sp.TaskStreamHandler.ReEnqueue(sp.Ctx, sp.Queue, sp.Stream)
 				if err != nil {
 					if errors.Is(err, domain.ErrNoMessageFound) {
@@ -98,3 +106,18 @@ func (sp *SchedulerWorkPool) Run(workerID int) {
 		}
 	}()
 }
+
+// recordRetrySetSize publishes the retry set size. Only the first worker calls
+// it, the others would read the same number.
+func (sp *SchedulerWorkPool) recordRetrySetSize(log domain.LoggingRepository) {
+	size, err := sp.Stats.RetrySetSize(sp.Ctx, sp.Queue, sp.Stream)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to read size of %s", sp.Queue),
+			"event.action", "read_retry_set_size",
+			"event.type", []string{"error"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return
+	}
+	observability.RetrySetSize.WithLabelValues(sp.Stream).Set(float64(size))
+}
@@ -0,0 +1,81 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/queue"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/memory"
+)
+
+func TestWorkerPoolShutdownFinishesRunningJobs(t *testing.T) {
+	pool, task, executer := newGatedPool(t, 2)
+
+	for i := 1; i <= 2; i++ {
+		_ = task.Add(context.Background(), domain.Job{JobID: i}, storyStream)
+	}
+	eventually(t, func() bool { return len(task.Broker.Pending(storyStream, storyGroup)) == 2 },
+		"workers never picked up both jobs")
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- pool.Shutdown(context.Background()) }()
+
+	// a job added after shutdown started must not be picked up
+	eventually(t, func() bool { return pool.Size() == 0 }, "pool kept workers after shutdown")
+	_ = task.Add(context.Background(), domain.Job{JobID: 3}, storyStream)
+	close(executer.gate)
+
+	if err := <-shutdown; err != nil {
+		t.Fatalf("shutdown = %v, want nil", err)
+	}
+	if got := executer.Done(); got != 2 {
+		t.Errorf("%d jobs finished, want 2", got)
+	}
+	if msgs := task.Broker.Messages(storyStream); len(msgs) != 1 || msgs[0].Payload.JobID != 3 {
+		t.Errorf("stream holds %v, want only job 3", msgs)
+	}
+
+	pool.Resize(2)
+	if got := pool.Size(); got != 0 {
+		t.Errorf("pool grew to %d workers after shutdown", got)
+	}
+}
+
+func TestWorkerPoolShutdownLeavesAbortedJobsClaimable(t *testing.T) {
+	pool, task, executer := newGatedPool(t, 1)
+
+	_ = task.Add(context.Background(), domain.Job{JobID: 1}, storyStream)
+	eventually(t, func() bool { return len(task.Broker.Pending(storyStream, storyGroup)) == 1 },
+		"worker never picked up the job")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown = %v, want deadline exceeded", err)
+	}
+	if got := task.Broker.Pending(storyStream, storyGroup); len(got) != 1 {
+		t.Fatalf("pending = %v, want the aborted job to stay unacked", got)
+	}
+
+	// a new instance claims the job once it has been idle long enough
+	next := memory.NewTask(task.Broker, storyGroup)
+	next.ReadBlock = 10 * time.Millisecond
+	next.ClaimIdle = 10 * time.Millisecond
+	close(executer.gate)
+	restarted := queue.NewWorkerPool(context.Background(), 1, nopLogger{}, next, executer,
+		ackingCompletion{task: next, stream: storyStream}, storyStream, storyGroup, 3, nil)
+	restarted.Start()
+	defer func() {
+		restarted.Cancel()
+		restarted.Wait()
+	}()
+
+	eventually(t, func() bool { return len(task.Broker.Messages(storyStream)) == 0 },
+		"aborted job was never redelivered")
+	if got := executer.Done(); got != 1 {
+		t.Errorf("%d jobs finished, want 1", got)
+	}
+}
@@ -2,11 +2,16 @@ package queue
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"sync"
 	"time"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type WorkerPool struct {
@@ -21,6 +26,13 @@ type WorkerPool struct {
 	Stream            string
 	ConsumerGroup     string
 	MaxJobRetry       int
+	Lanes             []domain.PriorityLane
+
+	mu         sync.Mutex
+	workers    map[int]chan struct{}
+	running    map[int]bool
+	heartbeats map[int]time.Time
+	closed     bool
 }
 
 func NewWorkerPool(
@@ -33,10 +45,14 @@ func NewWorkerPool(
 	stream string,
 	consumer string,
 	maxJobRetry int,
-
+	lanes []domain.PriorityLane,
 ) *WorkerPool {
 	ctx, cancelFunc := context.WithCancel(ctx)
 
+	if len(lanes) == 0 {
+		lanes = []domain.PriorityLane{{Priority: domain.PriorityNormal, Weight: 1}}
+	}
+
 	wp := &WorkerPool{
 		WorkerCounts:      workercounts,
 		Ctx:               ctx,
@@ -49,33 +65,170 @@ func NewWorkerPool(
 		Stream:            stream,
 		ConsumerGroup:     consumer,
 		MaxJobRetry:       maxJobRetry,
+		Lanes:             lanes,
+		workers:           make(map[int]chan struct{}),
+		running:           make(map[int]bool),
+		heartbeats:        make(map[int]time.Time),
 	}
 
 	return wp
 }
 
 func (wp *WorkerPool) Start() {
-	err := wp.TaskStreamHandler.CreateConsumerGroup(wp.Ctx, wp.Stream, wp.ConsumerGroup)
-	for i := 1; i <= wp.WorkerCounts; i++ {
-		if err != nil {
+	for _, stream := range newLaneScheduler(wp.Stream, wp.Lanes).streams() {
+		if err := wp.TaskStreamHandler.CreateConsumerGroup(wp.Ctx, stream, wp.ConsumerGroup); err != nil {
 			panic(err)
 		}
+	}
+	wp.Resize(wp.WorkerCounts)
+}
+
+// Resize grows or shrinks the pool to n workers. Removed workers are only
+// told to stop: each one finishes the job it is running before it exits.
+func (wp *WorkerPool) Resize(n int) {
+	wp.mu.Lock()
+	if wp.closed {
+		n = 0
+	}
+	var started []int
+	for len(wp.workers) < n {
+		id := 1
+		for wp.running[id] {
+			id++
+		}
+		wp.workers[id] = make(chan struct{})
+		wp.running[id] = true
+		wp.heartbeats[id] = time.Now()
+		started = append(started, id)
+	}
+	for len(wp.workers) > n {
+		id := 0
+		for workerID := range wp.workers {
+			id = max(id, workerID)
+		}
+		close(wp.workers[id])
+		delete(wp.workers, id)
+	}
+	wp.mu.Unlock()
+
+	for _, id := range started {
 		wp.Wg.Add(1)
-		wp.Run(i)
+		wp.Run(id)
+	}
+}
+
+// Size returns the number of workers that are running and not draining.
+func (wp *WorkerPool) Size() int {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return len(wp.workers)
+}
+
+// Streams returns the priority lane streams the pool reads from.
+func (wp *WorkerPool) Streams() []string {
+	return newLaneScheduler(wp.Stream, wp.Lanes).streams()
+}
+
+// Heartbeats returns when each running worker last went around its loop. A
+// worker beats before every read, so a beat older than the read block plus
+// the job timeout means the worker is stuck.
+func (wp *WorkerPool) Heartbeats() map[int]time.Time {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return maps.Clone(wp.heartbeats)
+}
+
+func (wp *WorkerPool) beat(workerID int) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	wp.heartbeats[workerID] = time.Now()
+}
+
+func (wp *WorkerPool) stopSignal(workerID int) <-chan struct{} {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return wp.workers[workerID]
+}
+
+func (wp *WorkerPool) exit(workerID int) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	if stop, ok := wp.workers[workerID]; ok {
+		close(stop)
+		delete(wp.workers, workerID)
+	}
+	delete(wp.running, workerID)
+	delete(wp.heartbeats, workerID)
+}
+
+// read makes one non-blocking pass over the priority lanes in the order the
+// scheduler hands out, then blocks on all of them at once. Blocking on one
+// lane at a time would let an idle high lane hold back the normal lane for a
+// whole read block.
+func (wp *WorkerPool) read(workerID int, lanes *laneScheduler) (domain.Message, string, error) {
+	order := lanes.order()
+	msg, stream, err := wp.TaskStreamHandler.Read(wp.Ctx, workerID, order, false)
+	if !errors.Is(err, domain.ErrNoMessageFound) {
+		return msg, stream, err
 	}
+	return wp.TaskStreamHandler.Read(wp.Ctx, workerID, order, true)
+}
+
+// startSpan opens the consumer span of a job as a child of the span that
+// enqueued it.
+func (wp *WorkerPool) startSpan(stream string, msg domain.Message) (context.Context, trace.Span) {
+	ctx := observability.ExtractTraceContext(wp.Ctx, msg.Payload.TraceContext)
+	return observability.Tracer().Start(ctx, fmt.Sprintf("process %s", wp.Stream),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", stream),
+			attribute.String("messaging.consumer.group.name", wp.ConsumerGroup),
+			attribute.String("messaging.message.id", msg.MessageID),
+			attribute.Int("job.id", msg.Payload.JobID),
+			attribute.Int("job.retry_count", msg.Payload.RetryCounts),
+			attribute.String("http.request.id", msg.Payload.RequestID),
+		))
 }
 
 func (wp *WorkerPool) Cancel() {
 	wp.CancelFunc()
 }
 
+// Shutdown stops every worker from reading new messages and waits for the
+// jobs already running. When ctx expires first the remaining jobs are aborted
+// and left unacked, so the stream hands them to another consumer later.
+func (wp *WorkerPool) Shutdown(ctx context.Context) error {
+	wp.Resize(0)
+	wp.mu.Lock()
+	wp.closed = true
+	wp.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wp.Wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		wp.CancelFunc()
+		return nil
+	case <-ctx.Done():
+		wp.CancelFunc()
+		<-done
+		return ctx.Err()
+	}
+}
+
 func (wp *WorkerPool) Wait() {
 	wp.Wg.Wait()
 }
 
 func (wp *WorkerPool) Run(workerID int) {
+	stop := wp.stopSignal(workerID)
 	go func() {
 		defer wp.Wg.Done()
+		defer wp.exit(workerID)
 		log := wp.Logger.With("service", fmt.Sprintf("worker-pool-%s", wp.Stream), "stream.worker.id", workerID)
 		log.Info(fmt.Sprintf("workerid %d started", workerID), "event.category", []string{"process"})
 
@@ -90,7 +243,16 @@ func (wp *WorkerPool) Run(workerID int) {
 			}
 		}()
 
+		lanes := newLaneScheduler(wp.Stream, wp.Lanes)
+
 		for {
+			select {
+			case <-stop:
+				log.Info("worker drained", "event.action", "scale_down", "event.type", []string{"end"}, "event.outcome", "success")
+				return
+			default:
+			}
+
 			if wp.Ctx.Err() != nil {
 				log.Warn("worker stopped",
 					"event.action", "context_canceled",
@@ -101,7 +263,11 @@ func (wp *WorkerPool) Run(workerID int) {
 				return
 			}
 
-			msg, err := wp.TaskStreamHandler.Read(wp.Ctx, workerID, wp.Stream)
+			wp.beat(workerID)
+			msg, stream, err := wp.read(workerID, lanes)
+			if errors.Is(err, domain.ErrNoMessageFound) {
+				continue
+			}
 			if err != nil {
 				log.Error(fmt.Sprintf("failed to read the message from %s stream", wp.Stream),
 					"stream.message.id", msg.MessageID,
@@ -112,18 +278,51 @@ func (wp *WorkerPool) Run(workerID int) {
 				continue
 			}
 			log.Info(
-				fmt.Sprintf("read message from %s succussfully. messageID: %s, jobID:%d", wp.Stream, msg.MessageID, msg.Payload.JobID))
-			readCtx, readcancel := context.WithTimeout(wp.Ctx, 30*time.Second)
+				fmt.Sprintf("read message from %s succussfully. messageID: %s, jobID:%d", stream, msg.MessageID, msg.Payload.JobID))
+
+			jobCtx, span := wp.startSpan(stream, msg)
+			// jobs enqueued while handling this one, the email job or a retry,
+			// continue the trace from this span
+			msg.Payload.TraceContext = observability.InjectTraceContext(jobCtx)
+
+			readCtx, readcancel := context.WithTimeout(jobCtx, 30*time.Second)
+			started := time.Now()
 			err = wp.JobExecuter.Execute(readCtx, msg.Payload)
 			readcancel()
+			observability.QueueJobDuration.WithLabelValues(wp.Stream).Observe(time.Since(started).Seconds())
+			observability.EndSpan(span, err)
+			// completion must not be cut short by shutdown
+			completionCtx := context.WithoutCancel(jobCtx)
+			if wp.Ctx.Err() != nil {
+				observability.QueueJobs.WithLabelValues(wp.Stream, observability.JobAborted).Inc()
+				// aborted by shutdown: leave the message unacked so it is
+				// redelivered instead of burning a retry
+				log.Warn("job aborted, message left for redelivery",
+					"stream.message.id", msg.MessageID,
+					"event.action", "abort_job",
+					"event.type", []string{"end"},
+					"event.outcome", "failed",
+					"error.message", wp.Ctx.Err().Error())
+				return
+			}
+			if errors.Is(err, domain.ErrJobCancelled) {
+				observability.QueueJobs.WithLabelValues(wp.Stream, observability.JobCancelled).Inc()
+				_ = wp.CompletionHandler.OnCancel(completionCtx, msg.Payload, msg.MessageID)
+				continue
+			}
 			if err != nil {
-				if msg.Payload.RetryCounts == wp.MaxJobRetry {
-					_ = wp.CompletionHandler.SendToDQL(context.Background(), msg.Payload, msg.MessageID)
+				observability.QueueJobs.WithLabelValues(wp.Stream, observability.JobFailed).Inc()
+				if msg.Payload.RetryCounts >= wp.MaxJobRetry {
+					observability.QueueJobs.WithLabelValues(wp.Stream, observability.JobDeadLettered).Inc()
+					_ = wp.CompletionHandler.SendToDQL(completionCtx, msg.Payload, msg.MessageID)
+					continue
 				}
-				_ = wp.CompletionHandler.OnFailure(context.Background(), msg.Payload, msg.MessageID)
+				observability.QueueJobs.WithLabelValues(wp.Stream, observability.JobRetried).Inc()
+				_ = wp.CompletionHandler.OnFailure(completionCtx, msg.Payload, msg.MessageID)
 				continue
 			}
-			_ = wp.CompletionHandler.OnSuccess(context.Background(), msg.Payload, msg.MessageID)
+			observability.QueueJobs.WithLabelValues(wp.Stream, observability.JobProcessed).Inc()
+			_ = wp.CompletionHandler.OnSuccess(completionCtx, msg.Payload, msg.MessageID)
 		}
 	}()
 }
@@ -0,0 +1,52 @@
+package queue_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWorkerPoolsContinueTheRequestTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	h := newHarness(t, &fakeStoryGenerator{Failures: 1, Story: "once upon a time"}, &fakeMailer{}, 3)
+
+	ctx, root := provider.Tracer("test").Start(context.Background(), "POST /stories")
+	storyID, jobID, _ := h.repo.ScheduleStoryJob(ctx, &domain.Story{FileName: "story-dragons", UserID: 7}, domain.Job{}, storyStream, 10)
+	job := domain.Job{
+		JobID:        jobID,
+		UserID:       7,
+		StoryID:      storyID,
+		UserEmail:    userEmail,
+		Priority:     domain.PriorityNormal,
+		TraceContext: observability.InjectTraceContext(ctx),
+	}
+	if err := h.storyTask.Add(ctx, job, domain.PriorityStream(storyStream, domain.PriorityNormal)); err != nil {
+		t.Fatalf("add story job: %v", err)
+	}
+	root.End()
+
+	eventually(t, func() bool { return last(h.repo.EmailStatus(storyID)) == "completed" },
+		"email job never completed, statuses %v", h.repo.EmailStatus(storyID))
+
+	eventually(t, func() bool {
+		processed := map[string]int{}
+		for _, span := range recorder.Ended() {
+			if span.SpanContext().TraceID() != root.SpanContext().TraceID() {
+				continue
+			}
+			processed[span.Name()]++
+		}
+		// the failed first attempt and its retry both belong to the trace
+		return processed["process "+storyStream] == 2 && processed["process "+emailStream] == 1
+	}, "story and email spans never joined the request trace")
+}
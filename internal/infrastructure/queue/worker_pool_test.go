@@ -0,0 +1,461 @@
+package queue_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/queue"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/repository/memory"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+	"github.com/KianoushAmirpour/notification_server/internal/usecase"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const (
+	storyStream = "story_generation"
+	emailStream = "email_notification"
+	storyDLQ    = "story_dlq"
+	emailDLQ    = "email_dlq"
+	storyGroup  = "story_workers"
+	emailGroup  = "email_workers"
+	userEmail   = "reader@example.com"
+)
+
+var lanes = []domain.PriorityLane{
+	{Priority: domain.PriorityHigh, Weight: 2},
+	{Priority: domain.PriorityNormal, Weight: 1},
+}
+
+type harness struct {
+	broker    *memory.Broker
+	storyTask *memory.Task
+	users     *fakeUserRepo
+	repo      *fakeStoryRepo
+	ai        *fakeStoryGenerator
+	mailer    *fakeMailer
+}
+
+// newHarness wires both worker pools and both retry schedulers against an
+// in-memory broker, with no backoff delay so retries are picked up right away.
+func newHarness(t *testing.T, ai *fakeStoryGenerator, mailer *fakeMailer, maxJobRetry int) *harness {
+	t.Helper()
+
+	broker := memory.NewBroker()
+	broker.Backoff = func(retry int) time.Duration { return 0 }
+
+	logger := nopLogger{}
+	users := &fakeUserRepo{}
+	repo := newFakeStoryRepo()
+	storyTask := memory.NewTask(broker, storyGroup)
+	emailTask := memory.NewTask(broker, emailGroup)
+	storyTask.ReadBlock = 10 * time.Millisecond
+	emailTask.ReadBlock = 10 * time.Millisecond
+
+	ctx := context.Background()
+	storyPool := queue.NewWorkerPool(ctx, 2, logger, storyTask,
+		usecase.NewStoryGenerationService(users, repo, ai, logger),
+		usecase.NewStoryGenerationJobCompletion(repo, storyTask, storyStream, emailStream, storyDLQ, logger),
+		storyStream, storyGroup, maxJobRetry, lanes)
+	emailPool := queue.NewWorkerPool(ctx, 2, logger, emailTask,
+		usecase.NewEmailSenderService(users, mailer, logger),
+		usecase.NewEmailNotificationJobCompletion(repo, emailTask, emailStream, emailDLQ, logger),
+		emailStream, emailGroup, maxJobRetry, lanes)
+	storyScheduler := queue.NewShedulerWorkerPool(ctx, 1, logger, fmt.Sprintf("retry_%s", storyStream), storyTask, storyTask, storyStream)
+	emailScheduler := queue.NewShedulerWorkerPool(ctx, 1, logger, fmt.Sprintf("retry_%s", emailStream), emailTask, emailTask, emailStream)
+	storyScheduler.Interval = 10 * time.Millisecond
+	emailScheduler.Interval = 10 * time.Millisecond
+
+	storyPool.Start()
+	emailPool.Start()
+	storyScheduler.Start()
+	emailScheduler.Start()
+
+	t.Cleanup(func() {
+		storyScheduler.Cancel()
+		emailScheduler.Cancel()
+		storyPool.Cancel()
+		emailPool.Cancel()
+		storyScheduler.Wait()
+		emailScheduler.Wait()
+		storyPool.Wait()
+		emailPool.Wait()
+	})
+
+	return &harness{broker: broker, storyTask: storyTask, users: users, repo: repo, ai: ai, mailer: mailer}
+}
+
+func (h *harness) enqueueStory(t *testing.T) int {
+	t.Helper()
+	return h.enqueueStoryWithPriority(t, domain.PriorityNormal)
+}
+
+func (h *harness) enqueueStoryWithPriority(t *testing.T, priority string) int {
+	t.Helper()
+
+	ctx := context.Background()
+	storyID, jobID, _ := h.repo.ScheduleStoryJob(ctx, &domain.Story{FileName: "story-dragons", UserID: 7}, domain.Job{}, storyStream, 10)
+	job := domain.Job{
+		JobID:           jobID,
+		UserID:          7,
+		StoryID:         storyID,
+		UserEmail:       userEmail,
+		UserPreferences: "dragons",
+		RequestID:       "req-1",
+		Priority:        priority,
+	}
+	if err := h.storyTask.Add(ctx, job, domain.PriorityStream(storyStream, priority)); err != nil {
+		t.Fatalf("add story job: %v", err)
+	}
+	return storyID
+}
+
+func eventually(t *testing.T, cond func() bool, format string, args ...any) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf(format, args...)
+}
+
+func last(statuses []string) string {
+	if len(statuses) == 0 {
+		return ""
+	}
+	return statuses[len(statuses)-1]
+}
+
+func count(statuses []string, status string) int {
+	n := 0
+	for _, s := range statuses {
+		if s == status {
+			n++
+		}
+	}
+	return n
+}
+
+func (h *harness) assertDrained(t *testing.T) {
+	t.Helper()
+
+	for _, l := range lanes {
+		story := domain.PriorityStream(storyStream, l.Priority)
+		email := domain.PriorityStream(emailStream, l.Priority)
+		for _, stream := range []string{story, email} {
+			if msgs := h.broker.Messages(stream); len(msgs) != 0 {
+				t.Errorf("%s stream still holds %d messages", stream, len(msgs))
+			}
+		}
+		if ids := h.broker.Pending(story, storyGroup); len(ids) != 0 {
+			t.Errorf("story group still has pending messages %v on %s", ids, story)
+		}
+		if ids := h.broker.Pending(email, emailGroup); len(ids) != 0 {
+			t.Errorf("email group still has pending messages %v on %s", ids, email)
+		}
+	}
+}
+
+func TestWorkerPoolsDeliverStoryAndEmail(t *testing.T) {
+	h := newHarness(t, &fakeStoryGenerator{Story: "once upon a time"}, &fakeMailer{}, 3)
+	storyID := h.enqueueStory(t)
+
+	eventually(t, func() bool { return last(h.repo.EmailStatus(storyID)) == "completed" },
+		"email job never completed, statuses %v", h.repo.EmailStatus(storyID))
+
+	if got := h.repo.StoryStatus(storyID); !slices.Equal(got, []string{"pending", "completed"}) {
+		t.Errorf("story job statuses = %v, want [pending completed]", got)
+	}
+	if got := h.mailer.Sent(); !slices.Equal(got, []string{userEmail}) {
+		t.Errorf("sent emails = %v, want [%s]", got, userEmail)
+	}
+	if got := h.ai.Calls(); got != 1 {
+		t.Errorf("ai calls = %d, want 1", got)
+	}
+	h.assertDrained(t)
+}
+
+// Every run of a user creates its own stories row, so the generated text must
+// land on the story of the job and leave the user's earlier stories alone.
+func TestStoryWorkerPoolUploadsOnlyTheJobsStory(t *testing.T) {
+	h := newHarness(t, &fakeStoryGenerator{Story: "once upon a time"}, &fakeMailer{}, 3)
+	earlier, _ := h.repo.SaveStoryInfo(context.Background(), &domain.Story{FileName: "story-dragons-1", UserID: 7, Story: "an earlier tale"})
+	storyID := h.enqueueStory(t)
+
+	eventually(t, func() bool { return last(h.repo.EmailStatus(storyID)) == "completed" },
+		"email job never completed, statuses %v", h.repo.EmailStatus(storyID))
+
+	if got := h.repo.Story(storyID); got != "once upon a time" {
+		t.Errorf("story %d = %q, want the generated story", storyID, got)
+	}
+	if got := h.repo.Story(earlier); got != "an earlier tale" {
+		t.Errorf("earlier story %d = %q, want it unchanged", earlier, got)
+	}
+	h.assertDrained(t)
+}
+
+func TestWorkerPoolsKeepHighPriorityJobOnItsLane(t *testing.T) {
+	h := newHarness(t, &fakeStoryGenerator{Failures: 1, Story: "once upon a time"}, &fakeMailer{Failures: 1}, 3)
+	storyID := h.enqueueStoryWithPriority(t, domain.PriorityHigh)
+
+	eventually(t, func() bool { return last(h.repo.EmailStatus(storyID)) == "completed" },
+		"email job never completed, statuses %v", h.repo.EmailStatus(storyID))
+
+	if got := h.mailer.Sent(); !slices.Equal(got, []string{userEmail}) {
+		t.Errorf("sent emails = %v, want [%s]", got, userEmail)
+	}
+	h.assertDrained(t)
+}
+
+// A worker waiting for work blocks on every lane at once, so a job on the
+// normal lane is picked up right away even though the high lane stays idle.
+func TestStoryWorkerPoolDoesNotWaitOnIdleHighLane(t *testing.T) {
+	broker := memory.NewBroker()
+	users := &fakeUserRepo{}
+	repo := newFakeStoryRepo()
+	task := memory.NewTask(broker, storyGroup)
+	task.ReadBlock = 5 * time.Second
+
+	ctx := context.Background()
+	pool := queue.NewWorkerPool(ctx, 1, nopLogger{}, task,
+		usecase.NewStoryGenerationService(users, repo, &fakeStoryGenerator{Story: "once upon a time"}, nopLogger{}),
+		usecase.NewStoryGenerationJobCompletion(repo, task, storyStream, emailStream, storyDLQ, nopLogger{}),
+		storyStream, storyGroup, 3, lanes)
+	pool.Start()
+	t.Cleanup(func() {
+		pool.Cancel()
+		pool.Wait()
+	})
+
+	// let the worker settle into its blocking read
+	time.Sleep(50 * time.Millisecond)
+	storyID, jobID, _ := repo.ScheduleStoryJob(ctx, &domain.Story{FileName: "story-dragons", UserID: 7}, domain.Job{}, storyStream, 10)
+	job := domain.Job{JobID: jobID, UserID: 7, StoryID: storyID, UserEmail: userEmail, UserPreferences: "dragons", Priority: domain.PriorityNormal}
+	start := time.Now()
+	if err := task.Add(ctx, job, domain.PriorityStream(storyStream, domain.PriorityNormal)); err != nil {
+		t.Fatalf("add story job: %v", err)
+	}
+
+	eventually(t, func() bool { return last(repo.StoryStatus(storyID)) == "completed" },
+		"story job never completed, statuses %v", repo.StoryStatus(storyID))
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("normal lane job waited %s behind the idle high lane", elapsed)
+	}
+}
+
+func TestStoryWorkerPoolRetriesFailedJob(t *testing.T) {
+	h := newHarness(t, &fakeStoryGenerator{Failures: 2, Story: "once upon a time"}, &fakeMailer{}, 3)
+	storyID := h.enqueueStory(t)
+
+	eventually(t, func() bool { return last(h.repo.EmailStatus(storyID)) == "completed" },
+		"email job never completed, statuses %v", h.repo.EmailStatus(storyID))
+
+	statuses := h.repo.StoryStatus(storyID)
+	if n := count(statuses, "processing"); n != 2 {
+		t.Errorf("story job was marked processing %d times, want 2 (statuses %v)", n, statuses)
+	}
+	if got := last(statuses); got != "completed" {
+		t.Errorf("final story job status = %q, want completed", got)
+	}
+	if got := h.ai.Calls(); got != 3 {
+		t.Errorf("ai calls = %d, want 3", got)
+	}
+	if msgs := h.broker.Messages(storyDLQ); len(msgs) != 0 {
+		t.Errorf("story dlq holds %d messages, want 0", len(msgs))
+	}
+	h.assertDrained(t)
+}
+
+func TestStoryWorkerPoolSendsExhaustedJobToDLQ(t *testing.T) {
+	before := storyJobCounts()
+	h := newHarness(t, &fakeStoryGenerator{Failures: 100}, &fakeMailer{}, 2)
+	storyID := h.enqueueStory(t)
+
+	eventually(t, func() bool { return last(h.repo.StoryStatus(storyID)) == "failed" },
+		"story job never failed, statuses %v", h.repo.StoryStatus(storyID))
+
+	dlq := h.broker.Messages(storyDLQ)
+	if len(dlq) != 1 {
+		t.Fatalf("story dlq holds %d messages, want 1", len(dlq))
+	}
+	if got := dlq[0].Payload.RetryCounts; got != 2 {
+		t.Errorf("dead-lettered job retry count = %d, want 2", got)
+	}
+	if got := h.ai.Calls(); got != 3 {
+		t.Errorf("ai calls = %d, want 3", got)
+	}
+	if got := h.broker.Delayed(fmt.Sprintf("retry_%s", storyStream)); got != 0 {
+		t.Errorf("story retry set holds %d jobs after dead-lettering, want 0", got)
+	}
+	if got := h.mailer.Calls(); got != 0 {
+		t.Errorf("mailer calls = %d, want 0", got)
+	}
+	h.assertDrained(t)
+
+	after := storyJobCounts()
+	want := map[string]float64{
+		observability.JobFailed:       3,
+		observability.JobRetried:      2,
+		observability.JobDeadLettered: 1,
+		observability.JobProcessed:    0,
+	}
+	for outcome, n := range want {
+		if got := after[outcome] - before[outcome]; got != n {
+			t.Errorf("%s story jobs = %v, want %v", outcome, got, n)
+		}
+	}
+}
+
+// A job whose retry count is already past the limit, for example after
+// MaxJobRetry was lowered between deploys, is dead-lettered on its next
+// failure rather than retried forever, and is not also put back for retry.
+func TestStoryWorkerPoolDeadLettersJobPastRetryLimit(t *testing.T) {
+	before := storyJobCounts()
+	h := newHarness(t, &fakeStoryGenerator{Failures: 100}, &fakeMailer{}, 1)
+
+	ctx := context.Background()
+	storyID, jobID, _ := h.repo.ScheduleStoryJob(ctx, &domain.Story{FileName: "story-dragons", UserID: 7}, domain.Job{}, storyStream, 10)
+	job := domain.Job{
+		JobID:           jobID,
+		UserID:          7,
+		StoryID:         storyID,
+		UserEmail:       userEmail,
+		UserPreferences: "dragons",
+		RequestID:       "req-1",
+		Priority:        domain.PriorityNormal,
+		RetryCounts:     3,
+	}
+	if err := h.storyTask.Add(ctx, job, domain.PriorityStream(storyStream, domain.PriorityNormal)); err != nil {
+		t.Fatalf("add story job: %v", err)
+	}
+
+	eventually(t, func() bool { return len(h.broker.Messages(storyDLQ)) == 1 },
+		"story job past the retry limit was never dead-lettered")
+
+	if got := h.ai.Calls(); got != 1 {
+		t.Errorf("ai calls = %d, want 1", got)
+	}
+	if got := h.broker.Delayed(fmt.Sprintf("retry_%s", storyStream)); got != 0 {
+		t.Errorf("story retry set holds %d jobs after dead-lettering, want 0", got)
+	}
+	h.assertDrained(t)
+
+	after := storyJobCounts()
+	want := map[string]float64{
+		observability.JobFailed:       1,
+		observability.JobRetried:      0,
+		observability.JobDeadLettered: 1,
+	}
+	for outcome, n := range want {
+		if got := after[outcome] - before[outcome]; got != n {
+			t.Errorf("%s story jobs = %v, want %v", outcome, got, n)
+		}
+	}
+}
+
+func TestStoryWorkerPoolDropsJobOfDeletedUser(t *testing.T) {
+	before := storyJobCounts()
+	h := newHarness(t, &fakeStoryGenerator{Story: "once upon a time"}, &fakeMailer{}, 3)
+	_ = h.users.DeleteUserByID(context.Background(), 7, domain.DeletedBySelf)
+	h.enqueueStory(t)
+
+	eventually(t, func() bool {
+		return storyJobCounts()[observability.JobCancelled]-before[observability.JobCancelled] == 1
+	},
+		"story job of the deleted user was never cancelled")
+
+	if got := h.ai.Calls(); got != 0 {
+		t.Errorf("ai calls = %d, want 0", got)
+	}
+	if got := h.mailer.Calls(); got != 0 {
+		t.Errorf("mailer calls = %d, want 0", got)
+	}
+	if msgs := h.broker.Messages(storyDLQ); len(msgs) != 0 {
+		t.Errorf("story dlq holds %d messages, want 0", len(msgs))
+	}
+	if got := h.broker.Delayed(fmt.Sprintf("retry_%s", storyStream)); got != 0 {
+		t.Errorf("story retry set holds %d jobs, want 0", got)
+	}
+	h.assertDrained(t)
+}
+
+func storyJobCounts() map[string]float64 {
+	counts := make(map[string]float64)
+	for _, outcome := range []string{observability.JobProcessed, observability.JobFailed, observability.JobRetried, observability.JobDeadLettered, observability.JobCancelled} {
+		counts[outcome] = testutil.ToFloat64(observability.QueueJobs.WithLabelValues(storyStream, outcome))
+	}
+	return counts
+}
+
+func TestEmailWorkerPoolRetriesFailedJob(t *testing.T) {
+	h := newHarness(t, &fakeStoryGenerator{Story: "once upon a time"}, &fakeMailer{Failures: 1}, 3)
+	storyID := h.enqueueStory(t)
+
+	eventually(t, func() bool { return last(h.repo.EmailStatus(storyID)) == "completed" },
+		"email job never completed, statuses %v", h.repo.EmailStatus(storyID))
+
+	if got := h.repo.EmailStatus(storyID); !slices.Equal(got, []string{"pending", "processing", "completed"}) {
+		t.Errorf("email job statuses = %v, want [pending processing completed]", got)
+	}
+	if got := h.mailer.Sent(); !slices.Equal(got, []string{userEmail}) {
+		t.Errorf("sent emails = %v, want [%s]", got, userEmail)
+	}
+	h.assertDrained(t)
+}
+
+func TestEmailWorkerPoolSendsExhaustedJobToDLQ(t *testing.T) {
+	h := newHarness(t, &fakeStoryGenerator{Story: "once upon a time"}, &fakeMailer{Failures: 100}, 1)
+	storyID := h.enqueueStory(t)
+
+	eventually(t, func() bool { return last(h.repo.EmailStatus(storyID)) == "failed" },
+		"email job never failed, statuses %v", h.repo.EmailStatus(storyID))
+
+	if msgs := h.broker.Messages(emailDLQ); len(msgs) != 1 {
+		t.Fatalf("email dlq holds %d messages, want 1", len(msgs))
+	}
+	if got := last(h.repo.StoryStatus(storyID)); got != "completed" {
+		t.Errorf("final story job status = %q, want completed", got)
+	}
+	if got := h.mailer.Calls(); got != 2 {
+		t.Errorf("mailer calls = %d, want 2", got)
+	}
+	h.assertDrained(t)
+}
+
+func TestSchedulerWorkPoolWaitsForBackoff(t *testing.T) {
+	broker := memory.NewBroker()
+	broker.Backoff = func(retry int) time.Duration { return 200 * time.Millisecond }
+	task := memory.NewTask(broker, storyGroup)
+
+	ctx := context.Background()
+	retryQueue := fmt.Sprintf("retry_%s", storyStream)
+	scheduler := queue.NewShedulerWorkerPool(ctx, 1, nopLogger{}, retryQueue, task, task, storyStream)
+	scheduler.Interval = 10 * time.Millisecond
+	scheduler.Start()
+	t.Cleanup(func() {
+		scheduler.Cancel()
+		scheduler.Wait()
+	})
+
+	if err := task.ScheduleRetry(ctx, domain.Job{JobID: 1, RetryCounts: 1}, storyStream); err != nil {
+		t.Fatalf("schedule retry: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if msgs := broker.Messages(storyStream); len(msgs) != 0 {
+		t.Fatalf("job re-enqueued before its backoff elapsed")
+	}
+
+	eventually(t, func() bool { return len(broker.Messages(storyStream)) == 1 },
+		"job was never re-enqueued")
+	if got := broker.Delayed(retryQueue); got != 0 {
+		t.Errorf("retry set holds %d jobs, want 0", got)
+	}
+}
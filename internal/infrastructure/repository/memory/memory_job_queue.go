@@ -0,0 +1,352 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/utils"
+)
+
+type entry struct {
+	seq int64
+	id  string
+	job domain.Job
+}
+
+type pendingEntry struct {
+	consumer    string
+	deliveredAt time.Time
+}
+
+type group struct {
+	lastDelivered int64
+	pending       map[string]pendingEntry
+}
+
+type stream struct {
+	entries []entry
+	groups  map[string]*group
+}
+
+type delayedJob struct {
+	runAt time.Time
+	job   domain.Job
+}
+
+// Broker keeps every stream, consumer group and retry set in process memory.
+// Handlers for different consumer groups share one Broker the same way
+// redis.Task instances share one Redis server.
+type Broker struct {
+	mu      sync.Mutex
+	seq     int64
+	streams map[string]*stream
+	delayed map[string][]delayedJob
+	notify  chan struct{}
+	Backoff func(retry int) time.Duration
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		streams: make(map[string]*stream),
+		delayed: make(map[string][]delayedJob),
+		notify:  make(chan struct{}),
+		Backoff: utils.CalculateBackoffDelay,
+	}
+}
+
+func (b *Broker) getStream(name string) *stream {
+	s, ok := b.streams[name]
+	if !ok {
+		s = &stream{groups: make(map[string]*group)}
+		b.streams[name] = s
+	}
+	return s
+}
+
+// broadcast wakes every blocked Read. Callers must hold b.mu.
+func (b *Broker) broadcast() {
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// Messages returns the entries currently stored in a stream, delivered or not.
+func (b *Broker) Messages(name string) []domain.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[name]
+	if !ok {
+		return nil
+	}
+	messages := make([]domain.Message, 0, len(s.entries))
+	for _, e := range s.entries {
+		messages = append(messages, domain.Message{MessageID: e.id, Payload: e.job})
+	}
+	return messages
+}
+
+// Pending returns the IDs delivered to a consumer group but not yet acked.
+func (b *Broker) Pending(name string, groupName string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[name]
+	if !ok {
+		return nil
+	}
+	g, ok := s.groups[groupName]
+	if !ok {
+		return nil
+	}
+	ids := make([]string, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Delayed returns how many jobs are waiting in a retry set.
+func (b *Broker) Delayed(queue string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.delayed[queue])
+}
+
+type Task struct {
+	Broker    *Broker
+	GroupName string
+	// ReadBlock bounds how long Read waits for a message. Zero blocks until
+	// the context is done.
+	ReadBlock time.Duration
+	// ClaimIdle is how long a delivered message may stay unacked before Read
+	// hands it to another consumer. Zero disables claiming.
+	ClaimIdle time.Duration
+}
+
+func NewTask(broker *Broker, group string) *Task {
+	return &Task{Broker: broker, GroupName: group}
+}
+
+func (t *Task) CreateConsumerGroup(ctx context.Context, name string, groupName string) error {
+	t.Broker.mu.Lock()
+	defer t.Broker.mu.Unlock()
+
+	s := t.Broker.getStream(name)
+	if _, ok := s.groups[groupName]; !ok {
+		s.groups[groupName] = &group{pending: make(map[string]pendingEntry)}
+	}
+	return nil
+}
+
+func (t *Task) Add(ctx context.Context, job domain.Job, name string) error {
+	t.Broker.mu.Lock()
+	defer t.Broker.mu.Unlock()
+
+	t.Broker.seq++
+	s := t.Broker.getStream(name)
+	s.entries = append(s.entries, entry{
+		seq: t.Broker.seq,
+		id:  fmt.Sprintf("%d-0", t.Broker.seq),
+		job: job,
+	})
+	t.Broker.broadcast()
+	return nil
+}
+
+func (t *Task) Read(ctx context.Context, consumerId int, names []string, block bool) (domain.Message, string, error) {
+	consumer := fmt.Sprintf("workerId:%d", consumerId)
+
+	var deadline <-chan time.Time
+	if block && t.ReadBlock > 0 {
+		timer := time.NewTimer(t.ReadBlock)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		t.Broker.mu.Lock()
+		msg, name, err := t.nextAny(names, consumer)
+		notify := t.Broker.notify
+		t.Broker.mu.Unlock()
+
+		if !errors.Is(err, domain.ErrNoMessageFound) {
+			return msg, name, err
+		}
+		if !block {
+			return domain.Message{}, "", err
+		}
+
+		select {
+		case <-ctx.Done():
+			return domain.Message{}, "", domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read from %s streams, consumerID %d", strings.Join(names, ","), consumerId), ctx.Err())
+		case <-deadline:
+			return domain.Message{}, "", domain.ErrNoMessageFound
+		case <-notify:
+		}
+	}
+}
+
+// nextAny tries the streams in order. Callers must hold t.Broker.mu.
+func (t *Task) nextAny(names []string, consumer string) (domain.Message, string, error) {
+	for _, name := range names {
+		msg, ok, err := t.next(name, consumer)
+		if err != nil {
+			return domain.Message{}, "", err
+		}
+		if ok {
+			return msg, name, nil
+		}
+	}
+	return domain.Message{}, "", domain.ErrNoMessageFound
+}
+
+// next hands out the oldest pending entry that has been idle for ClaimIdle,
+// or else the oldest entry the group has not seen yet. Callers must hold
+// t.Broker.mu.
+func (t *Task) next(name string, consumer string) (domain.Message, bool, error) {
+	s, ok := t.Broker.streams[name]
+	if !ok {
+		return domain.Message{}, false, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("stream %s does not exist", name), nil)
+	}
+	g, ok := s.groups[t.GroupName]
+	if !ok {
+		return domain.Message{}, false, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("consumer group %s does not exist for %s stream", t.GroupName, name), nil)
+	}
+
+	now := time.Now()
+	if t.ClaimIdle > 0 {
+		for _, e := range s.entries {
+			p, ok := g.pending[e.id]
+			if !ok || now.Sub(p.deliveredAt) < t.ClaimIdle {
+				continue
+			}
+			g.pending[e.id] = pendingEntry{consumer: consumer, deliveredAt: now}
+			return domain.Message{MessageID: e.id, Payload: e.job}, true, nil
+		}
+	}
+
+	for _, e := range s.entries {
+		if e.seq <= g.lastDelivered {
+			continue
+		}
+		g.lastDelivered = e.seq
+		g.pending[e.id] = pendingEntry{consumer: consumer, deliveredAt: now}
+		return domain.Message{MessageID: e.id, Payload: e.job}, true, nil
+	}
+	return domain.Message{}, false, nil
+}
+
+func (t *Task) Ack(ctx context.Context, messageID string, name string) error {
+	t.Broker.mu.Lock()
+	defer t.Broker.mu.Unlock()
+
+	if s, ok := t.Broker.streams[name]; ok {
+		if g, ok := s.groups[t.GroupName]; ok {
+			delete(g.pending, messageID)
+		}
+	}
+	return nil
+}
+
+func (t *Task) Delete(ctx context.Context, messageID string, name string) error {
+	t.Broker.mu.Lock()
+	defer t.Broker.mu.Unlock()
+
+	s, ok := t.Broker.streams[name]
+	if !ok {
+		return nil
+	}
+	for i, e := range s.entries {
+		if e.id == messageID {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (t *Task) ScheduleRetry(ctx context.Context, job domain.Job, name string) error {
+	t.Broker.mu.Lock()
+	defer t.Broker.mu.Unlock()
+
+	queue := fmt.Sprintf("retry_%s", name)
+	t.Broker.delayed[queue] = append(t.Broker.delayed[queue], delayedJob{
+		runAt: time.Now().Add(t.Broker.Backoff(job.RetryCounts)),
+		job:   job,
+	})
+	return nil
+}
+
+func (t *Task) ReEnqueue(ctx context.Context, queue string, name string) error {
+	t.Broker.mu.Lock()
+	now := time.Now()
+	var due, waiting []delayedJob
+	for _, d := range t.Broker.delayed[queue] {
+		if !d.runAt.After(now) && len(due) < 10 {
+			due = append(due, d)
+			continue
+		}
+		waiting = append(waiting, d)
+	}
+	t.Broker.delayed[queue] = waiting
+	t.Broker.mu.Unlock()
+
+	if len(due) == 0 {
+		return domain.ErrNoMessageFound
+	}
+
+	for _, d := range due {
+		if err := t.Add(ctx, d.job, domain.PriorityStream(name, d.job.Priority)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Task) StreamStats(ctx context.Context, name string, groupName string) (domain.StreamStats, error) {
+	t.Broker.mu.Lock()
+	defer t.Broker.mu.Unlock()
+
+	s, ok := t.Broker.streams[name]
+	if !ok {
+		return domain.StreamStats{}, nil
+	}
+	g, ok := s.groups[groupName]
+	if !ok {
+		return domain.StreamStats{}, nil
+	}
+
+	var stats domain.StreamStats
+	for _, e := range s.entries {
+		if e.seq > g.lastDelivered {
+			stats.Lag++
+		}
+	}
+	stats.Pending = int64(len(g.pending))
+	return stats, nil
+}
+
+func (t *Task) ConsumerGroupExists(ctx context.Context, name string, groupName string) (bool, error) {
+	t.Broker.mu.Lock()
+	defer t.Broker.mu.Unlock()
+
+	s, ok := t.Broker.streams[name]
+	if !ok {
+		return false, nil
+	}
+	_, ok = s.groups[groupName]
+	return ok, nil
+}
+
+func (t *Task) RetrySetSize(ctx context.Context, queue string, name string) (int64, error) {
+	t.Broker.mu.Lock()
+	defer t.Broker.mu.Unlock()
+	return int64(len(t.Broker.delayed[queue])), nil
+}
@@ -0,0 +1,233 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+func TestTaskDeliversToEveryConsumerGroupOnce(t *testing.T) {
+	ctx := context.Background()
+	broker := NewBroker()
+	first := NewTask(broker, "first")
+	second := NewTask(broker, "second")
+
+	if err := first.CreateConsumerGroup(ctx, "jobs", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.CreateConsumerGroup(ctx, "jobs", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Add(ctx, domain.Job{JobID: 1}, "jobs"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, task := range []*Task{first, second} {
+		msg, _, err := task.Read(ctx, 1, []string{"jobs"}, true)
+		if err != nil {
+			t.Fatalf("%s: read: %v", task.GroupName, err)
+		}
+		if msg.Payload.JobID != 1 {
+			t.Errorf("%s: got job %d, want 1", task.GroupName, msg.Payload.JobID)
+		}
+	}
+
+	readCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := first.Read(readCtx, 2, []string{"jobs"}, true); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second read in the same group returned %v, want deadline exceeded", err)
+	}
+}
+
+func TestTaskAckClearsPendingEntry(t *testing.T) {
+	ctx := context.Background()
+	broker := NewBroker()
+	task := NewTask(broker, "group")
+
+	_ = task.CreateConsumerGroup(ctx, "jobs", "group")
+	_ = task.Add(ctx, domain.Job{JobID: 1}, "jobs")
+
+	msg, _, err := task.Read(ctx, 1, []string{"jobs"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := broker.Pending("jobs", "group"); len(got) != 1 || got[0] != msg.MessageID {
+		t.Fatalf("pending = %v, want [%s]", got, msg.MessageID)
+	}
+
+	_ = task.Ack(ctx, msg.MessageID, "jobs")
+	_ = task.Delete(ctx, msg.MessageID, "jobs")
+
+	if got := broker.Pending("jobs", "group"); len(got) != 0 {
+		t.Errorf("pending after ack = %v, want none", got)
+	}
+	if got := broker.Messages("jobs"); len(got) != 0 {
+		t.Errorf("stream after delete holds %d messages, want 0", len(got))
+	}
+}
+
+func TestTaskReadBlocksUntilAdd(t *testing.T) {
+	ctx := context.Background()
+	broker := NewBroker()
+	task := NewTask(broker, "group")
+	_ = task.CreateConsumerGroup(ctx, "jobs", "group")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = task.Add(ctx, domain.Job{JobID: 42}, "jobs")
+	}()
+
+	readCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	msg, _, err := task.Read(readCtx, 1, []string{"jobs"}, true)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if msg.Payload.JobID != 42 {
+		t.Errorf("got job %d, want 42", msg.Payload.JobID)
+	}
+}
+
+func TestTaskReEnqueueOnlyMovesDueJobs(t *testing.T) {
+	ctx := context.Background()
+	broker := NewBroker()
+	broker.Backoff = func(retry int) time.Duration { return time.Duration(retry) * time.Hour }
+	task := NewTask(broker, "group")
+
+	_ = task.ScheduleRetry(ctx, domain.Job{JobID: 1, RetryCounts: 0}, "jobs")
+	_ = task.ScheduleRetry(ctx, domain.Job{JobID: 2, RetryCounts: 1}, "jobs")
+
+	if err := task.ReEnqueue(ctx, "retry_jobs", "jobs"); err != nil {
+		t.Fatalf("re-enqueue: %v", err)
+	}
+	msgs := broker.Messages("jobs")
+	if len(msgs) != 1 || msgs[0].Payload.JobID != 1 {
+		t.Fatalf("stream = %v, want only job 1", msgs)
+	}
+	if got := broker.Delayed("retry_jobs"); got != 1 {
+		t.Errorf("retry set holds %d jobs, want 1", got)
+	}
+	if err := task.ReEnqueue(ctx, "retry_jobs", "jobs"); !errors.Is(err, domain.ErrNoMessageFound) {
+		t.Errorf("second re-enqueue returned %v, want ErrNoMessageFound", err)
+	}
+}
+
+func TestTaskReadBlockReturnsNoMessageFound(t *testing.T) {
+	ctx := context.Background()
+	broker := NewBroker()
+	task := NewTask(broker, "group")
+	task.ReadBlock = 10 * time.Millisecond
+	_ = task.CreateConsumerGroup(ctx, "jobs", "group")
+
+	if _, _, err := task.Read(ctx, 1, []string{"jobs"}, true); !errors.Is(err, domain.ErrNoMessageFound) {
+		t.Errorf("read on empty stream returned %v, want ErrNoMessageFound", err)
+	}
+}
+
+func TestTaskReEnqueueRoutesToPriorityStream(t *testing.T) {
+	ctx := context.Background()
+	broker := NewBroker()
+	broker.Backoff = func(retry int) time.Duration { return 0 }
+	task := NewTask(broker, "group")
+
+	_ = task.ScheduleRetry(ctx, domain.Job{JobID: 1, Priority: domain.PriorityHigh}, "jobs")
+	if err := task.ReEnqueue(ctx, "retry_jobs", "jobs"); err != nil {
+		t.Fatalf("re-enqueue: %v", err)
+	}
+	if msgs := broker.Messages("jobs:high"); len(msgs) != 1 {
+		t.Errorf("high lane holds %d messages, want 1", len(msgs))
+	}
+	if msgs := broker.Messages("jobs"); len(msgs) != 0 {
+		t.Errorf("normal lane holds %d messages, want 0", len(msgs))
+	}
+}
+
+func TestTaskClaimsIdlePendingMessages(t *testing.T) {
+	ctx := context.Background()
+	broker := NewBroker()
+	task := NewTask(broker, "group")
+	task.ReadBlock = 10 * time.Millisecond
+	task.ClaimIdle = 20 * time.Millisecond
+	_ = task.CreateConsumerGroup(ctx, "jobs", "group")
+	_ = task.Add(ctx, domain.Job{JobID: 1}, "jobs")
+
+	first, _, err := task.Read(ctx, 1, []string{"jobs"}, true)
+	if err != nil {
+		t.Fatalf("first read: %v", err)
+	}
+	if _, _, err := task.Read(ctx, 2, []string{"jobs"}, true); !errors.Is(err, domain.ErrNoMessageFound) {
+		t.Fatalf("read before the idle time returned %v, want ErrNoMessageFound", err)
+	}
+
+	time.Sleep(task.ClaimIdle)
+	claimed, _, err := task.Read(ctx, 2, []string{"jobs"}, true)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if claimed.MessageID != first.MessageID {
+		t.Errorf("claimed %s, want %s", claimed.MessageID, first.MessageID)
+	}
+}
+
+func TestTaskReadTriesStreamsInOrder(t *testing.T) {
+	ctx := context.Background()
+	broker := NewBroker()
+	task := NewTask(broker, "group")
+	_ = task.CreateConsumerGroup(ctx, "jobs", "group")
+	_ = task.CreateConsumerGroup(ctx, "jobs:high", "group")
+	_ = task.Add(ctx, domain.Job{JobID: 1}, "jobs")
+	_ = task.Add(ctx, domain.Job{JobID: 2}, "jobs:high")
+
+	msg, stream, err := task.Read(ctx, 1, []string{"jobs:high", "jobs"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream != "jobs:high" || msg.Payload.JobID != 2 {
+		t.Errorf("read job %d from %s, want job 2 from jobs:high", msg.Payload.JobID, stream)
+	}
+}
+
+func TestTaskReadWithoutBlockReturnsRightAway(t *testing.T) {
+	ctx := context.Background()
+	broker := NewBroker()
+	task := NewTask(broker, "group")
+	task.ReadBlock = time.Second
+	_ = task.CreateConsumerGroup(ctx, "jobs", "group")
+
+	start := time.Now()
+	if _, _, err := task.Read(ctx, 1, []string{"jobs"}, false); !errors.Is(err, domain.ErrNoMessageFound) {
+		t.Errorf("read on empty stream returned %v, want ErrNoMessageFound", err)
+	}
+	if elapsed := time.Since(start); elapsed >= task.ReadBlock {
+		t.Errorf("non-blocking read took %s", elapsed)
+	}
+}
+
+func TestTaskBlockingReadWakesOnAnyStream(t *testing.T) {
+	ctx := context.Background()
+	broker := NewBroker()
+	task := NewTask(broker, "group")
+	task.ReadBlock = 5 * time.Second
+	_ = task.CreateConsumerGroup(ctx, "jobs", "group")
+	_ = task.CreateConsumerGroup(ctx, "jobs:high", "group")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = task.Add(ctx, domain.Job{JobID: 1}, "jobs")
+	}()
+
+	start := time.Now()
+	msg, stream, err := task.Read(ctx, 1, []string{"jobs:high", "jobs"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream != "jobs" || msg.Payload.JobID != 1 {
+		t.Errorf("read job %d from %s, want job 1 from jobs", msg.Payload.JobID, stream)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("blocking read waited %s on the idle high lane", elapsed)
+	}
+}
@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AccountDataRepo struct {
+	Db *pgxpool.Pool
+}
+
+func NewAccountDataRepo(db *pgxpool.Pool) *AccountDataRepo {
+	return &AccountDataRepo{db}
+}
+
+// ExportUserData reads everything in one repeatable-read transaction, so the
+// export is a consistent snapshot even while jobs are running.
+func (r *AccountDataRepo) ExportUserData(ctx context.Context, userID int) (*domain.UserExport, error) {
+	tx, err := r.Db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to begin transaction", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	export := domain.UserExport{ExportedAt: time.Now().UTC(), Preferences: []string{}}
+
+	query := `select id, first_name, last_name, email, plan, role, created_at from users where id = $1 and deleted_at is null`
+	p := &export.Profile
+	err = tx.QueryRow(ctx, query, userID).Scan(&p.ID, &p.FirstName, &p.LastName, &p.Email, &p.Plan, &p.Role, &p.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+
+	query = `select preferences from users_preferences where user_id = $1`
+	err = tx.QueryRow(ctx, query, userID).Scan(&export.Preferences)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+
+	query = `select id, file_name, story, created_at from stories where user_id = $1 order by id`
+	if export.Stories, err = collect[domain.ExportedStory](ctx, tx, query, userID); err != nil {
+		return nil, err
+	}
+
+	query = `
+	select sj.id, sj.story_id, sj.status::text
+	from story_jobs sj join stories s on s.id = sj.story_id
+	where s.user_id = $1
+	order by sj.id`
+	if export.StoryJobs, err = collect[domain.ExportedJob](ctx, tx, query, userID); err != nil {
+		return nil, err
+	}
+
+	query = `select id, story_id, status::text from email_jobs where user_id = $1 order by id`
+	if export.EmailJobs, err = collect[domain.ExportedJob](ctx, tx, query, userID); err != nil {
+		return nil, err
+	}
+
+	query = `select ` + scheduleColumns + ` from story_schedules where user_id = $1 order by id`
+	rows, err := tx.Query(ctx, query, userID)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	defer rows.Close()
+	export.Schedules = []domain.StorySchedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to scan schedule", err)
+		}
+		export.Schedules = append(export.Schedules, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+
+	return &export, nil
+}
+
+func collect[T any](ctx context.Context, tx pgx.Tx, query string, args ...any) ([]T, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByPos[T])
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to scan rows", err)
+	}
+	return items, nil
+}
+
+// PurgeDeletedUsers hard-deletes the users; stories, jobs, schedules and
+// tokens go with them through ON DELETE CASCADE. SKIP LOCKED lets several
+// schedulers purge side by side.
+func (r *AccountDataRepo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) ([]int, error) {
+	query := `
+	delete from users where id in (
+		select id from users
+		where deleted_at < $1
+		order by deleted_at
+		limit $2
+		for update skip locked)
+	returning id`
+
+	rows, err := r.Db.Query(ctx, query, deletedBefore, limit)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to purge deleted users", err)
+	}
+	return ids, nil
+}
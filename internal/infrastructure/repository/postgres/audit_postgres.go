@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuditRepo struct {
+	Db *pgxpool.Pool
+}
+
+func NewAuditRepo(db *pgxpool.Pool) *AuditRepo {
+	return &AuditRepo{db}
+}
+
+func (r *AuditRepo) RecordAuditEvent(ctx context.Context, e domain.AuditEvent) error {
+	metadata, err := json.Marshal(e.Metadata)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to marshal audit metadata", err)
+	}
+	if e.Metadata == nil {
+		metadata = []byte("{}")
+	}
+
+	query := `
+	insert into audit_events
+		(event_type, outcome, actor_id, user_id, request_id, client_ip, metadata)
+		values ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = r.Db.Exec(ctx, query, e.EventType, e.Outcome, e.ActorID, e.UserID, e.RequestID, e.ClientIP, metadata)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return nil
+}
+
+func (r *AuditRepo) ListAuditEvents(ctx context.Context, f domain.AuditFilter) ([]domain.AuditEvent, error) {
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if f.UserID != nil {
+		where("user_id = $%d", *f.UserID)
+	}
+	if f.EventType != "" {
+		where("event_type = $%d", f.EventType)
+	}
+	if !f.From.IsZero() {
+		where("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		where("created_at < $%d", f.To)
+	}
+	if f.BeforeID > 0 {
+		where("id < $%d", f.BeforeID)
+	}
+
+	query := `select id, event_type, outcome, actor_id, user_id, request_id, client_ip, metadata, created_at from audit_events`
+	if len(conditions) > 0 {
+		query += ` where ` + strings.Join(conditions, " and ")
+	}
+	args = append(args, f.Limit)
+	query += fmt.Sprintf(` order by id desc limit $%d`, len(args))
+
+	rows, err := r.Db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	defer rows.Close()
+
+	var events []domain.AuditEvent
+	for rows.Next() {
+		var e domain.AuditEvent
+		var metadata []byte
+		if err := rows.Scan(&e.ID, &e.EventType, &e.Outcome, &e.ActorID, &e.UserID, &e.RequestID, &e.ClientIP, &metadata, &e.CreatedAt); err != nil {
+			return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+		}
+		if err := json.Unmarshal(metadata, &e.Metadata); err != nil {
+			return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to unmarshal audit metadata", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type IdentityRepo struct {
+	Db *pgxpool.Pool
+}
+
+func NewIdentityRepo(db *pgxpool.Pool) *IdentityRepo {
+	return &IdentityRepo{db}
+}
+
+func (r *IdentityRepo) GetUserIDByIdentity(ctx context.Context, provider string, subject string) (int, error) {
+	var userID int
+
+	query := `
+	update user_identities i set last_login_at = now()
+	from users u
+	where i.provider = $1 and i.subject = $2 and u.id = i.user_id and u.deleted_at is null
+	returning i.user_id`
+	err := r.Db.QueryRow(ctx, query, provider, subject).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, domain.ErrIdentityNotFound
+	}
+	if err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return userID, nil
+}
+
+func (r *IdentityRepo) LinkIdentity(ctx context.Context, userID int, identity domain.ExternalIdentity) error {
+	query := `insert into user_identities (user_id, provider, subject, email) values ($1, $2, $3, $4)`
+
+	_, err := r.Db.Exec(ctx, query, userID, identity.Provider, identity.Subject, identity.Email)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return domain.ErrIdentityLinked
+	}
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to link identity", err)
+	}
+	return nil
+}
+
+func (r *IdentityRepo) CreateUserWithIdentity(ctx context.Context, identity domain.ExternalIdentity) (int, error) {
+	tx, err := r.Db.Begin(ctx)
+	if err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeInternal, "failed to begin transaction", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var userID int
+	// an empty password never matches a bcrypt hash, password login stays
+	// impossible until the user sets one
+	query := `insert into users (first_name, last_name, email, password) values ($1, $2, $3, '') returning id`
+	err = tx.QueryRow(ctx, query, identity.FirstName, identity.LastName, identity.Email).Scan(&userID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return 0, domain.ErrEmailTaken
+	}
+	if err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeInternal, "failed to create user", err)
+	}
+
+	if _, err = tx.Exec(ctx, `insert into users_preferences (user_id, preferences) values ($1, '[]'::jsonb)`, userID); err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeInternal, "failed to create user preferences", err)
+	}
+
+	query = `insert into user_identities (user_id, provider, subject, email) values ($1, $2, $3, $4)`
+	_, err = tx.Exec(ctx, query, userID, identity.Provider, identity.Subject, identity.Email)
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return 0, domain.ErrIdentityLinked
+	}
+	if err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeInternal, "failed to link identity", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeInternal, "failed to commit transaction", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type MFARepo struct {
+	Db *pgxpool.Pool
+}
+
+func NewMFARepo(db *pgxpool.Pool) *MFARepo {
+	return &MFARepo{db}
+}
+
+func (r *MFARepo) SaveMFAEnrollment(ctx context.Context, userID int, secret []byte, recoveryCodes []string) error {
+	query := `
+	insert into users_mfa (user_id, secret, recovery_codes) values ($1, $2, $3)
+	on conflict (user_id) do update set secret = excluded.secret, recovery_codes = excluded.recovery_codes, last_totp_step = null, created_at = now()
+	where users_mfa.enabled_at is null`
+
+	tag, err := r.Db.Exec(ctx, query, userID, secret, recoveryCodes)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to save mfa enrollment", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+func (r *MFARepo) GetMFA(ctx context.Context, userID int) (*domain.MFA, error) {
+	m := domain.MFA{UserID: userID}
+
+	query := `select secret, recovery_codes, enabled_at, last_totp_step from users_mfa where user_id = $1`
+	err := r.Db.QueryRow(ctx, query, userID).Scan(&m.Secret, &m.RecoveryCodes, &m.EnabledAt, &m.LastTOTPStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return &m, nil
+}
+
+func (r *MFARepo) EnableMFA(ctx context.Context, userID int) error {
+	query := `update users_mfa set enabled_at = now() where user_id = $1 and enabled_at is null`
+
+	tag, err := r.Db.Exec(ctx, query, userID)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to enable mfa", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+func (r *MFARepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	query := `
+	update users_mfa set recovery_codes = array_remove(recovery_codes, $2)
+	where user_id = $1 and $2 = any(recovery_codes)`
+
+	tag, err := r.Db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to use recovery code", err)
+	}
+	// a concurrent login used the same code first
+	if tag.RowsAffected() == 0 {
+		return domain.ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (r *MFARepo) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	query := `
+	update users_mfa set last_totp_step = $2
+	where user_id = $1 and (last_totp_step is null or last_totp_step < $2)`
+
+	tag, err := r.Db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to use totp step", err)
+	}
+	// the code, or a later one, was already used
+	if tag.RowsAffected() == 0 {
+		return domain.ErrInvalidMFACode
+	}
+	return nil
+}
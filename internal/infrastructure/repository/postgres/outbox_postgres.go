@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Payload struct {
+	JobID           int               `json:"job_id"`
+	UserID          int               `json:"user_id"`
+	StoryID         int               `json:"story_id"`
+	UserEmail       string            `json:"user_email"`
+	UserPreferences string            `json:"user_preferences"`
+	RetryCounts     int               `json:"retry_counts"`
+	RequestID       string            `json:"request_id"`
+	Priority        string            `json:"priority"`
+	TraceContext    map[string]string `json:"trace_context,omitempty"`
+}
+
+func NewPayload(job domain.Job) Payload {
+	return Payload{
+		JobID:           job.JobID,
+		UserID:          job.UserID,
+		StoryID:         job.StoryID,
+		UserEmail:       job.UserEmail,
+		UserPreferences: job.UserPreferences,
+		RetryCounts:     job.RetryCounts,
+		RequestID:       job.RequestID,
+		Priority:        job.Priority,
+		TraceContext:    job.TraceContext,
+	}
+}
+
+func (p Payload) Job() domain.Job {
+	return domain.Job{
+		JobID:           p.JobID,
+		UserID:          p.UserID,
+		StoryID:         p.StoryID,
+		UserEmail:       p.UserEmail,
+		UserPreferences: p.UserPreferences,
+		RetryCounts:     p.RetryCounts,
+		RequestID:       p.RequestID,
+		Priority:        p.Priority,
+		TraceContext:    p.TraceContext,
+	}
+}
+
+type OutboxRepo struct {
+	Db *pgxpool.Pool
+}
+
+func NewOutboxRepo(db *pgxpool.Pool) *OutboxRepo {
+	return &OutboxRepo{db}
+}
+
+func insertOutbox(ctx context.Context, tx pgx.Tx, stream string, job domain.Job) error {
+	payload, err := json.Marshal(NewPayload(job))
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to marshal outbox payload", err)
+	}
+
+	query := `insert into outbox (stream, payload) values ($1, $2) returning id`
+
+	var returnedID int
+	row := tx.QueryRow(ctx, query, stream, payload)
+	err = row.Scan(&returnedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.ErrPersistOutbox
+	}
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return nil
+}
+
+func (o *OutboxRepo) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]domain.OutboxMessage, error) {
+	query := `
+	UPDATE outbox
+	SET
+		locked_until = NOW() + make_interval(secs => $2),
+		attempts = attempts + 1
+	WHERE id IN (
+		SELECT id
+		FROM outbox
+		WHERE sent_at IS NULL
+		  AND (locked_until IS NULL OR locked_until < NOW())
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, stream, payload;
+	`
+
+	rows, err := o.Db.Query(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	defer rows.Close()
+
+	var messages []domain.OutboxMessage
+	for rows.Next() {
+		var (
+			msg     domain.OutboxMessage
+			raw     []byte
+			payload Payload
+		)
+		if err := rows.Scan(&msg.ID, &msg.Stream, &raw); err != nil {
+			return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to scan outbox row", err)
+		}
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to unmarshal outbox payload", err)
+		}
+		msg.Payload = payload.Job()
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+
+	return messages, nil
+}
+
+// MarkSent deletes the row once it is published; its payload carries the
+// user's email and preferences, which must not outlive the account.
+func (o *OutboxRepo) MarkSent(ctx context.Context, id int) error {
+	query := `DELETE FROM outbox WHERE id = $1 RETURNING id`
+
+	var returnedID int
+	row := o.Db.QueryRow(ctx, query, id)
+	err := row.Scan(&returnedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.ErrOutboxMessageNotFound
+	}
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Task struct {
+	Db                *pgxpool.Pool
+	GroupName         string
+	VisibilityTimeout time.Duration
+	PollInterval      time.Duration
+	ReadBlock         time.Duration
+	DeadLetterStreams []string
+}
+
+func NewTask(db *pgxpool.Pool, group string, visibilityTimeout, pollInterval, readBlock time.Duration, deadLetterStreams ...string) *Task {
+	return &Task{
+		Db:                db,
+		GroupName:         group,
+		VisibilityTimeout: visibilityTimeout,
+		PollInterval:      pollInterval,
+		ReadBlock:         readBlock,
+		DeadLetterStreams: deadLetterStreams,
+	}
+}
+
+// CreateConsumerGroup is a no-op: every stream lives in the same table and
+// rows are handed out to one consumer at a time through row locks.
+func (t *Task) CreateConsumerGroup(ctx context.Context, stream string, group string) error {
+	return nil
+}
+
+func (t *Task) Add(ctx context.Context, job domain.Job, stream string) error {
+	return t.insert(ctx, job, stream, 0)
+}
+
+// insert computes run_at from the database clock, like claim does for
+// locked_until, so the comparison against NOW() never depends on the
+// session time zone.
+func (t *Task) insert(ctx context.Context, job domain.Job, stream string, delay time.Duration) error {
+	payload, err := json.Marshal(NewPayload(job))
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, fmt.Sprintf("failed to marshal for %s stream, jobID %d, RequestID %s", stream, job.JobID, job.RequestID), err)
+	}
+
+	var returnedID int64
+	if slices.Contains(t.DeadLetterStreams, stream) {
+		query := `insert into job_dead_letters (stream, payload) values ($1, $2) returning id`
+		err = t.Db.QueryRow(ctx, query, stream, payload).Scan(&returnedID)
+	} else {
+		query := `insert into job_queue (stream, payload, run_at) values ($1, $2, NOW() + make_interval(secs => $3)) returning id`
+		err = t.Db.QueryRow(ctx, query, stream, payload, delay.Seconds()).Scan(&returnedID)
+	}
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to add to %s stream, jobID %d, RequestID %s", stream, job.JobID, job.RequestID), err)
+	}
+	return nil
+}
+
+// Read polls the streams, in order, until a message is ready. With a
+// ReadBlock set it gives up after that long and returns
+// domain.ErrNoMessageFound; without block it makes a single pass.
+func (t *Task) Read(ctx context.Context, consumerId int, streams []string, block bool) (domain.Message, string, error) {
+	ticker := time.NewTicker(t.PollInterval)
+	defer ticker.Stop()
+
+	var deadline <-chan time.Time
+	if block && t.ReadBlock > 0 {
+		timer := time.NewTimer(t.ReadBlock)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		for _, stream := range streams {
+			msg, err := t.claim(ctx, consumerId, stream)
+			if err == nil {
+				return msg, stream, nil
+			}
+			if !errors.Is(err, domain.ErrNoMessageFound) {
+				return domain.Message{}, "", err
+			}
+		}
+		if !block {
+			return domain.Message{}, "", domain.ErrNoMessageFound
+		}
+
+		select {
+		case <-ctx.Done():
+			return domain.Message{}, "", domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read from %s streams, consumerID %d", strings.Join(streams, ","), consumerId), ctx.Err())
+		case <-deadline:
+			return domain.Message{}, "", domain.ErrNoMessageFound
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Task) claim(ctx context.Context, consumerId int, stream string) (domain.Message, error) {
+	query := `
+	UPDATE job_queue
+	SET
+		locked_until = NOW() + make_interval(secs => $3),
+		locked_by = $2
+	WHERE id = (
+		SELECT id
+		FROM job_queue
+		WHERE stream = $1
+		  AND acked_at IS NULL
+		  AND run_at <= NOW()
+		  AND (locked_until IS NULL OR locked_until < NOW())
+		ORDER BY run_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, payload;
+	`
+
+	var (
+		id      int64
+		raw     []byte
+		payload Payload
+	)
+	consumer := fmt.Sprintf("%s:workerId:%d", t.GroupName, consumerId)
+	row := t.Db.QueryRow(ctx, query, stream, consumer, t.VisibilityTimeout.Seconds())
+	err := row.Scan(&id, &raw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.Message{}, domain.ErrNoMessageFound
+	}
+	if err != nil {
+		return domain.Message{}, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read from %s stream, consumerID %d", stream, consumerId), err)
+	}
+
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return domain.Message{}, domain.NewDomainError(
+			domain.ErrCodeInternal,
+			fmt.Sprintf("failed to unmarshal for %s", stream),
+			err,
+		)
+	}
+
+	return domain.Message{MessageID: strconv.FormatInt(id, 10), Payload: payload.Job()}, nil
+}
+
+func (t *Task) Ack(ctx context.Context, messageID string, stream string) error {
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeValidation, fmt.Sprintf("invalid messageID %s for %s stream", messageID, stream), err)
+	}
+
+	query := `UPDATE job_queue SET acked_at = NOW(), locked_until = NULL WHERE id = $1 AND stream = $2`
+	if _, err := t.Db.Exec(ctx, query, id, stream); err != nil {
+		return domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to ack for %s stream and messageID %s", stream, messageID), err)
+	}
+	return nil
+}
+
+func (t *Task) Delete(ctx context.Context, messageID string, stream string) error {
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeValidation, fmt.Sprintf("invalid messageID %s for %s stream", messageID, stream), err)
+	}
+
+	query := `DELETE FROM job_queue WHERE id = $1 AND stream = $2`
+	if _, err := t.Db.Exec(ctx, query, id, stream); err != nil {
+		return domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to delete message from %s stream and messageID %s", stream, messageID), err)
+	}
+	return nil
+}
+
+// ScheduleRetry puts the job straight back on its priority stream with a
+// future run_at, so Read skips it until the backoff delay has passed.
+func (t *Task) ScheduleRetry(ctx context.Context, job domain.Job, stream string) error {
+	delay := utils.CalculateBackoffDelay(job.RetryCounts)
+	if err := t.insert(ctx, job, domain.PriorityStream(stream, job.Priority), delay); err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, fmt.Sprintf("failed to schedule for %s stream and jobID %d, RequestID %s", stream, job.JobID, job.RequestID), err)
+	}
+	return nil
+}
+
+// ReEnqueue has nothing to move: delayed retries become visible to Read on
+// their own once run_at has passed.
+func (t *Task) ReEnqueue(ctx context.Context, queue string, stream string) error {
+	return domain.ErrNoMessageFound
+}
+
+// StreamStats counts ready rows as lag and leased rows as pending. The group
+// is ignored because the table has a single consumer group per stream.
+func (t *Task) StreamStats(ctx context.Context, stream string, group string) (domain.StreamStats, error) {
+	query := `
+	SELECT
+		COUNT(*) FILTER (WHERE run_at <= NOW() AND (locked_until IS NULL OR locked_until < NOW())),
+		COUNT(*) FILTER (WHERE locked_until >= NOW())
+	FROM job_queue
+	WHERE stream = $1 AND acked_at IS NULL;
+	`
+
+	var stats domain.StreamStats
+	if err := t.Db.QueryRow(ctx, query, stream).Scan(&stats.Lag, &stats.Pending); err != nil {
+		return domain.StreamStats{}, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read stats of %s stream", stream), err)
+	}
+	return stats, nil
+}
+
+// ConsumerGroupExists checks that job_queue is there. Postgres has no
+// consumer groups: every consumer reads the table directly.
+func (t *Task) ConsumerGroupExists(ctx context.Context, stream string, group string) (bool, error) {
+	var exists bool
+	if err := t.Db.QueryRow(ctx, `SELECT to_regclass('job_queue') IS NOT NULL`).Scan(&exists); err != nil {
+		return false, domain.NewDomainError(domain.ErrCodeExternal, "failed to look up the job_queue table", err)
+	}
+	return exists, nil
+}
+
+// RetrySetSize counts the rows of both priority lanes whose run_at is still in
+// the future. Retries live in job_queue itself, so queue is ignored.
+func (t *Task) RetrySetSize(ctx context.Context, queue string, stream string) (int64, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM job_queue
+	WHERE stream = ANY($1) AND run_at > NOW() AND acked_at IS NULL;
+	`
+
+	streams := []string{stream, domain.PriorityStream(stream, domain.PriorityHigh)}
+	var size int64
+	if err := t.Db.QueryRow(ctx, query, streams).Scan(&size); err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read retry size of %s stream", stream), err)
+	}
+	return size, nil
+}
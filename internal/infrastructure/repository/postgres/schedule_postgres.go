@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ScheduleRepo struct {
+	Db *pgxpool.Pool
+}
+
+func NewScheduleRepo(db *pgxpool.Pool) *ScheduleRepo {
+	return &ScheduleRepo{db}
+}
+
+const scheduleColumns = `id, user_id, cron_expr, time_zone, missed_run_policy, enabled, next_run_at, last_run_at`
+
+func scanSchedule(row pgx.Row) (*domain.StorySchedule, error) {
+	var s domain.StorySchedule
+	err := row.Scan(&s.ID, &s.UserID, &s.CronExpr, &s.TimeZone, &s.MissedRunPolicy, &s.Enabled, &s.NextRunAt, &s.LastRunAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *ScheduleRepo) CreateSchedule(ctx context.Context, s *domain.StorySchedule) (int, error) {
+	query := `
+	insert into story_schedules
+		(user_id, cron_expr, time_zone, missed_run_policy, enabled, next_run_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+
+	var returnedID int
+	row := r.Db.QueryRow(ctx, query, s.UserID, s.CronExpr, s.TimeZone, s.MissedRunPolicy, s.Enabled, s.NextRunAt)
+	err := row.Scan(&returnedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, domain.ErrPersistSchedule
+	}
+	if err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return returnedID, nil
+}
+
+func (r *ScheduleRepo) GetSchedule(ctx context.Context, userID, id int) (*domain.StorySchedule, error) {
+	query := `select ` + scheduleColumns + ` from story_schedules where id = $1 and user_id = $2`
+
+	s, err := scanSchedule(r.Db.QueryRow(ctx, query, id, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return s, nil
+}
+
+func (r *ScheduleRepo) ListSchedules(ctx context.Context, userID int) ([]domain.StorySchedule, error) {
+	query := `select ` + scheduleColumns + ` from story_schedules where user_id = $1 order by id`
+	return r.list(ctx, query, userID)
+}
+
+func (r *ScheduleRepo) UpdateSchedule(ctx context.Context, s *domain.StorySchedule) error {
+	query := `
+	update story_schedules
+	set cron_expr = $1, time_zone = $2, missed_run_policy = $3, enabled = $4, next_run_at = $5, updated_at = NOW()
+	where id = $6 and user_id = $7
+	returning id`
+
+	var returnedID int
+	row := r.Db.QueryRow(ctx, query, s.CronExpr, s.TimeZone, s.MissedRunPolicy, s.Enabled, s.NextRunAt, s.ID, s.UserID)
+	err := row.Scan(&returnedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.ErrScheduleNotFound
+	}
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return nil
+}
+
+func (r *ScheduleRepo) DeleteSchedule(ctx context.Context, userID, id int) error {
+	query := `delete from story_schedules where id = $1 and user_id = $2 returning id`
+
+	var returnedID int
+	err := r.Db.QueryRow(ctx, query, id, userID).Scan(&returnedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.ErrScheduleNotFound
+	}
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return nil
+}
+
+func (r *ScheduleRepo) ListDueSchedules(ctx context.Context, now time.Time, limit int) ([]domain.StorySchedule, error) {
+	query := `
+	select ` + scheduleColumns + `
+	from story_schedules
+	where enabled and next_run_at <= $1
+	and user_id in (select id from users where deleted_at is null)
+	order by next_run_at
+	limit $2`
+	return r.list(ctx, query, now, limit)
+}
+
+func (r *ScheduleRepo) MarkScheduleRun(ctx context.Context, id int, lastRunAt, nextRunAt time.Time) error {
+	query := `update story_schedules set last_run_at = $1, next_run_at = $2, updated_at = NOW() where id = $3`
+
+	tag, err := r.Db.Exec(ctx, query, lastRunAt, nextRunAt, id)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrScheduleNotFound
+	}
+	return nil
+}
+
+func (r *ScheduleRepo) list(ctx context.Context, query string, args ...any) ([]domain.StorySchedule, error) {
+	rows, err := r.Db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	defer rows.Close()
+
+	schedules := []domain.StorySchedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to scan schedule", err)
+		}
+		schedules = append(schedules, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return schedules, nil
+}
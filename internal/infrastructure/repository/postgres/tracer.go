@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// queryTracer opens a client span for every query run on the pool.
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = observability.Tracer().Start(ctx, spanName(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.query.text", strings.TrimSpace(data.SQL)),
+		))
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("db.response.affected_rows", data.CommandTag.RowsAffected()))
+	observability.EndSpan(span, data.Err)
+}
+
+// spanName is the operation of the statement, e.g. "postgres SELECT", so
+// span names stay low-cardinality.
+func spanName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "postgres"
+	}
+	return "postgres " + strings.ToUpper(fields[0])
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -57,7 +58,13 @@ func NewRefreshTokenRepo(db *pgxpool.Pool) *RefreshTokenRepo {
 }
 
 func OpenDatabaseConnPool(dsn string) (*pgxpool.Pool, error) {
-	pool, err := pgxpool.New(context.Background(), dsn)
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, domain.ErrDbConnection
+	}
+	config.ConnConfig.Tracer = queryTracer{}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		return nil, domain.ErrDbConnection
 	}
@@ -73,29 +80,52 @@ func OpenDatabaseConn(dsn string) (*pgx.Conn, error) {
 	return conn, nil
 }
 
-func (u *UserRepo) DeleteUserByID(ctx context.Context, id int) error {
+// DeleteUserByID soft-deletes the user and, in the same transaction, cancels
+// its story and email jobs that have not finished yet, so they no longer
+// count as active and show up as cancelled rather than stuck in pending.
+func (u *UserRepo) DeleteUserByID(ctx context.Context, id int, deletedBy string) error {
+	tx, err := u.Db.Begin(ctx)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to begin transaction", err)
+	}
+	defer tx.Rollback(ctx)
 
 	var returnedID int
 
-	query := `delete from users where id = $1 returning id`
-	row := u.Db.QueryRow(ctx, query, id)
-	err := row.Scan(&returnedID)
+	query := `update users set deleted_at = now(), deleted_by = $2, updated_at = now() where id = $1 and deleted_at is null returning id`
+	err = tx.QueryRow(ctx, query, id, deletedBy).Scan(&returnedID)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return domain.ErrUserNotFound
 	}
 	if err != nil {
 		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
 	}
-	return nil
 
+	storyJobsQuery := `
+	update story_jobs set status = 'cancelled'
+	where status in ('pending', 'processing')
+	and story_id in (select id from stories where user_id = $1)`
+	if _, err := tx.Exec(ctx, storyJobsQuery, id); err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to cancel story jobs", err)
+	}
+
+	emailJobsQuery := `update email_jobs set status = 'cancelled' where user_id = $1 and status in ('pending', 'processing')`
+	if _, err := tx.Exec(ctx, emailJobsQuery, id); err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to cancel email jobs", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to commit transaction", err)
+	}
+	return nil
 }
 
 func (u *UserRepo) GetUserByID(ctx context.Context, id int) (*domain.User, error) {
 	var user domain.User
 
-	query := `select id, first_name, last_name, email from users where id=$1`
+	query := `select id, first_name, last_name, email, password, plan, role, created_at, updated_at from users where id=$1 and deleted_at is null`
 	row := u.Db.QueryRow(ctx, query, id)
-	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email)
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Plan, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, domain.ErrUserNotFound
 	}
@@ -109,9 +139,9 @@ func (u *UserRepo) GetUserByID(ctx context.Context, id int) (*domain.User, error
 func (u *UserRepo) GetUserPreferencesByID(ctx context.Context, id int) (*domain.Preferences, error) {
 	var user domain.Preferences
 
-	query := `select id, user_id, preferences from users_preferences where user_id=$1`
+	query := `select id, user_id, preferences, updated_at from users_preferences where user_id=$1`
 	row := u.Db.QueryRow(ctx, query, id)
-	err := row.Scan(&user.ID, &user.UserID, &user.UserPreferences)
+	err := row.Scan(&user.ID, &user.UserID, &user.UserPreferences, &user.UpdatedAt)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, domain.ErrUserNotFound
 	}
@@ -125,9 +155,9 @@ func (u *UserRepo) GetUserPreferencesByID(ctx context.Context, id int) (*domain.
 func (u *UserRepo) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user domain.User
 
-	query := `select id, first_name, last_name, email, password from users where email=$1`
+	query := `select id, first_name, last_name, email, password, role from users where email=$1 and deleted_at is null`
 	row := u.Db.QueryRow(ctx, query, email)
-	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password)
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Role)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, domain.ErrEmailNotFound
 	}
@@ -137,6 +167,99 @@ func (u *UserRepo) GetUserByEmail(ctx context.Context, email string) (*domain.Us
 	return &user, nil
 }
 
+func (u *UserRepo) GetDeletedUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	var user domain.User
+
+	query := `select id, first_name, last_name, email, password, role, deleted_at, coalesce(deleted_by, '') from users where email=$1 and deleted_at is not null`
+	row := u.Db.QueryRow(ctx, query, email)
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Role, &user.DeletedAt, &user.DeletedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrEmailNotFound
+	}
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return &user, nil
+}
+
+func (u *UserRepo) RestoreUserByID(ctx context.Context, id int) error {
+	query := `update users set deleted_at = null, deleted_by = null, updated_at = now() where id = $1 and deleted_at is not null`
+	tag, err := u.Db.Exec(ctx, query, id)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (u *UserRepo) UpdateUserRole(ctx context.Context, id int, role string) error {
+	query := `update users set role=$2, updated_at=now() where id=$1 and deleted_at is null`
+	tag, err := u.Db.Exec(ctx, query, id, role)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to update user role", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (u *UserRepo) UpdateUserProfile(ctx context.Context, id int, update domain.ProfileUpdate, version *time.Time) (*domain.User, error) {
+	var user domain.User
+
+	query := `
+	update users
+	set first_name = coalesce($2, first_name),
+		last_name = coalesce($3, last_name),
+		updated_at = now()
+	where id = $1 and deleted_at is null
+	and ($4::timestamp is null or updated_at = $4)
+	returning id, first_name, last_name, email, plan, role, created_at, updated_at`
+
+	row := u.Db.QueryRow(ctx, query, id, update.FirstName, update.LastName, version)
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Plan, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := u.GetUserByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrStaleVersion
+	}
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to update user profile", err)
+	}
+	return &user, nil
+}
+
+func (u *UserRepo) ReplaceUserPreferences(ctx context.Context, userID int, preferences []string, version *time.Time) (*domain.Preferences, error) {
+	var prefs domain.Preferences
+
+	query := `
+	update users_preferences p
+	set preferences = $2, updated_at = now()
+	from users u
+	where p.user_id = $1 and u.id = p.user_id and u.deleted_at is null
+	and ($3::timestamp is null or p.updated_at = $3)
+	returning p.id, p.user_id, p.preferences, p.updated_at`
+
+	row := u.Db.QueryRow(ctx, query, userID, preferences, version)
+	err := row.Scan(&prefs.ID, &prefs.UserID, &prefs.UserPreferences, &prefs.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := u.GetUserByID(ctx, userID); err != nil {
+			return nil, err
+		}
+		if _, err := u.GetUserPreferencesByID(ctx, userID); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrStaleVersion
+	}
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to replace user preferences", err)
+	}
+	return &prefs, nil
+}
+
 func (v *UserVerificationRepo) CreateUser(ctx context.Context, u *domain.User) error {
 
 	var returnedID int
@@ -151,6 +274,10 @@ func (v *UserVerificationRepo) CreateUser(ctx context.Context, u *domain.User) e
 	if errors.Is(err, pgx.ErrNoRows) {
 		return domain.ErrPersistUser
 	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return domain.ErrRegistrationPending
+	}
 	if err != nil {
 		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
 	}
@@ -221,32 +348,35 @@ func (v *UserVerificationRepo) DeleteUserFromStaging(ctx context.Context, email
 
 }
 
-func (v *UserVerificationRepo) SaveVerificationData(ctx context.Context, reqid, email string) error {
+func (v *UserVerificationRepo) SaveVerificationData(ctx context.Context, email string, expiresAt time.Time) (string, error) {
 	query := `insert into email_verification 
-			   (request_id, email) 
-			   values ($1, $2) returning id`
+			   (email, expires_at) 
+			   values ($1, $2) returning verification_id`
 
-	var returnedID int
-	row := v.Db.QueryRow(ctx, query, reqid, email)
-	err := row.Scan(&returnedID)
+	var verificationID string
+	row := v.Db.QueryRow(ctx, query, email, expiresAt)
+	err := row.Scan(&verificationID)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return domain.ErrPersistVerification
+		return "", domain.ErrPersistVerification
 	}
 	if err != nil {
-		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+		return "", domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
 	}
 
-	return nil
+	return verificationID, nil
 }
 
-func (v *UserVerificationRepo) RetrieveVerificationData(ctx context.Context, reqid string) (string, error) {
+func (v *UserVerificationRepo) RetrieveVerificationData(ctx context.Context, verificationID, email string) (string, error) {
 	var e string
 
-	query := `select email from email_verification where request_id=$1`
-	row := v.Db.QueryRow(ctx, query, reqid)
+	query := `
+	select email from email_verification
+	where (case when $1 <> '' then verification_id = $1 else email = $2 end)
+	and expires_at > now()`
+	row := v.Db.QueryRow(ctx, query, verificationID, email)
 	err := row.Scan(&e)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return "", domain.ErrRequestIDNotFound
+		return "", domain.ErrVerificationNotFound
 	}
 	if err != nil {
 		return "", domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
@@ -273,6 +403,112 @@ func (v *UserVerificationRepo) DeleteUserVerificationData(ctx context.Context, e
 
 }
 
+func (v *UserVerificationRepo) RenewVerificationData(ctx context.Context, email string, expiresAt time.Time) error {
+	query := `
+	with staged as (
+		update staging_users set updated_at = now() where email = $1 returning email
+	)
+	insert into email_verification (email, expires_at)
+	select email, $2 from staged
+	on conflict (email) do update set expires_at = excluded.expires_at, updated_at = now()
+	returning id`
+
+	var returnedID int
+	err := v.Db.QueryRow(ctx, query, email, expiresAt).Scan(&returnedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.ErrEmailNotFound
+	}
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return nil
+}
+
+// DeleteStaleRegistrations relies on email_verification cascading from
+// staging_users, and also drops verification rows left without one.
+func (v *UserVerificationRepo) DeleteStaleRegistrations(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := v.Db.Exec(ctx, `delete from staging_users where updated_at < $1::timestamptz`, before)
+	if err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeInternal, "failed to delete stale registrations", err)
+	}
+	if _, err := v.Db.Exec(ctx, `delete from email_verification where updated_at < $1::timestamptz`, before); err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeInternal, "failed to delete stale verification data", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (v *UserVerificationRepo) StageEmailChange(ctx context.Context, userID int, email string) error {
+	query := `
+	insert into email_changes (user_id, new_email) values ($1, $2)
+	on conflict (user_id) do update set new_email = excluded.new_email, created_at = now()`
+
+	if _, err := v.Db.Exec(ctx, query, userID, email); err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to stage email change", err)
+	}
+	return nil
+}
+
+func (v *UserVerificationRepo) GetStagedEmailChange(ctx context.Context, userID int) (string, error) {
+	var email string
+
+	query := `select new_email from email_changes where user_id = $1`
+	err := v.Db.QueryRow(ctx, query, userID).Scan(&email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", domain.ErrNoEmailChange
+	}
+	if err != nil {
+		return "", domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return email, nil
+}
+
+func (v *UserVerificationRepo) ConfirmEmailChange(ctx context.Context, userID int, newEmail string, maxAge time.Duration) (string, error) {
+	tx, err := v.Db.Begin(ctx)
+	if err != nil {
+		return "", domain.NewDomainError(domain.ErrCodeInternal, "failed to begin transaction", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// a change restaged since the code was checked, or staged longer ago than
+	// its code lives, must not be swapped in
+	query := `
+	delete from email_changes
+	where user_id = $1 and new_email = $2 and created_at > now() - make_interval(secs => $3)
+	returning new_email`
+	err = tx.QueryRow(ctx, query, userID, newEmail, maxAge.Seconds()).Scan(&newEmail)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", domain.ErrNoEmailChange
+	}
+	if err != nil {
+		return "", domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+
+	// the old email is read in the same statement, under the row lock
+	query = `
+	update users u set email = $2, updated_at = now()
+	from (select email from users where id = $1 for update) old
+	where u.id = $1 and u.deleted_at is null
+	returning old.email`
+
+	var oldEmail string
+	err = tx.QueryRow(ctx, query, userID, newEmail).Scan(&oldEmail)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", domain.ErrUserNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return "", domain.ErrEmailTaken
+	}
+	if err != nil {
+		return "", domain.NewDomainError(domain.ErrCodeInternal, "failed to change email", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", domain.NewDomainError(domain.ErrCodeInternal, "failed to commit transaction", err)
+	}
+	return oldEmail, nil
+}
+
 func (s *StoryRepo) SaveStoryInfo(ctx context.Context, i *domain.Story) (int, error) {
 	query := `
 	insert into stories
@@ -301,14 +537,14 @@ func (s *StoryRepo) UploadStory(ctx context.Context, story *domain.UploadStory)
 	SET
     	story = $1,
     	updated_at = NOW()
-	WHERE user_id = $2
+	WHERE id = $2 AND user_id = $3
 	RETURNING id;
 	`
 	var returnedID int
-	row := s.Db.QueryRow(ctx, query, story.Story, story.UserID)
+	row := s.Db.QueryRow(ctx, query, story.Story, story.StoryID, story.UserID)
 	err := row.Scan(&returnedID)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return domain.ErrUserNotFound
+		return domain.ErrStoryNotFound
 	}
 	if err != nil {
 		return domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
@@ -336,6 +572,99 @@ func (s *StoryRepo) SaveStoryJob(ctx context.Context, storyID int, status string
 
 }
 
+func (s *StoryRepo) ScheduleStoryJob(ctx context.Context, story *domain.Story, job domain.Job, stream string, maxActive int) (int, int, error) {
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return 0, 0, domain.NewDomainError(domain.ErrCodeInternal, "failed to begin transaction", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the user row lock serialises concurrent requests of the same user, so
+	// the count below cannot be raced past the limit
+	lockQuery := `SELECT id FROM users WHERE id = $1 FOR UPDATE`
+	var lockedID int
+	err = tx.QueryRow(ctx, lockQuery, story.UserID).Scan(&lockedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, domain.ErrUserNotFound
+	}
+	if err != nil {
+		return 0, 0, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+
+	activeQuery := `
+	SELECT COUNT(*)
+	FROM story_jobs sj
+	JOIN stories s ON s.id = sj.story_id
+	WHERE s.user_id = $1 AND sj.status IN ('pending', 'processing')
+	`
+	var active int
+	if err := tx.QueryRow(ctx, activeQuery, story.UserID).Scan(&active); err != nil {
+		return 0, 0, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	if active >= maxActive {
+		return 0, 0, domain.ErrTooManyActiveJobs
+	}
+
+	storyQuery := `
+	insert into stories
+	(file_name, user_id, story)
+	values ($1, $2, $3)
+	returning id
+	`
+	var storyID int
+	err = tx.QueryRow(ctx, storyQuery, story.FileName, story.UserID, story.Story).Scan(&storyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, domain.ErrPersistStory
+	}
+	if err != nil {
+		return 0, 0, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+
+	jobQuery := `
+	insert into story_jobs
+	(story_id, status)
+	values ($1, $2)
+	returning id`
+
+	var jobID int
+	err = tx.QueryRow(ctx, jobQuery, storyID, "pending").Scan(&jobID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, domain.ErrStoryNotFound
+	}
+	if err != nil {
+		return 0, 0, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+
+	job.StoryID = storyID
+	job.JobID = jobID
+	if err := insertOutbox(ctx, tx, stream, job); err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, domain.NewDomainError(domain.ErrCodeInternal, "failed to commit transaction", err)
+	}
+	return storyID, jobID, nil
+}
+
+func (s *StoryRepo) GetStoryJobStats(ctx context.Context, userID int) (*domain.StoryJobStats, error) {
+	query := `
+	SELECT
+		COUNT(*) FILTER (WHERE sj.status IN ('pending', 'processing')),
+		COUNT(*)
+	FROM story_jobs sj
+	JOIN stories s ON s.id = sj.story_id
+	WHERE s.user_id = $1;
+	`
+
+	var stats domain.StoryJobStats
+	row := s.Db.QueryRow(ctx, query, userID)
+	if err := row.Scan(&stats.Active, &stats.Total); err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "query failed", err)
+	}
+	return &stats, nil
+}
+
 func (s *StoryRepo) UpdateStoryJob(ctx context.Context, storyID int, status string) error {
 	query := `
 	UPDATE story_jobs
@@ -473,3 +802,11 @@ func (r *RefreshTokenRepo) UpdateRefreshToken(ctx context.Context, userID int, r
 	}
 	return nil
 }
+
+func (r *RefreshTokenRepo) RevokeUserRefreshTokens(ctx context.Context, userID int, revokedAt time.Time) error {
+	query := `update refresh_tokens set revoked_at = $2 where user_id = $1 and revoked_at is null`
+	if _, err := r.Db.Exec(ctx, query, userID, revokedAt); err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to revoke refresh tokens", err)
+	}
+	return nil
+}
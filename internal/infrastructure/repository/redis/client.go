@@ -22,6 +22,7 @@ func ConnectToRedis(addr string, database int) (*redis.Client, error) {
 		Addr: addr,
 		DB:   database,
 	})
+	rdb.AddHook(tracingHook{})
 
 	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Minute*1)
 	defer cancelFunc()
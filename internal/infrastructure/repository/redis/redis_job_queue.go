@@ -3,7 +3,9 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -14,18 +16,25 @@ import (
 )
 
 type Payload struct {
-	JobID           int    `json:"job_id"`
-	UserID          int    `json:"user_id"`
-	StoryID         int    `json:"story_id"`
-	UserEmail       string `json:"user_email"`
-	UserPreferences string `json:"user_preferences"`
-	RetryCounts     int    `json:"retry_counts"`
-	RequestID       string `json:"request_id"`
+	JobID           int               `json:"job_id"`
+	UserID          int               `json:"user_id"`
+	StoryID         int               `json:"story_id"`
+	UserEmail       string            `json:"user_email"`
+	UserPreferences string            `json:"user_preferences"`
+	RetryCounts     int               `json:"retry_counts"`
+	RequestID       string            `json:"request_id"`
+	Priority        string            `json:"priority"`
+	TraceContext    map[string]string `json:"trace_context,omitempty"`
 }
 
 type Task struct {
 	Client    *redis.Client
 	GroupName string
+	// ReadBlock bounds how long Read waits on XREADGROUP. Zero blocks forever.
+	ReadBlock time.Duration
+	// ClaimIdle is how long a delivered message may stay unacked before Read
+	// hands it to another consumer. Zero disables claiming.
+	ClaimIdle time.Duration
 }
 
 func (t *Task) CreateConsumerGroup(ctx context.Context, stream string, group string) error {
@@ -47,6 +56,8 @@ func (t *Task) Add(ctx context.Context, job domain.Job, stream string) error {
 		UserPreferences: job.UserPreferences,
 		RetryCounts:     job.RetryCounts,
 		RequestID:       job.RequestID,
+		Priority:        job.Priority,
+		TraceContext:    job.TraceContext,
 	}
 
 	jobB, err := json.Marshal(payload)
@@ -67,37 +78,132 @@ func (t *Task) Add(ctx context.Context, job domain.Job, stream string) error {
 	return nil
 }
 
-func (t *Task) Read(ctx context.Context, consumerId int, stream string) (domain.Message, error) {
+// Read without block checks the streams one by one, in order, so a message
+// is only ever taken from the first stream that has one. With block it waits
+// on all streams in a single XREADGROUP.
+func (t *Task) Read(ctx context.Context, consumerId int, streams []string, block bool) (domain.Message, string, error) {
+	consumer := fmt.Sprintf("workerId:%d", consumerId)
+
+	if t.ClaimIdle > 0 {
+		for _, stream := range streams {
+			msg, ok, err := t.claim(ctx, consumer, stream)
+			if err != nil {
+				return domain.Message{}, "", err
+			}
+			if ok {
+				return msg, stream, nil
+			}
+		}
+	}
+
+	if block {
+		return t.readGroup(ctx, consumerId, streams, t.ReadBlock)
+	}
+	for _, stream := range streams {
+		// a negative block leaves BLOCK off, so XREADGROUP returns at once
+		msg, _, err := t.readGroup(ctx, consumerId, []string{stream}, -1)
+		if errors.Is(err, domain.ErrNoMessageFound) {
+			continue
+		}
+		return msg, stream, err
+	}
+	return domain.Message{}, "", domain.ErrNoMessageFound
+}
+
+func (t *Task) readGroup(ctx context.Context, consumerId int, streams []string, block time.Duration) (domain.Message, string, error) {
+	consumer := fmt.Sprintf("workerId:%d", consumerId)
+
+	args := make([]string, 0, 2*len(streams))
+	args = append(args, streams...)
+	for range streams {
+		args = append(args, ">")
+	}
 
 	result, err := t.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
 		Group:    t.GroupName,
-		Consumer: fmt.Sprintf("workerId:%d", consumerId),
-		Streams:  []string{stream, ">"},
+		Consumer: consumer,
+		Streams:  args,
 		Count:    1,
-		Block:    0,
+		Block:    block,
 	}).Result()
 
-	// result, err := t.Client.XRead(ctx, &redis.XReadArgs{ // NOT MAKE SURE EVER
-	// 	Streams: []string{stream},
-	// 	Count:   1,
-	// 	Block:   0,
-	// 	ID:      "$",
-	// }).Result()
+	if errors.Is(err, redis.Nil) {
+		return domain.Message{}, "", domain.ErrNoMessageFound
+	}
 
 	if err != nil {
-		return domain.Message{}, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read from %s stream, consumerID %d", stream, consumerId), err)
+		return domain.Message{}, "", domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read from %s streams, consumerID %d", strings.Join(streams, ","), consumerId), err)
 	}
 
-	if len(result) == 0 || len(result[0].Messages) == 0 {
-		return domain.Message{}, domain.NewDomainError(
-			domain.ErrCodeExternal,
-			"no messages available",
-			nil,
-		)
+	// COUNT applies per stream, so when several streams had messages ready
+	// each of them delivered one. Keep the one from the earliest stream in
+	// the given order and hand the rest back.
+	var (
+		picked    redis.XMessage
+		pickedIdx = -1
+	)
+	for _, r := range result {
+		if len(r.Messages) == 0 {
+			continue
+		}
+		idx := slices.Index(streams, r.Stream)
+		if pickedIdx == -1 || idx < pickedIdx {
+			picked, pickedIdx = r.Messages[0], idx
+		}
+	}
+	if pickedIdx == -1 {
+		return domain.Message{}, "", domain.ErrNoMessageFound
+	}
+	for _, r := range result {
+		if r.Stream == streams[pickedIdx] {
+			continue
+		}
+		for _, m := range r.Messages {
+			t.release(ctx, consumer, r.Stream, m.ID)
+		}
+	}
+
+	msg, err := toMessage(streams[pickedIdx], picked)
+	return msg, streams[pickedIdx], err
+}
+
+// release makes a message this consumer read but will not process claimable
+// right away, by backdating its idle time to ClaimIdle. Without claiming it
+// stays pending like any other unacked message.
+func (t *Task) release(ctx context.Context, consumer string, stream string, id string) {
+	if t.ClaimIdle <= 0 {
+		return
+	}
+	_ = t.Client.Do(ctx, "XCLAIM", stream, t.GroupName, consumer, 0, id,
+		"IDLE", t.ClaimIdle.Milliseconds(), "JUSTID").Err()
+}
+
+// claim takes over one message another consumer read but never acked, e.g.
+// because its worker was stopped mid-job, once it has been idle for ClaimIdle.
+func (t *Task) claim(ctx context.Context, consumer string, stream string) (domain.Message, bool, error) {
+	entries, _, err := t.Client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    t.GroupName,
+		Consumer: consumer,
+		MinIdle:  t.ClaimIdle,
+		Start:    "0-0",
+		Count:    1,
+	}).Result()
+	if err != nil {
+		return domain.Message{}, false, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to claim pending messages from %s stream", stream), err)
+	}
+	if len(entries) == 0 {
+		return domain.Message{}, false, nil
 	}
 
-	entry := result[0].Messages[0]
+	msg, err := toMessage(stream, entries[0])
+	if err != nil {
+		return domain.Message{}, false, err
+	}
+	return msg, true, nil
+}
 
+func toMessage(stream string, entry redis.XMessage) (domain.Message, error) {
 	raw, ok := entry.Values["payload"].(string)
 	if !ok {
 		return domain.Message{}, domain.NewDomainError(
@@ -123,11 +229,11 @@ func (t *Task) Read(ctx context.Context, consumerId int, stream string) (domain.
 		UserEmail:       payload.UserEmail,
 		UserPreferences: payload.UserPreferences,
 		RetryCounts:     payload.RetryCounts,
-		RequestID:       payload.RequestID}
-
-	msg := domain.Message{MessageID: entry.ID, Payload: job}
+		RequestID:       payload.RequestID,
+		Priority:        payload.Priority,
+		TraceContext:    payload.TraceContext}
 
-	return msg, nil
+	return domain.Message{MessageID: entry.ID, Payload: job}, nil
 }
 
 func (t *Task) Ack(ctx context.Context, messageID string, stream string) error {
@@ -158,6 +264,8 @@ func (t *Task) ScheduleRetry(ctx context.Context, job domain.Job, stream string)
 		UserPreferences: job.UserPreferences,
 		RetryCounts:     job.RetryCounts,
 		RequestID:       job.RequestID,
+		Priority:        job.Priority,
+		TraceContext:    job.TraceContext,
 	}
 
 	jobB, err := json.Marshal(payload)
@@ -209,9 +317,11 @@ func (t *Task) ReEnqueue(ctx context.Context, queue string, stream string) error
 			UserEmail:       p.UserEmail,
 			UserPreferences: p.UserPreferences,
 			RetryCounts:     p.RetryCounts,
-			RequestID:       p.RequestID}
+			RequestID:       p.RequestID,
+			Priority:        p.Priority,
+			TraceContext:    p.TraceContext}
 
-		err := t.Add(ctx, job, stream)
+		err := t.Add(ctx, job, domain.PriorityStream(stream, job.Priority))
 		if err != nil {
 			return err
 		}
@@ -219,3 +329,54 @@ func (t *Task) ReEnqueue(ctx context.Context, queue string, stream string) error
 	}
 	return nil
 }
+
+// StreamStats reads the group's lag and pending count from XINFO GROUPS. Redis
+// cannot report lag once entries have been deleted from the stream, which is
+// what the completion handlers do, so in that case everything still in the
+// stream that is not pending is counted as lag.
+func (t *Task) StreamStats(ctx context.Context, stream string, group string) (domain.StreamStats, error) {
+	groups, err := t.Client.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return domain.StreamStats{}, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read groups of %s stream", stream), err)
+	}
+
+	for _, g := range groups {
+		if g.Name != group {
+			continue
+		}
+		stats := domain.StreamStats{Lag: g.Lag, Pending: g.Pending}
+		if stats.Lag < 0 {
+			length, err := t.Client.XLen(ctx, stream).Result()
+			if err != nil {
+				return domain.StreamStats{}, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read length of %s stream", stream), err)
+			}
+			stats.Lag = max(length-g.Pending, 0)
+		}
+		return stats, nil
+	}
+	return domain.StreamStats{}, domain.NewDomainError(domain.ErrCodeNotFound, fmt.Sprintf("consumer group %s does not exist for %s stream", group, stream), nil)
+}
+
+func (t *Task) ConsumerGroupExists(ctx context.Context, stream string, group string) (bool, error) {
+	groups, err := t.Client.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return false, nil
+		}
+		return false, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read groups of %s stream", stream), err)
+	}
+	for _, g := range groups {
+		if g.Name == group {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *Task) RetrySetSize(ctx context.Context, queue string, stream string) (int64, error) {
+	size, err := t.Client.ZCard(ctx, queue).Result()
+	if err != nil {
+		return 0, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to read size of %s", queue), err)
+	}
+	return size, nil
+}
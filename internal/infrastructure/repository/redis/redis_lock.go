@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+var refreshLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type Lock struct {
+	Client *redis.Client
+}
+
+func NewLock(client *redis.Client) *Lock {
+	return &Lock{Client: client}
+}
+
+func (l *Lock) AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	err := l.Client.SetArgs(ctx, key, owner, redis.SetArgs{Mode: "NX", TTL: ttl}).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to acquire lock %s", key), err)
+	}
+	return true, nil
+}
+
+// RefreshLock extends the lease only while owner still holds the key, so an
+// instance that stalled past its TTL cannot steal the lock back.
+func (l *Lock) RefreshLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	n, err := refreshLockScript.Run(ctx, l.Client, []string{key}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to refresh lock %s", key), err)
+	}
+	return n == 1, nil
+}
+
+func (l *Lock) ReleaseLock(ctx context.Context, key, owner string) error {
+	if err := releaseLockScript.Run(ctx, l.Client, []string{key}, owner).Err(); err != nil {
+		return domain.NewDomainError(domain.ErrCodeExternal, fmt.Sprintf("failed to release lock %s", key), err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+func (r RedisClient) SaveOIDCState(ctx context.Context, state string, s domain.OIDCState, ttl time.Duration) error {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeInternal, "failed to encode oidc state", err)
+	}
+	if err := r.Client.Set(ctx, fmt.Sprintf("users:oidc-state:%s", state), payload, ttl).Err(); err != nil {
+		return domain.NewDomainError(domain.ErrCodeExternal, "failed to save oidc state", err)
+	}
+	return nil
+}
+
+func (r RedisClient) TakeOIDCState(ctx context.Context, state string) (*domain.OIDCState, error) {
+	payload, err := r.Client.GetDel(ctx, fmt.Sprintf("users:oidc-state:%s", state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, domain.ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeExternal, "failed to read oidc state", err)
+	}
+
+	var s domain.OIDCState
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to decode oidc state", err)
+	}
+	return &s, nil
+}
@@ -7,8 +7,19 @@ import (
 	"time"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/redis/go-redis/v9"
 )
 
+// consumeOTPScript deletes the code only if it is still the one that was
+// checked, so of several concurrent calls with the right code only one wins,
+// and a code saved in the meantime is left alone.
+var consumeOTPScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "otp") == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
 func (r RedisClient) SaveOTP(ctx context.Context, email string, otp string, expiration int) error {
 
 	userdata := struct {
@@ -33,6 +44,14 @@ func (r RedisClient) SaveOTP(ctx context.Context, email string, otp string, expi
 
 }
 
+func (r RedisClient) ReserveResend(ctx context.Context, key string, cooldown time.Duration) (bool, error) {
+	ok, err := r.Client.SetNX(ctx, fmt.Sprintf("users:otp-cooldown:%s", key), 1, cooldown).Result()
+	if err != nil {
+		return false, domain.NewDomainError(domain.ErrCodeExternal, "failed to check resend cooldown", err)
+	}
+	return ok, nil
+}
+
 func (r RedisClient) VerifyOTP(ctx context.Context, email string, sentopt string) error {
 
 	key := fmt.Sprintf("users:otp:%s", email)
@@ -66,6 +85,12 @@ func (r RedisClient) VerifyOTP(ctx context.Context, email string, sentopt string
 		return domain.ErrInvalidOtp
 	}
 
-	r.Client.Del(ctx, key)
+	consumed, err := consumeOTPScript.Run(ctx, r.Client, []string{key}, storedOtp).Int()
+	if err != nil {
+		return domain.NewDomainError(domain.ErrCodeExternal, "failed to consume otp", err)
+	}
+	if consumed == 0 {
+		return domain.ErrOtpKeyNotFound
+	}
 	return nil
 }
@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingHook opens a client span for every command and pipeline.
+type tracingHook struct{}
+
+func (tracingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (tracingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := startSpan(ctx, "redis "+cmd.Name())
+		err := next(ctx, cmd)
+		endSpan(span, err)
+		return err
+	}
+}
+
+func (tracingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := startSpan(ctx, "redis pipeline")
+		span.SetAttributes(attribute.Int("db.operation.batch.size", len(cmds)))
+		err := next(ctx, cmds)
+		endSpan(span, err)
+		return err
+	}
+}
+
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return observability.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "redis")))
+}
+
+// endSpan does not mark redis.Nil as an error: an empty read is an answer.
+func endSpan(span trace.Span, err error) {
+	if errors.Is(err, redis.Nil) {
+		err = nil
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		span.SetAttributes(attribute.Bool("error.timeout", true))
+	}
+	observability.EndSpan(span, err)
+}
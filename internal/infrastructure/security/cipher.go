@@ -0,0 +1,48 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+// AESCipher encrypts with AES-GCM; the random nonce is prepended to the
+// ciphertext.
+type AESCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESCipher takes a 16, 24 or 32 byte key.
+func NewAESCipher(key []byte) (*AESCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "invalid encryption key", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to create cipher", err)
+	}
+	return &AESCipher{aead: aead}, nil
+}
+
+func (c *AESCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to generate nonce", err)
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (c *AESCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(ciphertext) < size {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "ciphertext too short", nil)
+	}
+	plaintext, err := c.aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to decrypt", err)
+	}
+	return plaintext, nil
+}
@@ -1,40 +1,54 @@
 package security
 
 import (
+	"crypto"
+	"sort"
 	"time"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AccessTokenTTL is how long an access token is valid.
+const AccessTokenTTL = time.Hour
+
+// JwtAuth signs access tokens with AccessSecret (HS256) or, when SigningKey
+// is set, with that key and its kid. VerificationKeys then holds every public
+// key still accepted, by kid, so keys can be rotated without logging users
+// out. HS256 tokens without a kid, issued before the switch to SigningKey,
+// are still verified with AccessSecret until LegacySecretUntil. Refresh
+// tokens only ever come back to us and keep using RefreshSecret.
 type JwtAuth struct {
-	AccessSecret  []byte
-	RefreshSecret []byte
-	Issuer        string
+	AccessSecret      []byte
+	RefreshSecret     []byte
+	Issuer            string
+	SigningKey        *SigningKey
+	VerificationKeys  map[string]crypto.PublicKey
+	LegacySecretUntil time.Time
 }
 
 type CustomClaims struct {
 	UserID int
 	Email  string
+	Role   string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func (j JwtAuth) CreateJWTToken(id int, email string) (*domain.TokenPair, error) {
+func (j JwtAuth) CreateJWTToken(id int, email string, role string) (*domain.TokenPair, error) {
 
 	accessTokenClaims := CustomClaims{
 		UserID: id,
 		Email:  email,
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    j.Issuer,
 			Subject:   "access-token",
-			ExpiresAt: jwt.NewNumericDate((time.Now().Add(time.Minute * 60))),
+			ExpiresAt: jwt.NewNumericDate((time.Now().Add(AccessTokenTTL))),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	accesstoken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
-
-	accesstokenString, err := accesstoken.SignedString(j.AccessSecret)
+	accesstokenString, err := j.signAccessToken(accessTokenClaims)
 	if err != nil {
 		return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to create jwt access token", err)
 	}
@@ -61,13 +75,54 @@ func (j JwtAuth) CreateJWTToken(id int, email string) (*domain.TokenPair, error)
 
 }
 
-func (j JwtAuth) VerifyJWTToken(tokenString string, secretKey []byte) (*domain.IdentityToken, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
+func (j JwtAuth) signAccessToken(claims CustomClaims) (string, error) {
+	if j.SigningKey == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(j.AccessSecret)
+	}
+	token := jwt.NewWithClaims(j.SigningKey.Method, claims)
+	token.Header["kid"] = j.SigningKey.ID
+	return token.SignedString(j.SigningKey.Key)
+}
+
+// accessKey picks the verification key by kid; the key, not the token,
+// decides the algorithm.
+func (j JwtAuth) accessKey(token *jwt.Token) (interface{}, error) {
+	if j.SigningKey == nil {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, domain.ErrInvalidJWTMethod
 		}
-		return secretKey, nil
-	})
+		return j.AccessSecret, nil
+	}
+
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return j.legacyAccessKey(token)
+	}
+	key, ok := j.VerificationKeys[kid]
+	if !ok {
+		return nil, domain.ErrInvalidJWTToken
+	}
+	method, err := signingMethod(key)
+	if err != nil || method.Alg() != token.Method.Alg() {
+		return nil, domain.ErrInvalidJWTMethod
+	}
+	return key, nil
+}
+
+// legacyAccessKey accepts shared-secret tokens issued before SigningKey was
+// configured, until they have had time to expire.
+func (j JwtAuth) legacyAccessKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, domain.ErrInvalidJWTMethod
+	}
+	if len(j.AccessSecret) == 0 || !time.Now().Before(j.LegacySecretUntil) {
+		return nil, domain.ErrInvalidJWTMethod
+	}
+	return j.AccessSecret, nil
+}
+
+func (j JwtAuth) VerifyJWTToken(tokenString string) (*domain.IdentityToken, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, j.accessKey)
 
 	if err != nil || token == nil {
 		return nil, domain.ErrInvalidJWTToken
@@ -78,15 +133,15 @@ func (j JwtAuth) VerifyJWTToken(tokenString string, secretKey []byte) (*domain.I
 		return nil, domain.ErrInvalidJWTToken
 	}
 
-	return &domain.IdentityToken{UserID: claims.UserID, Email: claims.Email}, nil
+	return &domain.IdentityToken{UserID: claims.UserID, Email: claims.Email, Role: claims.Role}, nil
 }
 
-func (j JwtAuth) VerifyRefreshToken(tokenString string, secretKey []byte) (*domain.IdentityToken, error) {
+func (j JwtAuth) VerifyRefreshToken(tokenString string) (*domain.IdentityToken, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, domain.ErrInvalidJWTMethod
 		}
-		return secretKey, nil
+		return j.RefreshSecret, nil
 	})
 
 	if err != nil || token == nil {
@@ -100,3 +155,16 @@ func (j JwtAuth) VerifyRefreshToken(tokenString string, secretKey []byte) (*doma
 
 	return &domain.IdentityToken{UserID: claims.UserID, Email: claims.Email}, nil
 }
+
+func (j JwtAuth) PublicKeys() ([]domain.JSONWebKey, error) {
+	keys := make([]domain.JSONWebKey, 0, len(j.VerificationKeys))
+	for kid, key := range j.VerificationKeys {
+		jwk, err := publicJWK(kid, key)
+		if err != nil {
+			return nil, domain.NewDomainError(domain.ErrCodeInternal, "failed to encode jwt key", err)
+		}
+		keys = append(keys, jwk)
+	}
+	sort.Slice(keys, func(a, b int) bool { return keys[a].Kid < keys[b].Kid })
+	return keys, nil
+}
@@ -0,0 +1,169 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey signs access tokens; ID goes into the kid header.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    crypto.Signer
+}
+
+// LoadSigningKeys reads the current private key and the public keys that
+// should still verify, usually keys rotated out less than a token lifetime
+// ago. The current key's public half is always part of the returned set.
+// Files are PEM, RSA or Ed25519; private key files work as verification keys
+// too.
+func LoadSigningKeys(signingKeyFile string, verificationKeyFiles []string) (*SigningKey, map[string]crypto.PublicKey, error) {
+	signer, err := readPrivateKey(signingKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	method, err := signingMethod(signer.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := keyID(signer.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{id: signer.Public()}
+	for _, file := range verificationKeyFiles {
+		key, err := readPublicKey(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		kid, err := keyID(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys[kid] = key
+	}
+	return &SigningKey{ID: id, Method: method, Key: signer}, keys, nil
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading jwt key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwt key %s is not PEM encoded", file)
+	}
+	return block, nil
+}
+
+func readPrivateKey(file string) (crypto.Signer, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing jwt key %s: %w", file, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("jwt key %s cannot sign", file)
+	}
+	return signer, nil
+}
+
+func readPublicKey(file string) (crypto.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	signer, err := readPrivateKey(file)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+// signingMethod ties the algorithm to the key type, so a token can never
+// pick a weaker one.
+func signingMethod(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported jwt key type %T", key)
+}
+
+// publicJWK renders key as a JSON Web Key (RFC 7517).
+func publicJWK(kid string, key crypto.PublicKey) (domain.JSONWebKey, error) {
+	method, err := signingMethod(key)
+	if err != nil {
+		return domain.JSONWebKey{}, err
+	}
+	jwk := domain.JSONWebKey{Kid: kid, Use: "sig", Alg: method.Alg()}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	}
+	return jwk, nil
+}
+
+// keyID is the RFC 7638 thumbprint, so the same key always gets the same kid
+// without configuring one.
+func keyID(key crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK("", key)
+	if err != nil {
+		return "", err
+	}
+	var members any
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
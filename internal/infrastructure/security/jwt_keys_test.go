@@ -0,0 +1,141 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeKey(t *testing.T, name string, key any) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func loadAuth(t *testing.T, signingKeyFile string, verificationKeyFiles ...string) JwtAuth {
+	t.Helper()
+	signingKey, keys, err := LoadSigningKeys(signingKeyFile, verificationKeyFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return JwtAuth{RefreshSecret: []byte("refresh-secret"), Issuer: "test", SigningKey: signingKey, VerificationKeys: keys}
+}
+
+func TestRotatedKeysKeepVerifying(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldFile, newFile := writeKey(t, "old.pem", rsaKey), writeKey(t, "new.pem", edKey)
+
+	before := loadAuth(t, oldFile)
+	oldPair, err := before.CreateJWTToken(7, "reza@example.com", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := loadAuth(t, newFile, oldFile)
+	newPair, err := after.CreateJWTToken(7, "reza@example.com", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"old key": oldPair.AccessToken, "new key": newPair.AccessToken} {
+		if id, err := after.VerifyJWTToken(token); err != nil || id.UserID != 7 {
+			t.Errorf("%s: %+v %v", name, id, err)
+		}
+	}
+	if _, err := before.VerifyJWTToken(newPair.AccessToken); err == nil {
+		t.Error("token of a key unknown to the verifier accepted")
+	}
+	if _, err := after.VerifyRefreshToken(newPair.RefreshToken); err != nil {
+		t.Errorf("refresh token: %v", err)
+	}
+
+	keys, err := after.PublicKeys()
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("want both keys published, got %+v %v", keys, err)
+	}
+	algs := map[string]string{}
+	for _, k := range keys {
+		algs[k.Kid] = k.Alg
+	}
+	if algs[before.SigningKey.ID] != "RS256" || algs[after.SigningKey.ID] != "EdDSA" {
+		t.Errorf("unexpected key set %+v", keys)
+	}
+
+	// a token claiming HS256 with the public key as secret must not pass
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomClaims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{
+		Subject: "access-token", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}})
+	forged.Header["kid"] = after.SigningKey.ID
+	signed, err := forged.SignedString([]byte(edKey.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.VerifyJWTToken(signed); err == nil {
+		t.Error("HS256 token accepted by an asymmetric verifier")
+	}
+}
+
+func TestSharedSecretTokensVerifyDuringMigration(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := JwtAuth{AccessSecret: []byte("access-secret"), RefreshSecret: []byte("refresh-secret"), Issuer: "test"}
+	oldPair, err := legacy.CreateJWTToken(7, "reza@example.com", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrated := loadAuth(t, writeKey(t, "new.pem", edKey))
+	migrated.AccessSecret = legacy.AccessSecret
+	migrated.LegacySecretUntil = time.Now().Add(AccessTokenTTL)
+	newPair, err := migrated.CreateJWTToken(7, "reza@example.com", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"shared secret": oldPair.AccessToken, "signing key": newPair.AccessToken} {
+		if id, err := migrated.VerifyJWTToken(token); err != nil || id.UserID != 7 {
+			t.Errorf("%s within the grace window: %+v %v", name, id, err)
+		}
+	}
+
+	migrated.LegacySecretUntil = time.Now().Add(-time.Second)
+	if _, err := migrated.VerifyJWTToken(oldPair.AccessToken); err == nil {
+		t.Error("shared secret token accepted after the grace window")
+	}
+	if _, err := migrated.VerifyJWTToken(newPair.AccessToken); err != nil {
+		t.Errorf("signing key token after the grace window: %v", err)
+	}
+
+	// a kid-less token signed with something else than the secret never passes
+	migrated.LegacySecretUntil = time.Now().Add(AccessTokenTTL)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomClaims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{
+		Subject: "access-token", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}})
+	signed, err := forged.SignedString([]byte(edKey.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrated.VerifyJWTToken(signed); err == nil {
+		t.Error("HS256 token with a wrong secret accepted during the grace window")
+	}
+}
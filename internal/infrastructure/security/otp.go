@@ -2,6 +2,7 @@ package security
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 	"math/big"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
@@ -22,3 +23,16 @@ func (o Otpgen) GenerateOTP() (string, error) {
 
 	return otp.String(), nil
 }
+
+// RandomToken generates tokens of Size random bytes, base64url encoded.
+type RandomToken struct {
+	Size int
+}
+
+func (t RandomToken) GenerateToken() (string, error) {
+	b := make([]byte, t.Size)
+	if _, err := rand.Read(b); err != nil {
+		return "", domain.NewDomainError(domain.ErrCodeInternal, "failed to generate token", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,32 @@
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+// Vectors from RFC 6238 appendix B, truncated to 6 digits.
+func TestTOTPMatchesRFCVectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		at   int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	totp := TOTP{Issuer: "test"}
+	for _, tt := range tests {
+		if got := totpCode(secret, tt.at/totpPeriod); got != tt.code {
+			t.Errorf("at %d: got %s, want %s", tt.at, got, tt.code)
+		}
+		if step, ok := totp.Validate(secret, tt.code, time.Unix(tt.at+totpPeriod, 0)); !ok || step != tt.at/totpPeriod {
+			t.Errorf("at %d: code from the previous step rejected or matched step %d", tt.at, step)
+		}
+		if _, ok := totp.Validate(secret, tt.code, time.Unix(tt.at+3*totpPeriod, 0)); ok {
+			t.Errorf("at %d: stale code accepted", tt.at)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"strings"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/robfig/cron/v3"
+)
+
+// CronParser accepts standard five-field expressions and descriptors such as
+// @daily. @every is rejected because it ignores the time zone and would let a
+// user fire stories every few seconds.
+type CronParser struct {
+	parser cron.Parser
+}
+
+func NewCronParser() CronParser {
+	return CronParser{parser: cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)}
+}
+
+func (c CronParser) Next(expr string, timeZone string, after time.Time) (time.Time, error) {
+	if strings.HasPrefix(expr, "@every") || strings.Contains(expr, "TZ=") {
+		return time.Time{}, domain.ErrInvalidCronExpr
+	}
+
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil || timeZone == "" {
+		return time.Time{}, domain.NewDomainError(domain.ErrCodeValidation, domain.ErrInvalidTimeZone.Message, err)
+	}
+
+	schedule, err := c.parser.Parse(expr)
+	if err != nil {
+		return time.Time{}, domain.NewDomainError(domain.ErrCodeValidation, domain.ErrInvalidCronExpr.Message, err)
+	}
+
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, domain.ErrInvalidCronExpr
+	}
+	return next.UTC(), nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+func TestCronParserUsesScheduleTimeZone(t *testing.T) {
+	parser := NewCronParser()
+	after := time.Date(2025, time.March, 8, 12, 0, 0, 0, time.UTC)
+
+	next, err := parser.Next("0 20 * * *", "America/New_York", after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 8pm EST on the 8th, the day before the DST switch
+	if want := time.Date(2025, time.March, 9, 1, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("next = %s, want %s", next, want)
+	}
+
+	next, err = parser.Next("0 20 * * *", "America/New_York", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 8pm EDT on the 9th
+	if want := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("next after DST = %s, want %s", next, want)
+	}
+}
+
+func TestCronParserRejectsInvalidInput(t *testing.T) {
+	parser := NewCronParser()
+	now := time.Now()
+
+	cases := []struct {
+		expr, tz string
+		want     *domain.DomainError
+	}{
+		{"not a cron", "UTC", domain.ErrInvalidCronExpr},
+		{"@every 1s", "UTC", domain.ErrInvalidCronExpr},
+		{"CRON_TZ=UTC 0 20 * * *", "UTC", domain.ErrInvalidCronExpr},
+		{"0 20 * * *", "Mars/Olympus", domain.ErrInvalidTimeZone},
+		{"0 20 * * *", "", domain.ErrInvalidTimeZone},
+	}
+	for _, tc := range cases {
+		_, err := parser.Next(tc.expr, tc.tz, now)
+		var de *domain.DomainError
+		if !errors.As(err, &de) || de.Message != tc.want.Message {
+			t.Errorf("Next(%q, %q) error = %v, want %q", tc.expr, tc.tz, err, tc.want.Message)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 type requestIDKey struct{}
 type requestStartTimeKey struct{}
+type clientIPKey struct{}
+type userIDKey struct{}
 
 func WithRequestID(ctx context.Context, id string) context.Context {
 	return context.WithValue(ctx, requestIDKey{}, id)
@@ -32,3 +34,24 @@ func GetrequestStartTimeKey(ctx context.Context) (time.Time, bool) {
 	return v.(time.Time), true
 
 }
+
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func GetClientIP(ctx context.Context) string {
+	if v := ctx.Value(clientIPKey{}); v != nil {
+		return v.(string)
+	}
+	return ""
+}
+
+// WithUserID stores the authenticated caller of the request.
+func WithUserID(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, userIDKey{}, id)
+}
+
+func GetUserID(ctx context.Context) (int, bool) {
+	v, ok := ctx.Value(userIDKey{}).(int)
+	return v, ok
+}
@@ -0,0 +1,102 @@
+package observability
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "notification"
+
+// Job outcomes recorded by QueueJobs. Every failed job is also counted as
+// either retried or dead_lettered.
+const (
+	JobProcessed    = "processed"
+	JobFailed       = "failed"
+	JobRetried      = "retried"
+	JobDeadLettered = "dead_lettered"
+	JobAborted      = "aborted"
+	JobCancelled    = "cancelled"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	RateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the IP rate limiter.",
+	}, []string{"route"})
+
+	QueueJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_jobs_total",
+		Help:      "Jobs handled by the worker pools by stream and outcome.",
+	}, []string{"stream", "outcome"})
+
+	QueueJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_job_duration_seconds",
+		Help:      "Time spent executing a job by stream.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30},
+	}, []string{"stream"})
+
+	StreamLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_stream_lag",
+		Help:      "Messages not yet delivered to the consumer group.",
+	}, []string{"stream"})
+
+	StreamPending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_stream_pending",
+		Help:      "Messages delivered to the consumer group but not acked.",
+	}, []string{"stream"})
+
+	RetrySetSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_retry_set_size",
+		Help:      "Retries waiting for their backoff to pass.",
+	}, []string{"stream"})
+
+	AIRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "ai_request_duration_seconds",
+		Help:      "Latency of AI model calls by model and outcome.",
+		Buckets:   []float64{.25, .5, 1, 2.5, 5, 10, 20, 30},
+	}, []string{"model", "outcome"})
+
+	AITokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "ai_tokens_total",
+		Help:      "Tokens used by AI model calls by model and kind (prompt, response).",
+	}, []string{"model", "kind"})
+
+	EmailSends = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "email_sends_total",
+		Help:      "SMTP sends by email kind and outcome.",
+	}, []string{"kind", "outcome"})
+)
+
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,35 @@
+package observability_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceContextRoundTrip(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "POST /stories")
+	defer span.End()
+
+	carrier := observability.InjectTraceContext(ctx)
+	if carrier["traceparent"] == "" {
+		t.Fatalf("carrier %v has no traceparent", carrier)
+	}
+
+	got := trace.SpanContextFromContext(observability.ExtractTraceContext(context.Background(), carrier))
+	if got.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("trace id = %s, want %s", got.TraceID(), span.SpanContext().TraceID())
+	}
+	if got.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("span id = %s, want %s", got.SpanID(), span.SpanContext().SpanID())
+	}
+}
+
+func TestInjectTraceContextWithoutSpan(t *testing.T) {
+	if carrier := observability.InjectTraceContext(context.Background()); carrier != nil {
+		t.Errorf("carrier = %v, want nil", carrier)
+	}
+}
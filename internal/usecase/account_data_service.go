@@ -0,0 +1,85 @@
+package usecase
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+)
+
+type AccountDataService struct {
+	Data           domain.AccountDataRepository
+	Audit          domain.AuditRepository
+	Logger         domain.LoggingRepository
+	GracePeriod    time.Duration
+	PurgeBatchSize int
+}
+
+func NewAccountDataService(
+	data domain.AccountDataRepository,
+	audit domain.AuditRepository,
+	logger domain.LoggingRepository,
+	gracePeriod time.Duration,
+	purgeBatchSize int,
+) *AccountDataService {
+	return &AccountDataService{Data: data, Audit: audit, Logger: logger, GracePeriod: gracePeriod, PurgeBatchSize: purgeBatchSize}
+}
+
+func (s *AccountDataService) ExportAccount(ctx context.Context, userID int) (_ *domain.UserExport, err error) {
+	log := s.Logger.With("service.name", "export", "http.request.id", observability.GetRequestID(ctx), "user.id", userID, "event.category", []string{"iam"})
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditUserDataExport, userID, err, nil)
+	}()
+
+	export, err := s.Data.ExportUserData(ctx, userID)
+	if err != nil {
+		log.Error(
+			"failed to export user data",
+			"event.action", "export_user_data",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+	return export, nil
+}
+
+// PurgeDeletedAccounts removes the accounts deleted more than GracePeriod
+// before now, one batch at a time until none is left.
+func (s *AccountDataService) PurgeDeletedAccounts(ctx context.Context, now time.Time) error {
+	log := s.Logger.With("service.name", "account-purger", "event.category", []string{"iam"})
+
+	for {
+		ids, err := s.Data.PurgeDeletedUsers(ctx, now.Add(-s.GracePeriod), s.PurgeBatchSize)
+		if err != nil {
+			log.Error(
+				"failed to purge deleted users",
+				"event.action", "purge_deleted_users",
+				"event.type", []string{"error", "end"},
+				"event.outcome", "failed",
+				"error.message", err.Error())
+			return err
+		}
+		for _, id := range ids {
+			recordAudit(ctx, s.Audit, log, domain.AuditEvent{
+				EventType: domain.AuditUserPurge,
+				Outcome:   domain.AuditOutcomeSuccess,
+				UserID:    &id,
+				Metadata:  map[string]string{"grace_period_hours": strconv.Itoa(int(s.GracePeriod.Hours()))},
+			})
+		}
+		if len(ids) > 0 {
+			log.Info(
+				"deleted users purged",
+				"event.action", "purge_deleted_users",
+				"event.type", []string{"deletion"},
+				"event.outcome", "success",
+				"purge.count", len(ids))
+		}
+		if len(ids) < s.PurgeBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+// fakeAccountDataRepo hands out the ids in pending, at most limit per call,
+// and remembers the cutoff it was asked for.
+type fakeAccountDataRepo struct {
+	pending []int
+	cutoffs []time.Time
+}
+
+func (r *fakeAccountDataRepo) ExportUserData(ctx context.Context, userID int) (*domain.UserExport, error) {
+	return &domain.UserExport{Profile: domain.ExportedProfile{ID: userID}}, nil
+}
+
+func (r *fakeAccountDataRepo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) ([]int, error) {
+	r.cutoffs = append(r.cutoffs, deletedBefore)
+	n := min(limit, len(r.pending))
+	ids := r.pending[:n]
+	r.pending = r.pending[n:]
+	return ids, nil
+}
+
+func TestPurgeDeletedAccountsDrainsInBatches(t *testing.T) {
+	data := &fakeAccountDataRepo{pending: []int{1, 2, 3, 4, 5}}
+	audit := &fakeAuditRepo{}
+	svc := NewAccountDataService(data, audit, nopLogger{}, 24*time.Hour, 2)
+	now := time.Date(2025, 12, 30, 9, 0, 0, 0, time.UTC)
+
+	if err := svc.PurgeDeletedAccounts(context.Background(), now); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if len(data.cutoffs) != 3 {
+		t.Errorf("batches = %d, want 3", len(data.cutoffs))
+	}
+	if want := now.Add(-24 * time.Hour); !data.cutoffs[0].Equal(want) {
+		t.Errorf("cutoff = %v, want %v", data.cutoffs[0], want)
+	}
+	if len(audit.events) != 5 {
+		t.Fatalf("audit events = %d, want 5", len(audit.events))
+	}
+	for i, e := range audit.events {
+		if e.EventType != domain.AuditUserPurge || e.UserID == nil || *e.UserID != i+1 {
+			t.Errorf("unexpected audit event %+v", e)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+)
+
+type AdminService struct {
+	Users  domain.UserRepository
+	Audit  domain.AuditRepository
+	Logger domain.LoggingRepository
+}
+
+func NewAdminService(users domain.UserRepository, audit domain.AuditRepository, logger domain.LoggingRepository) *AdminService {
+	return &AdminService{Users: users, Audit: audit, Logger: logger}
+}
+
+// ChangeUserRole sets the role of userID. The admin routes check the stored
+// role on every request, so it applies there right away; the role claim of
+// the user's tokens catches up on the next refresh. Admins cannot change
+// their own role, so the last admin cannot lock everyone out by mistake.
+func (s *AdminService) ChangeUserRole(ctx context.Context, userID int, role string) (err error) {
+	log := s.Logger.With("service.name", "admin", "http.request.id", observability.GetRequestID(ctx), "user.id", userID, "event.category", []string{"iam"})
+	var previous string
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditRoleChange, userID, err, map[string]string{"role": role, "previous_role": previous})
+	}()
+
+	if !domain.ValidRole(role) {
+		return domain.ErrInvalidRole
+	}
+	if actorID, ok := observability.GetUserID(ctx); ok && actorID == userID {
+		return domain.ErrOwnRoleChange
+	}
+
+	user, err := s.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	previous = user.Role
+
+	if err = s.Users.UpdateUserRole(ctx, userID, role); err != nil {
+		log.Error(
+			"failed to update user role",
+			"event.action", "update_user_role",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return err
+	}
+
+	log.Info(
+		"user role changed",
+		"event.action", "update_user_role",
+		"event.type", []string{"change", "end"},
+		"event.outcome", "success",
+		"user.roles", []string{role})
+	return nil
+}
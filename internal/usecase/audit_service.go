@@ -0,0 +1,119 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// recordAudit stores e with the request ID, client IP and caller taken from
+// ctx. A failed write is logged but does not fail the request it describes.
+func recordAudit(ctx context.Context, audit domain.AuditRepository, log domain.LoggingRepository, e domain.AuditEvent) {
+	e.RequestID = observability.GetRequestID(ctx)
+	e.ClientIP = observability.GetClientIP(ctx)
+	if actorID, ok := observability.GetUserID(ctx); ok && e.ActorID == nil {
+		e.ActorID = &actorID
+	}
+	if err := audit.RecordAuditEvent(ctx, e); err != nil {
+		log.Error(
+			"failed to record audit event",
+			"event.action", "record_audit_event",
+			"event.type", []string{"error"},
+			"event.outcome", "failed",
+			"audit.event_type", e.EventType,
+			"error.message", err.Error())
+	}
+}
+
+// auditOutcome records eventType as a success, or as a failure with the reason
+// taken from err.
+func auditOutcome(ctx context.Context, audit domain.AuditRepository, log domain.LoggingRepository, eventType string, userID int, err error, metadata map[string]string) {
+	e := domain.AuditEvent{EventType: eventType, Outcome: domain.AuditOutcomeSuccess, Metadata: metadata}
+	if userID != 0 {
+		e.UserID = &userID
+	}
+	if err != nil {
+		e.Outcome = domain.AuditOutcomeFailure
+		if e.Metadata == nil {
+			e.Metadata = make(map[string]string, 1)
+		}
+		e.Metadata["reason"] = auditReason(err)
+	}
+	recordAudit(ctx, audit, log, e)
+}
+
+// auditReason keeps the message of domain errors only; anything else may
+// carry driver or network details that do not belong in the audit log.
+func auditReason(err error) string {
+	var de *domain.DomainError
+	if errors.As(err, &de) {
+		return de.Message
+	}
+	return "internal error"
+}
+
+type AuditEventsPage struct {
+	Events []domain.AuditEvent
+	// NextCursor is the BeforeID of the next page, 0 on the last page.
+	NextCursor int64
+}
+
+type AuditService struct {
+	Audit  domain.AuditRepository
+	Logger domain.LoggingRepository
+}
+
+func NewAuditService(audit domain.AuditRepository, logger domain.LoggingRepository) *AuditService {
+	return &AuditService{Audit: audit, Logger: logger}
+}
+
+// ListEvents returns one page of events. Reading the audit log is itself
+// recorded.
+func (s *AuditService) ListEvents(ctx context.Context, f domain.AuditFilter) (*AuditEventsPage, error) {
+	log := s.Logger.With("service.name", "audit", "http.request.id", observability.GetRequestID(ctx), "event.category", []string{"iam"})
+
+	if f.Limit <= 0 {
+		f.Limit = defaultAuditPageSize
+	}
+	if f.Limit > maxAuditPageSize {
+		return nil, domain.NewDomainError(domain.ErrCodeValidation, "limit must not be larger than "+strconv.Itoa(maxAuditPageSize), nil)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return nil, domain.NewDomainError(domain.ErrCodeValidation, "from must be before to", nil)
+	}
+
+	events, err := s.Audit.ListAuditEvents(ctx, f)
+	if err != nil {
+		log.Error(
+			"failed to list audit events",
+			"event.action", "list_audit_events",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	metadata := map[string]string{"event_type": f.EventType}
+	if f.UserID != nil {
+		metadata["user_id"] = strconv.Itoa(*f.UserID)
+	}
+	recordAudit(ctx, s.Audit, log, domain.AuditEvent{
+		EventType: domain.AuditAuditLogQuery,
+		Outcome:   domain.AuditOutcomeSuccess,
+		Metadata:  metadata,
+	})
+
+	page := &AuditEventsPage{Events: events}
+	if len(events) == f.Limit {
+		page.NextCursor = events[len(events)-1].ID
+	}
+	return page, nil
+}
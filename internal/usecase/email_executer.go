@@ -2,20 +2,23 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
 )
 
 type EmailSenderService struct {
-	Mailer domain.Mailer
-	Logger domain.LoggingRepository
+	UserRepo domain.UserRepository
+	Mailer   domain.Mailer
+	Logger   domain.LoggingRepository
 }
 
-func NewEmailSenderService(mailer domain.Mailer, logger domain.LoggingRepository) *EmailSenderService {
+func NewEmailSenderService(userrepo domain.UserRepository, mailer domain.Mailer, logger domain.LoggingRepository) *EmailSenderService {
 	return &EmailSenderService{
-		Mailer: mailer,
-		Logger: logger,
+		UserRepo: userrepo,
+		Mailer:   mailer,
+		Logger:   logger,
 	}
 }
 func (es *EmailSenderService) Execute(ctx context.Context, emailjob domain.Job) error {
@@ -28,8 +31,20 @@ func (es *EmailSenderService) Execute(ctx context.Context, emailjob domain.Job)
 		"story.job.id", emailjob.JobID,
 		"event.category", []string{"email"})
 
+	if _, err := es.UserRepo.GetUserByID(ctx, emailjob.UserID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			log.Warn(
+				"user no longer exists, email job cancelled",
+				"event.action", "get_user_by_id",
+				"event.type", []string{"end"},
+				"event.outcome", "failed")
+			return domain.ErrJobCancelled
+		}
+		return err
+	}
+
 	start := time.Now()
-	err := es.Mailer.SendNotificationEmail(emailjob.UserEmail)
+	err := es.Mailer.SendNotificationEmail(ctx, emailjob.UserEmail)
 	if err != nil {
 		log.Error(
 			"failed to send notification email to user",
@@ -69,9 +69,12 @@ func (s StoryGenerationJobCompletion) OnSuccess(ctx context.Context, job domain.
 		"event.category", []string{"process"})
 	log.Info("completion of story job on success condition started", "event.type", []string{"start"})
 
-	if err := s.TaskStreamHandler.Ack(ctx, MessageID, s.StoryStream); err != nil {
+	stream := domain.PriorityStream(s.StoryStream, job.Priority)
+	notificationStream := domain.PriorityStream(s.NotificationStream, job.Priority)
+
+	if err := s.TaskStreamHandler.Ack(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to acknowledge the message from %s", s.StoryStream),
+			fmt.Sprintf("failed to acknowledge the message from %s", stream),
 			"event.action", "ack_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -80,9 +83,9 @@ func (s StoryGenerationJobCompletion) OnSuccess(ctx context.Context, job domain.
 		return err
 	}
 
-	if err := s.TaskStreamHandler.Delete(ctx, MessageID, s.StoryStream); err != nil {
+	if err := s.TaskStreamHandler.Delete(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to delete the message from %s", s.StoryStream),
+			fmt.Sprintf("failed to delete the message from %s", stream),
 			"event.action", "delete_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -90,9 +93,9 @@ func (s StoryGenerationJobCompletion) OnSuccess(ctx context.Context, job domain.
 		return err
 	}
 
-	if err := s.TaskStreamHandler.Add(ctx, job, s.NotificationStream); err != nil {
+	if err := s.TaskStreamHandler.Add(ctx, job, notificationStream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to add the job to %s", s.NotificationStream),
+			fmt.Sprintf("failed to add the job to %s", notificationStream),
 			"event.action", "add_email_notification_job",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -128,9 +131,11 @@ func (e EmailNotificationJobCompletion) OnSuccess(ctx context.Context, job domai
 		"event.category", []string{"process"})
 	log.Info("completion of email job on success condition started", "event.type", []string{"start"})
 
-	if err := e.TaskStreamHandler.Ack(ctx, MessageID, e.EmailStream); err != nil {
+	stream := domain.PriorityStream(e.EmailStream, job.Priority)
+
+	if err := e.TaskStreamHandler.Ack(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to acknowledge the message from %s", e.EmailStream),
+			fmt.Sprintf("failed to acknowledge the message from %s", stream),
 			"event.action", "ack_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -138,9 +143,9 @@ func (e EmailNotificationJobCompletion) OnSuccess(ctx context.Context, job domai
 		return err
 	}
 
-	if err := e.TaskStreamHandler.Delete(ctx, MessageID, e.EmailStream); err != nil {
+	if err := e.TaskStreamHandler.Delete(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to delete the message from %s", e.EmailStream),
+			fmt.Sprintf("failed to delete the message from %s", stream),
 			"event.action", "delete_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -174,6 +179,8 @@ func (s StoryGenerationJobCompletion) OnFailure(ctx context.Context, job domain.
 		"event.category", []string{"process"})
 	log.Info("completion of story job on failure condition started", "event.type", []string{"start"})
 
+	stream := domain.PriorityStream(s.StoryStream, job.Priority)
+
 	job.RetryCounts++
 	err := s.TaskStreamHandler.ScheduleRetry(ctx, job, s.StoryStream)
 	if err != nil {
@@ -185,9 +192,9 @@ func (s StoryGenerationJobCompletion) OnFailure(ctx context.Context, job domain.
 			"error.message", err.Error())
 		return err
 	}
-	if err := s.TaskStreamHandler.Ack(ctx, MessageID, s.StoryStream); err != nil {
+	if err := s.TaskStreamHandler.Ack(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to acknowledge the message from %s", s.StoryStream),
+			fmt.Sprintf("failed to acknowledge the message from %s", stream),
 			"event.action", "ack_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -195,9 +202,9 @@ func (s StoryGenerationJobCompletion) OnFailure(ctx context.Context, job domain.
 		return err
 	}
 
-	if err := s.TaskStreamHandler.Delete(ctx, MessageID, s.StoryStream); err != nil {
+	if err := s.TaskStreamHandler.Delete(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to delete the message from %s", s.StoryStream),
+			fmt.Sprintf("failed to delete the message from %s", stream),
 			"event.action", "delete_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -234,6 +241,8 @@ func (e EmailNotificationJobCompletion) OnFailure(ctx context.Context, job domai
 		"event.category", []string{"process"})
 	log.Info("completion of story job on failure condition started", "event.type", []string{"start"})
 
+	stream := domain.PriorityStream(e.EmailStream, job.Priority)
+
 	job.RetryCounts++
 	if err := e.TaskStreamHandler.ScheduleRetry(ctx, job, e.EmailStream); err != nil {
 		log.Error(
@@ -244,9 +253,9 @@ func (e EmailNotificationJobCompletion) OnFailure(ctx context.Context, job domai
 			"error.message", err.Error())
 		return err
 	}
-	if err := e.TaskStreamHandler.Ack(ctx, MessageID, e.EmailStream); err != nil {
+	if err := e.TaskStreamHandler.Ack(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to acknowledge the message from %s", e.EmailStream),
+			fmt.Sprintf("failed to acknowledge the message from %s", stream),
 			"event.action", "ack_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -254,9 +263,9 @@ func (e EmailNotificationJobCompletion) OnFailure(ctx context.Context, job domai
 		return err
 	}
 
-	if err := e.TaskStreamHandler.Delete(ctx, MessageID, e.EmailStream); err != nil {
+	if err := e.TaskStreamHandler.Delete(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to delete the message from %s", e.EmailStream),
+			fmt.Sprintf("failed to delete the message from %s", stream),
 			"event.action", "delete_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -293,6 +302,8 @@ func (s StoryGenerationJobCompletion) SendToDQL(ctx context.Context, job domain.
 		"event.category", []string{"process"})
 	log.Info("sending the story job to dlq started", "event.type", []string{"start"})
 
+	stream := domain.PriorityStream(s.StoryStream, job.Priority)
+
 	if err := s.TaskStreamHandler.Add(ctx, job, s.DeadLetterQueueStream); err != nil {
 		log.Error(
 			fmt.Sprintf("failed to add the job to %s", s.DeadLetterQueueStream),
@@ -302,9 +313,9 @@ func (s StoryGenerationJobCompletion) SendToDQL(ctx context.Context, job domain.
 			"error.message", err.Error())
 		return err
 	}
-	if err := s.TaskStreamHandler.Ack(ctx, MessageID, s.StoryStream); err != nil {
+	if err := s.TaskStreamHandler.Ack(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to acknowledge the message from %s", s.StoryStream),
+			fmt.Sprintf("failed to acknowledge the message from %s", stream),
 			"event.action", "ack_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -312,9 +323,9 @@ func (s StoryGenerationJobCompletion) SendToDQL(ctx context.Context, job domain.
 		return err
 	}
 
-	if err := s.TaskStreamHandler.Delete(ctx, MessageID, s.StoryStream); err != nil {
+	if err := s.TaskStreamHandler.Delete(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to delete the message from %s", s.StoryStream),
+			fmt.Sprintf("failed to delete the message from %s", stream),
 			"event.action", "delete_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -350,6 +361,8 @@ func (e EmailNotificationJobCompletion) SendToDQL(ctx context.Context, job domai
 		"event.category", []string{"process"})
 	log.Info("sending the email job to dlq started", "event.type", []string{"start"})
 
+	stream := domain.PriorityStream(e.EmailStream, job.Priority)
+
 	if err := e.TaskStreamHandler.Add(ctx, job, e.DeadLetterQueueStream); err != nil {
 		log.Error(
 			fmt.Sprintf("failed to add the job to %s", e.DeadLetterQueueStream),
@@ -360,9 +373,9 @@ func (e EmailNotificationJobCompletion) SendToDQL(ctx context.Context, job domai
 		return err
 	}
 
-	if err := e.TaskStreamHandler.Ack(ctx, MessageID, e.EmailStream); err != nil {
+	if err := e.TaskStreamHandler.Ack(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to acknowledge the message from %s", e.EmailStream),
+			fmt.Sprintf("failed to acknowledge the message from %s", stream),
 			"event.action", "ack_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -370,9 +383,9 @@ func (e EmailNotificationJobCompletion) SendToDQL(ctx context.Context, job domai
 		return err
 	}
 
-	if err := e.TaskStreamHandler.Delete(ctx, MessageID, e.EmailStream); err != nil {
+	if err := e.TaskStreamHandler.Delete(ctx, MessageID, stream); err != nil {
 		log.Error(
-			fmt.Sprintf("failed to delete the message from %s", e.EmailStream),
+			fmt.Sprintf("failed to delete the message from %s", stream),
 			"event.action", "delete_message",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
@@ -396,3 +409,54 @@ func (e EmailNotificationJobCompletion) SendToDQL(ctx context.Context, job domai
 
 	return nil
 }
+
+func (s StoryGenerationJobCompletion) OnCancel(ctx context.Context, job domain.Job, MessageID string) error {
+	return dropMessage(ctx, s.TaskStreamHandler, s.Logger, "story-workers", domain.PriorityStream(s.StoryStream, job.Priority), job, MessageID)
+}
+
+func (e EmailNotificationJobCompletion) OnCancel(ctx context.Context, job domain.Job, MessageID string) error {
+	return dropMessage(ctx, e.TaskStreamHandler, e.Logger, "email-workers", domain.PriorityStream(e.EmailStream, job.Priority), job, MessageID)
+}
+
+// dropMessage acks and deletes a cancelled job. The user is soft-deleted and
+// its job rows were already marked cancelled by the deletion, so there is no
+// status left to update. Messages still in the streams or retry sets are not
+// removed at deletion time, since they cannot be looked up by user; they are
+// dropped here once a worker picks them up.
+func dropMessage(ctx context.Context, tasks domain.StreamTaskHandler, logger domain.LoggingRepository, service string, stream string, job domain.Job, MessageID string) error {
+	log := logger.With(
+		"service.name", service,
+		"http.request.id", job.RequestID,
+		"stream.message.id", MessageID,
+		"user.id", job.UserID,
+		"story.id", job.StoryID,
+		"story.job.id", job.JobID,
+		"event.category", []string{"process"})
+
+	if err := tasks.Ack(ctx, MessageID, stream); err != nil {
+		log.Error(
+			fmt.Sprintf("failed to acknowledge the message from %s", stream),
+			"event.action", "ack_message",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return err
+	}
+
+	if err := tasks.Delete(ctx, MessageID, stream); err != nil {
+		log.Error(
+			fmt.Sprintf("failed to delete the message from %s", stream),
+			"event.action", "delete_message",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return err
+	}
+
+	log.Info(
+		"cancelled job dropped",
+		"event.action", "cancel_job",
+		"event.type", []string{"end", "deletion"},
+		"event.outcome", "success")
+	return nil
+}
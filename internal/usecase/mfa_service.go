@@ -0,0 +1,254 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+)
+
+const recoveryCodeCount = 10
+
+// MFAService manages TOTP enrollment and the second login step. Login hands
+// out a challenge, stored hashed like an OTP, that CompleteMFALogin trades
+// for a session together with a TOTP or recovery code.
+type MFAService struct {
+	Users               domain.UserRepository
+	Factors             domain.MFARepository
+	TOTP                domain.TOTPService
+	Cipher              domain.SecretCipher
+	Hasher              domain.HashRepository
+	Challenges          domain.OTPService
+	ChallengeTokens     domain.TokenGenerator
+	RecoveryCodes       domain.TokenGenerator
+	ChallengeExpiration int
+	Audit               domain.AuditRepository
+	Logger              domain.LoggingRepository
+}
+
+func NewMFAService(
+	users domain.UserRepository,
+	factors domain.MFARepository,
+	totp domain.TOTPService,
+	cipher domain.SecretCipher,
+	hasher domain.HashRepository,
+	challenges domain.OTPService,
+	challengeTokens domain.TokenGenerator,
+	recoveryCodes domain.TokenGenerator,
+	challengeExpiration int,
+	audit domain.AuditRepository,
+	logger domain.LoggingRepository,
+) *MFAService {
+	return &MFAService{
+		Users:               users,
+		Factors:             factors,
+		TOTP:                totp,
+		Cipher:              cipher,
+		Hasher:              hasher,
+		Challenges:          challenges,
+		ChallengeTokens:     challengeTokens,
+		RecoveryCodes:       recoveryCodes,
+		ChallengeExpiration: challengeExpiration,
+		Audit:               audit,
+		Logger:              logger}
+}
+
+func (s *MFAService) logger(ctx context.Context, userID int) domain.LoggingRepository {
+	return s.Logger.With("service.name", "mfa", "http.request.id", observability.GetRequestID(ctx), "user.id", userID, "event.category", []string{"iam"})
+}
+
+func mfaChallengeKey(userID int) string {
+	return fmt.Sprintf("mfa-challenge:%d", userID)
+}
+
+// Enroll creates a new TOTP secret and recovery codes. Until Activate
+// succeeds login does not ask for them, and enrolling again replaces both.
+// The password is asked again, so a stolen access token cannot enroll an
+// authenticator of its own and lock the owner out.
+func (s *MFAService) Enroll(ctx context.Context, userID int, password string) (*domain.MFAEnrollment, error) {
+	log := s.logger(ctx, userID)
+
+	user, err := s.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Hasher.VerifyHash([]byte(user.Password), password, false); err != nil {
+		log.Warn(
+			"mfa enrollment not confirmed",
+			"event.action", "confirm_mfa_enrollment",
+			"event.type", []string{"denied", "end"},
+			"event.outcome", "failed")
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	secret, err := s.TOTP.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.Cipher.Encrypt(secret)
+	if err != nil {
+		log.Error(
+			"failed to encrypt totp secret",
+			"event.action", "encrypt_totp_secret",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := s.RecoveryCodes.GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := s.Hasher.Hash(code, false)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hash)
+	}
+
+	if err := s.Factors.SaveMFAEnrollment(ctx, userID, encrypted, hashes); err != nil {
+		log.Error(
+			"failed to save mfa enrollment",
+			"event.action", "save_mfa_enrollment",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	log.Info(
+		"mfa enrollment started",
+		"event.action", "enroll_mfa",
+		"event.type", []string{"creation"},
+		"event.outcome", "success")
+	return &domain.MFAEnrollment{URI: s.TOTP.ProvisioningURI(secret, user.Email), RecoveryCodes: codes}, nil
+}
+
+// Activate turns MFA on once code shows the authenticator app was set up.
+func (s *MFAService) Activate(ctx context.Context, userID int, code string) (err error) {
+	log := s.logger(ctx, userID)
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditMFAEnrollment, userID, err, nil)
+	}()
+
+	m, err := s.Factors.GetMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if m.EnabledAt != nil {
+		return domain.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := s.Cipher.Decrypt(m.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := s.TOTP.Validate(secret, code, time.Now())
+	if !ok {
+		return domain.ErrInvalidMFACode
+	}
+	// the activation code cannot be replayed for a login either
+	if err = s.Factors.UseTOTPStep(ctx, userID, step); err != nil {
+		return err
+	}
+
+	if err = s.Factors.EnableMFA(ctx, userID); err != nil {
+		return err
+	}
+
+	log.Info(
+		"mfa enabled",
+		"event.action", "enable_mfa",
+		"event.type", []string{"change", "end"},
+		"event.outcome", "success")
+	return nil
+}
+
+func (s *MFAService) enabled(ctx context.Context, userID int) (bool, error) {
+	m, err := s.Factors.GetMFA(ctx, userID)
+	if errors.Is(err, domain.ErrMFANotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return m.EnabledAt != nil, nil
+}
+
+// issueChallenge returns "<user id>.<token>"; only the token's hash is kept.
+func (s *MFAService) issueChallenge(ctx context.Context, log domain.LoggingRepository, userID int) (string, error) {
+	token, err := s.ChallengeTokens.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	hash, err := s.Hasher.Hash(token, false)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Challenges.SaveOTP(ctx, mfaChallengeKey(userID), hash, s.ChallengeExpiration); err != nil {
+		log.Error(
+			"failed to save mfa challenge",
+			"user.id", userID,
+			"event.action", "save_mfa_challenge",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return "", err
+	}
+	return strconv.Itoa(userID) + "." + token, nil
+}
+
+// verifyChallenge consumes the challenge and checks code, first as a TOTP and
+// then as a recovery code. It returns the user and which of the two matched.
+func (s *MFAService) verifyChallenge(ctx context.Context, challenge string, code string) (int, string, error) {
+	id, token, ok := strings.Cut(challenge, ".")
+	userID, err := strconv.Atoi(id)
+	if !ok || err != nil {
+		return 0, "", domain.ErrInvalidMFAChallenge
+	}
+
+	err = s.Challenges.VerifyOTP(ctx, mfaChallengeKey(userID), token)
+	if errors.Is(err, domain.ErrOtpKeyNotFound) || errors.Is(err, domain.ErrInvalidOtp) {
+		return 0, "", domain.ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	m, err := s.Factors.GetMFA(ctx, userID)
+	if err != nil {
+		return userID, "", err
+	}
+	secret, err := s.Cipher.Decrypt(m.Secret)
+	if err != nil {
+		return userID, "", err
+	}
+	if step, ok := s.TOTP.Validate(secret, code, time.Now()); ok {
+		// a code stays valid for up to three steps, but works only once
+		if err := s.Factors.UseTOTPStep(ctx, userID, step); err != nil {
+			return userID, "", err
+		}
+		return userID, "totp", nil
+	}
+
+	for _, hash := range m.RecoveryCodes {
+		if s.Hasher.VerifyHash([]byte(hash), code, false) != nil {
+			continue
+		}
+		if err := s.Factors.UseRecoveryCode(ctx, userID, hash); err != nil {
+			return userID, "", err
+		}
+		return userID, "recovery_code", nil
+	}
+	return userID, "", domain.ErrInvalidMFACode
+}
@@ -0,0 +1,159 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+type fakeMFARepo struct {
+	factors map[int]*domain.MFA
+}
+
+func (r *fakeMFARepo) SaveMFAEnrollment(ctx context.Context, userID int, secret []byte, recoveryCodes []string) error {
+	if m, ok := r.factors[userID]; ok && m.EnabledAt != nil {
+		return domain.ErrMFAAlreadyEnabled
+	}
+	r.factors[userID] = &domain.MFA{UserID: userID, Secret: secret, RecoveryCodes: recoveryCodes}
+	return nil
+}
+
+func (r *fakeMFARepo) GetMFA(ctx context.Context, userID int) (*domain.MFA, error) {
+	m, ok := r.factors[userID]
+	if !ok {
+		return nil, domain.ErrMFANotEnrolled
+	}
+	copied := *m
+	return &copied, nil
+}
+
+func (r *fakeMFARepo) EnableMFA(ctx context.Context, userID int) error {
+	now := time.Now()
+	r.factors[userID].EnabledAt = &now
+	return nil
+}
+
+func (r *fakeMFARepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	m := r.factors[userID]
+	for i, h := range m.RecoveryCodes {
+		if h == codeHash {
+			m.RecoveryCodes = append(m.RecoveryCodes[:i:i], m.RecoveryCodes[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrInvalidMFACode
+}
+
+func (r *fakeMFARepo) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	m := r.factors[userID]
+	if m.LastTOTPStep != nil && *m.LastTOTPStep >= step {
+		return domain.ErrInvalidMFACode
+	}
+	m.LastTOTPStep = &step
+	return nil
+}
+
+// fakeTOTP accepts the secret itself as the code of the current step, which
+// tests move forward to stand for the next code from the app.
+type fakeTOTP struct {
+	step int64
+}
+
+func (*fakeTOTP) GenerateSecret() ([]byte, error) { return []byte("123456"), nil }
+
+func (*fakeTOTP) ProvisioningURI(secret []byte, account string) string {
+	return "otpauth://totp/test:" + account
+}
+
+func (t *fakeTOTP) Validate(secret []byte, code string, at time.Time) (int64, bool) {
+	return t.step, string(secret) == code
+}
+
+type plainCipher struct{}
+
+func (plainCipher) Encrypt(plaintext []byte) ([]byte, error)  { return plaintext, nil }
+func (plainCipher) Decrypt(ciphertext []byte) ([]byte, error) { return ciphertext, nil }
+
+type countingTokens struct{ n int }
+
+func (c *countingTokens) GenerateToken() (string, error) {
+	c.n++
+	return fmt.Sprintf("code-%d", c.n), nil
+}
+
+func TestLoginAsksForSecondFactorOnceMFAIsEnabled(t *testing.T) {
+	ctx := context.Background()
+	users := newLoginUsers()
+	otps := &fakeOTPs{}
+	factors := &fakeMFARepo{factors: make(map[int]*domain.MFA)}
+	totp := &fakeTOTP{}
+	mfa := NewMFAService(users, factors, totp, plainCipher{}, plainHasher{}, otps, fixedToken("challenge"), &countingTokens{}, 5, &fakeAuditRepo{}, nopLogger{})
+	svc := NewUserRegisterService(users, nil, plainHasher{}, nil, otps, nil, nil, fakeJwt{}, fakeRefreshTokenRepo{}, mfa, &fakeAuditRepo{}, nopLogger{})
+	creds := domain.LoginUser{Email: "reza@example.com", Password: "secret-password"}
+
+	login := func() *UserServiceAuthResponse {
+		t.Helper()
+		resp, err := svc.AuthenticateUser(ctx, creds)
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		return resp
+	}
+
+	if _, err := mfa.Enroll(ctx, 7, "guess"); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("enroll with a wrong password: got %v, want %v", err, domain.ErrInvalidCredentials)
+	}
+	enrollment, err := mfa.Enroll(ctx, 7, "secret-password")
+	if err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	if len(enrollment.RecoveryCodes) != recoveryCodeCount || !strings.HasPrefix(enrollment.URI, "otpauth://") {
+		t.Fatalf("unexpected enrollment %+v", enrollment)
+	}
+	if resp := login(); resp.AccessToken == "" || resp.MFAChallenge != "" {
+		t.Errorf("MFA asked for before it was activated: %+v", resp)
+	}
+
+	if err := mfa.Activate(ctx, 7, "000000"); !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Errorf("activate with a wrong code: got %v, want %v", err, domain.ErrInvalidMFACode)
+	}
+	if err := mfa.Activate(ctx, 7, "123456"); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+
+	resp := login()
+	if resp.AccessToken != "" || resp.MFAChallenge == "" {
+		t.Fatalf("want only a challenge, got %+v", resp)
+	}
+	if _, err := svc.CompleteMFALogin(ctx, resp.MFAChallenge, "999999"); !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Errorf("wrong code: got %v, want %v", err, domain.ErrInvalidMFACode)
+	}
+	if _, err := svc.CompleteMFALogin(ctx, resp.MFAChallenge, "123456"); !errors.Is(err, domain.ErrInvalidMFAChallenge) {
+		t.Errorf("reused challenge: got %v, want %v", err, domain.ErrInvalidMFAChallenge)
+	}
+	if _, err := svc.CompleteMFALogin(ctx, login().MFAChallenge, "123456"); !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Errorf("code already used to activate: got %v, want %v", err, domain.ErrInvalidMFACode)
+	}
+
+	totp.step++
+	tokens, err := svc.CompleteMFALogin(ctx, login().MFAChallenge, "123456")
+	if err != nil || tokens.AccessToken == "" {
+		t.Fatalf("totp login: %+v %v", tokens, err)
+	}
+	if _, err := svc.CompleteMFALogin(ctx, login().MFAChallenge, "123456"); !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Errorf("replayed totp: got %v, want %v", err, domain.ErrInvalidMFACode)
+	}
+
+	recovery := enrollment.RecoveryCodes[0]
+	if _, err := svc.CompleteMFALogin(ctx, login().MFAChallenge, recovery); err != nil {
+		t.Fatalf("recovery code login: %v", err)
+	}
+	if _, err := svc.CompleteMFALogin(ctx, login().MFAChallenge, recovery); !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Errorf("reused recovery code: got %v, want %v", err, domain.ErrInvalidMFACode)
+	}
+}
@@ -0,0 +1,249 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+)
+
+// OIDCService logs users in through an external OpenID provider. Identities
+// are matched by provider and subject. The first login creates an account
+// for a verified email nobody uses yet. An email that belongs to a local
+// account is only linked automatically when TrustEmails is set; otherwise
+// the owner logs in and links the provider through StartLink.
+type OIDCService struct {
+	Provider    domain.IdentityProvider
+	States      domain.OIDCStateStore
+	Identities  domain.IdentityRepository
+	Users       domain.UserRepository
+	Tokens      domain.TokenGenerator
+	Sessions    *UserService
+	StateTTL    time.Duration
+	TrustEmails bool
+	Audit       domain.AuditRepository
+	Logger      domain.LoggingRepository
+}
+
+func NewOIDCService(
+	provider domain.IdentityProvider,
+	states domain.OIDCStateStore,
+	identities domain.IdentityRepository,
+	users domain.UserRepository,
+	tokens domain.TokenGenerator,
+	sessions *UserService,
+	stateTTL time.Duration,
+	trustEmails bool,
+	audit domain.AuditRepository,
+	logger domain.LoggingRepository,
+) *OIDCService {
+	return &OIDCService{
+		Provider:    provider,
+		States:      states,
+		Identities:  identities,
+		Users:       users,
+		Tokens:      tokens,
+		Sessions:    sessions,
+		StateTTL:    stateTTL,
+		TrustEmails: trustEmails,
+		Audit:       audit,
+		Logger:      logger}
+}
+
+func (s *OIDCService) logger(ctx context.Context) domain.LoggingRepository {
+	return s.Logger.With("service.name", "oidc", "http.request.id", observability.GetRequestID(ctx), "event.category", []string{"authentication"})
+}
+
+// Start returns the provider URL to send the browser to and the state. The
+// PKCE verifier and the nonce stay on our side, under the state the callback
+// brings back. The caller binds the state to the browser, so a callback
+// started by someone else is refused.
+func (s *OIDCService) Start(ctx context.Context) (string, string, error) {
+	return s.start(ctx, 0)
+}
+
+// StartLink is Start for a logged in user; the callback links the external
+// identity to userID instead of looking it up by email.
+func (s *OIDCService) StartLink(ctx context.Context, userID int) (string, string, error) {
+	return s.start(ctx, userID)
+}
+
+func (s *OIDCService) start(ctx context.Context, linkUserID int) (string, string, error) {
+	if s.Provider == nil {
+		return "", "", domain.ErrOIDCDisabled
+	}
+	log := s.logger(ctx)
+
+	var values [3]string
+	for i := range values {
+		v, err := s.Tokens.GenerateToken()
+		if err != nil {
+			return "", "", err
+		}
+		values[i] = v
+	}
+	state, verifier, nonce := values[0], values[1], values[2]
+
+	if err := s.States.SaveOIDCState(ctx, state, domain.OIDCState{CodeVerifier: verifier, Nonce: nonce, LinkUserID: linkUserID}, s.StateTTL); err != nil {
+		log.Error(
+			"failed to save oidc state",
+			"event.action", "save_oidc_state",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	target, err := s.Provider.AuthCodeURL(ctx, state, base64.RawURLEncoding.EncodeToString(challenge[:]), nonce)
+	if err != nil {
+		return "", "", err
+	}
+	return target, state, nil
+}
+
+// Callback finishes the login the provider redirected back with. boundState
+// is the state the browser kept from Start; without it anyone could send a
+// victim their own callback and log them in to, or link, the wrong account.
+// Like any other login it may end in an MFA challenge.
+func (s *OIDCService) Callback(ctx context.Context, state string, boundState string, code string) (_ *UserServiceAuthResponse, err error) {
+	if s.Provider == nil {
+		return nil, domain.ErrOIDCDisabled
+	}
+	log := s.logger(ctx)
+	var userID int
+	metadata := map[string]string{"method": "oidc", "provider": s.Provider.Name()}
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditLogin, userID, err, metadata)
+	}()
+
+	if boundState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(boundState)) != 1 {
+		log.Warn(
+			"oidc state not bound to this browser",
+			"event.action", "check_oidc_state",
+			"event.type", []string{"end", "denied"},
+			"event.outcome", "failed")
+		return nil, domain.ErrInvalidOIDCState
+	}
+
+	saved, err := s.States.TakeOIDCState(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.Provider.Exchange(ctx, code, saved.CodeVerifier)
+	if err != nil {
+		log.Warn(
+			"provider login failed",
+			"event.action", "exchange_authorization_code",
+			"event.type", []string{"end", "denied"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+	if identity.Nonce != saved.Nonce {
+		return nil, domain.ErrInvalidOIDCState
+	}
+
+	if saved.LinkUserID != 0 {
+		metadata["link"] = "true"
+		userID = saved.LinkUserID
+		err = s.linkUser(ctx, log, userID, *identity)
+	} else {
+		userID, err = s.resolveUser(ctx, log, *identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sessions.finishLogin(ctx, log, u, metadata)
+}
+
+func (s *OIDCService) resolveUser(ctx context.Context, log domain.LoggingRepository, identity domain.ExternalIdentity) (int, error) {
+	userID, err := s.Identities.GetUserIDByIdentity(ctx, identity.Provider, identity.Subject)
+	if !errors.Is(err, domain.ErrIdentityNotFound) {
+		return userID, err
+	}
+
+	// without a verified email anyone could claim an existing account
+	if !identity.EmailVerified || identity.Email == "" {
+		return 0, domain.ErrUnverifiedIdentity
+	}
+
+	u, err := s.Users.GetUserByEmail(ctx, identity.Email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		userID, err = s.Identities.CreateUserWithIdentity(ctx, identity)
+		if err != nil {
+			return 0, err
+		}
+		log.Info(
+			"user created from external identity",
+			"user.id", userID,
+			"event.action", "create_user_with_identity",
+			"event.type", []string{"creation"},
+			"event.outcome", "success")
+		return userID, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// a provider that does not own the emails it verifies could hand anyone
+	// this account
+	if !s.TrustEmails {
+		log.Warn(
+			"email belongs to a local account, link refused",
+			"user.id", u.ID,
+			"event.action", "link_identity",
+			"event.type", []string{"denied"},
+			"event.outcome", "failed")
+		return 0, domain.ErrIdentityLinkRequired
+	}
+
+	if err := s.Identities.LinkIdentity(ctx, u.ID, identity); err != nil {
+		return 0, err
+	}
+	log.Info(
+		"external identity linked",
+		"user.id", u.ID,
+		"event.action", "link_identity",
+		"event.type", []string{"change"},
+		"event.outcome", "success")
+	return u.ID, nil
+}
+
+// linkUser links identity to the logged in user that started the login with
+// StartLink. The email does not matter here, the user already proved who
+// they are.
+func (s *OIDCService) linkUser(ctx context.Context, log domain.LoggingRepository, userID int, identity domain.ExternalIdentity) error {
+	linked, err := s.Identities.GetUserIDByIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if linked != userID {
+			return domain.ErrIdentityLinked
+		}
+		return nil
+	}
+	if !errors.Is(err, domain.ErrIdentityNotFound) {
+		return err
+	}
+
+	if err := s.Identities.LinkIdentity(ctx, userID, identity); err != nil {
+		return err
+	}
+	log.Info(
+		"external identity linked by its user",
+		"user.id", userID,
+		"event.action", "link_identity",
+		"event.type", []string{"change"},
+		"event.outcome", "success")
+	return nil
+}
@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+// fakeProvider returns identity for any code, echoing the nonce it was given.
+type fakeProvider struct {
+	identity domain.ExternalIdentity
+	nonce    string
+}
+
+func (p *fakeProvider) Name() string { return "mock" }
+
+func (p *fakeProvider) AuthCodeURL(ctx context.Context, state string, codeChallenge string, nonce string) (string, error) {
+	p.nonce = nonce
+	return "https://idp.example.com/authorize?state=" + state, nil
+}
+
+func (p *fakeProvider) Exchange(ctx context.Context, code string, codeVerifier string) (*domain.ExternalIdentity, error) {
+	identity := p.identity
+	identity.Nonce = p.nonce
+	return &identity, nil
+}
+
+type fakeStates map[string]domain.OIDCState
+
+func (f fakeStates) SaveOIDCState(ctx context.Context, state string, s domain.OIDCState, ttl time.Duration) error {
+	f[state] = s
+	return nil
+}
+
+func (f fakeStates) TakeOIDCState(ctx context.Context, state string) (*domain.OIDCState, error) {
+	s, ok := f[state]
+	if !ok {
+		return nil, domain.ErrInvalidOIDCState
+	}
+	delete(f, state)
+	return &s, nil
+}
+
+type fakeIdentities struct {
+	users *loginUserRepo
+	links map[string]int
+}
+
+func (f *fakeIdentities) GetUserIDByIdentity(ctx context.Context, provider string, subject string) (int, error) {
+	id, ok := f.links[provider+"/"+subject]
+	if !ok {
+		return 0, domain.ErrIdentityNotFound
+	}
+	return id, nil
+}
+
+func (f *fakeIdentities) LinkIdentity(ctx context.Context, userID int, identity domain.ExternalIdentity) error {
+	f.links[identity.Provider+"/"+identity.Subject] = userID
+	return nil
+}
+
+func (f *fakeIdentities) CreateUserWithIdentity(ctx context.Context, identity domain.ExternalIdentity) (int, error) {
+	id := 100 + len(f.users.users)
+	f.users.users[identity.Email] = &domain.User{ID: id, Email: identity.Email, Role: domain.RoleUser}
+	f.links[identity.Provider+"/"+identity.Subject] = id
+	return id, nil
+}
+
+// oidcLogin runs a login through the provider, started by Start or, with a
+// linkUserID, by StartLink.
+func oidcLogin(t *testing.T, svc *OIDCService, provider *fakeProvider, states fakeStates, identity domain.ExternalIdentity, linkUserID int) (*UserServiceAuthResponse, error) {
+	t.Helper()
+	provider.identity = identity
+	start := svc.Start
+	if linkUserID != 0 {
+		start = func(ctx context.Context) (string, string, error) { return svc.StartLink(ctx, linkUserID) }
+	}
+	_, state, err := start(context.Background())
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, ok := states[state]; !ok {
+		t.Fatalf("state %q not saved", state)
+	}
+	return svc.Callback(context.Background(), state, state, "code")
+}
+
+func TestOIDCCallbackLinksOrCreatesUsers(t *testing.T) {
+	ctx := context.Background()
+	users := newLoginUsers()
+	provider := &fakeProvider{}
+	states := fakeStates{}
+	identities := &fakeIdentities{users: users, links: map[string]int{}}
+	sessions := NewUserRegisterService(users, nil, plainHasher{}, nil, nil, nil, nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, &fakeAuditRepo{}, nopLogger{})
+	svc := NewOIDCService(provider, states, identities, users, &countingTokens{}, sessions, time.Minute, true, &fakeAuditRepo{}, nopLogger{})
+
+	login := func(identity domain.ExternalIdentity) (*UserServiceAuthResponse, error) {
+		t.Helper()
+		return oidcLogin(t, svc, provider, states, identity, 0)
+	}
+
+	existing := domain.ExternalIdentity{Provider: "mock", Subject: "sub-reza", Email: "reza@example.com", EmailVerified: true}
+	if resp, err := login(existing); err != nil || resp.AccessToken == "" {
+		t.Fatalf("login with a verified email of an existing user: %+v %v", resp, err)
+	}
+	if identities.links["mock/sub-reza"] != 7 {
+		t.Errorf("identity not linked to the existing user: %v", identities.links)
+	}
+
+	newcomer := domain.ExternalIdentity{Provider: "mock", Subject: "sub-new", Email: "new@example.com", EmailVerified: true}
+	if _, err := login(newcomer); err != nil {
+		t.Fatalf("first login of a new user: %v", err)
+	}
+	created := identities.links["mock/sub-new"]
+	if created == 0 || users.users["new@example.com"] == nil {
+		t.Fatalf("user not created: %v", identities.links)
+	}
+	newcomer.Email = "changed@example.com"
+	if _, err := login(newcomer); err != nil || identities.links["mock/sub-new"] != created {
+		t.Errorf("returning user not matched by subject: %v %v", identities.links, err)
+	}
+
+	unverified := domain.ExternalIdentity{Provider: "mock", Subject: "sub-admin", Email: "admin@example.com"}
+	if _, err := login(unverified); !errors.Is(err, domain.ErrUnverifiedIdentity) {
+		t.Errorf("unverified email: got %v, want %v", err, domain.ErrUnverifiedIdentity)
+	}
+
+	if _, err := svc.Callback(ctx, "unknown-state", "unknown-state", "code"); !errors.Is(err, domain.ErrInvalidOIDCState) {
+		t.Errorf("unknown state: got %v, want %v", err, domain.ErrInvalidOIDCState)
+	}
+}
+
+func TestOIDCCallbackRefusesToLinkUntrustedEmail(t *testing.T) {
+	users := newLoginUsers()
+	provider := &fakeProvider{}
+	states := fakeStates{}
+	identities := &fakeIdentities{users: users, links: map[string]int{}}
+	sessions := NewUserRegisterService(users, nil, plainHasher{}, nil, nil, nil, nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, &fakeAuditRepo{}, nopLogger{})
+	svc := NewOIDCService(provider, states, identities, users, &countingTokens{}, sessions, time.Minute, false, &fakeAuditRepo{}, nopLogger{})
+
+	claimed := domain.ExternalIdentity{Provider: "mock", Subject: "sub-reza", Email: "reza@example.com", EmailVerified: true}
+	if _, err := oidcLogin(t, svc, provider, states, claimed, 0); !errors.Is(err, domain.ErrIdentityLinkRequired) {
+		t.Fatalf("login with the email of a local account: got %v, want %v", err, domain.ErrIdentityLinkRequired)
+	}
+	if _, linked := identities.links["mock/sub-reza"]; linked {
+		t.Fatalf("identity linked without the owner: %v", identities.links)
+	}
+
+	// the owner logs in locally and links the provider themselves
+	if resp, err := oidcLogin(t, svc, provider, states, claimed, 7); err != nil || resp.AccessToken == "" {
+		t.Fatalf("link from the logged in account: %+v %v", resp, err)
+	}
+	if identities.links["mock/sub-reza"] != 7 {
+		t.Errorf("identity not linked to the owner: %v", identities.links)
+	}
+	if resp, err := oidcLogin(t, svc, provider, states, claimed, 0); err != nil || resp.AccessToken == "" {
+		t.Errorf("login after linking: %+v %v", resp, err)
+	}
+
+	if _, err := oidcLogin(t, svc, provider, states, claimed, 1); !errors.Is(err, domain.ErrIdentityLinked) {
+		t.Errorf("linking an identity of another user: got %v, want %v", err, domain.ErrIdentityLinked)
+	}
+}
+
+func TestOIDCCallbackRequiresTheStartingBrowser(t *testing.T) {
+	ctx := context.Background()
+	users := newLoginUsers()
+	provider := &fakeProvider{}
+	states := fakeStates{}
+	identities := &fakeIdentities{users: users, links: map[string]int{}}
+	sessions := NewUserRegisterService(users, nil, plainHasher{}, nil, nil, nil, nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, &fakeAuditRepo{}, nopLogger{})
+	svc := NewOIDCService(provider, states, identities, users, &countingTokens{}, sessions, time.Minute, true, &fakeAuditRepo{}, nopLogger{})
+
+	// the attacker starts a link to their own account and sends the victim
+	// the callback URL; the victim's browser has no state cookie, or one from
+	// its own login
+	provider.identity = domain.ExternalIdentity{Provider: "mock", Subject: "sub-victim", Email: "victim@example.com", EmailVerified: true}
+	_, attackerState, err := svc.StartLink(ctx, 7)
+	if err != nil {
+		t.Fatalf("start link: %v", err)
+	}
+	_, victimState, err := svc.Start(ctx)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	if _, err := svc.Callback(ctx, attackerState, "", "code"); !errors.Is(err, domain.ErrInvalidOIDCState) {
+		t.Errorf("callback without the state cookie: got %v, want %v", err, domain.ErrInvalidOIDCState)
+	}
+	if _, err := svc.Callback(ctx, attackerState, victimState, "code"); !errors.Is(err, domain.ErrInvalidOIDCState) {
+		t.Errorf("callback with another login's state cookie: got %v, want %v", err, domain.ErrInvalidOIDCState)
+	}
+	if len(identities.links) != 0 {
+		t.Errorf("identity linked from a foreign callback: %v", identities.links)
+	}
+}
@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+)
+
+type ProfileService struct {
+	Users  domain.UserRepository
+	Logger domain.LoggingRepository
+}
+
+func NewProfileService(users domain.UserRepository, logger domain.LoggingRepository) *ProfileService {
+	return &ProfileService{Users: users, Logger: logger}
+}
+
+func (s *ProfileService) logger(ctx context.Context, userID int) domain.LoggingRepository {
+	return s.Logger.With("service.name", "profile", "http.request.id", observability.GetRequestID(ctx), "user.id", userID, "event.category", []string{"iam"})
+}
+
+func (s *ProfileService) GetProfile(ctx context.Context, userID int) (*domain.User, error) {
+	return s.Users.GetUserByID(ctx, userID)
+}
+
+// UpdateProfile changes the fields set in update. version is the updated_at
+// the client last read, nil skips the check.
+func (s *ProfileService) UpdateProfile(ctx context.Context, userID int, update domain.ProfileUpdate, version *time.Time) (*domain.User, error) {
+	log := s.logger(ctx, userID)
+
+	if update.FirstName == nil && update.LastName == nil {
+		return nil, domain.ErrNothingToUpdate
+	}
+
+	user, err := s.Users.UpdateUserProfile(ctx, userID, update, version)
+	if err != nil {
+		logUpdateFailure(log, "update_user_profile", err)
+		return nil, err
+	}
+
+	log.Info(
+		"user profile updated",
+		"event.action", "update_user_profile",
+		"event.type", []string{"change", "end"},
+		"event.outcome", "success")
+	return user, nil
+}
+
+func (s *ProfileService) GetPreferences(ctx context.Context, userID int) (*domain.Preferences, error) {
+	return s.Users.GetUserPreferencesByID(ctx, userID)
+}
+
+// ReplacePreferences overwrites the story preferences, guarded by version the
+// same way as UpdateProfile.
+func (s *ProfileService) ReplacePreferences(ctx context.Context, userID int, preferences []string, version *time.Time) (*domain.Preferences, error) {
+	log := s.logger(ctx, userID)
+
+	prefs, err := s.Users.ReplaceUserPreferences(ctx, userID, preferences, version)
+	if err != nil {
+		logUpdateFailure(log, "replace_user_preferences", err)
+		return nil, err
+	}
+
+	log.Info(
+		"user preferences replaced",
+		"event.action", "replace_user_preferences",
+		"event.type", []string{"change", "end"},
+		"event.outcome", "success")
+	return prefs, nil
+}
+
+// logUpdateFailure logs lost races as warnings, they are expected with
+// concurrent clients.
+func logUpdateFailure(log domain.LoggingRepository, action string, err error) {
+	if errors.Is(err, domain.ErrStaleVersion) {
+		log.Warn(
+			"update rejected, version is stale",
+			"event.action", action,
+			"event.type", []string{"change", "denied"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return
+	}
+	log.Error(
+		"update failed",
+		"event.action", action,
+		"event.type", []string{"error", "end"},
+		"event.outcome", "failed",
+		"error.message", err.Error())
+}
@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+func newProfileService() (*ProfileService, *loginUserRepo) {
+	users := newLoginUsers()
+	updatedAt := time.Date(2025, 12, 31, 9, 0, 0, 0, time.UTC)
+	users.users["reza@example.com"].UpdatedAt = updatedAt
+	users.prefs = map[int]*domain.Preferences{7: {ID: 1, UserID: 7, UserPreferences: []string{"dragons"}, UpdatedAt: updatedAt}}
+	return NewProfileService(users, nopLogger{}), users
+}
+
+func TestUpdateProfileChecksVersion(t *testing.T) {
+	name := "Kian"
+	svc, _ := newProfileService()
+	profile, err := svc.GetProfile(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("get profile: %v", err)
+	}
+	read := profile.UpdatedAt
+
+	updated, err := svc.UpdateProfile(context.Background(), 7, domain.ProfileUpdate{FirstName: &name}, &read)
+	if err != nil {
+		t.Fatalf("update with current version: %v", err)
+	}
+	if updated.FirstName != name || !updated.UpdatedAt.After(read) {
+		t.Errorf("unexpected profile after update: %+v", updated)
+	}
+
+	if _, err := svc.UpdateProfile(context.Background(), 7, domain.ProfileUpdate{FirstName: &name}, &read); !errors.Is(err, domain.ErrStaleVersion) {
+		t.Errorf("update with stale version: got %v, want %v", err, domain.ErrStaleVersion)
+	}
+	if _, err := svc.UpdateProfile(context.Background(), 7, domain.ProfileUpdate{FirstName: &name}, nil); err != nil {
+		t.Errorf("unconditional update: %v", err)
+	}
+	if _, err := svc.UpdateProfile(context.Background(), 7, domain.ProfileUpdate{}, nil); !errors.Is(err, domain.ErrNothingToUpdate) {
+		t.Errorf("empty update: got %v, want %v", err, domain.ErrNothingToUpdate)
+	}
+}
+
+func TestReplacePreferencesChecksVersion(t *testing.T) {
+	svc, users := newProfileService()
+	stale := users.prefs[7].UpdatedAt.Add(-time.Minute)
+
+	if _, err := svc.ReplacePreferences(context.Background(), 7, []string{"pirates"}, &stale); !errors.Is(err, domain.ErrStaleVersion) {
+		t.Fatalf("replace with stale version: got %v, want %v", err, domain.ErrStaleVersion)
+	}
+	if got := users.prefs[7].UserPreferences; len(got) != 1 || got[0] != "dragons" {
+		t.Errorf("stale replace changed preferences to %v", got)
+	}
+
+	current := users.prefs[7].UpdatedAt
+	prefs, err := svc.ReplacePreferences(context.Background(), 7, []string{"pirates", "space"}, &current)
+	if err != nil {
+		t.Fatalf("replace with current version: %v", err)
+	}
+	if len(prefs.UserPreferences) != 2 || !prefs.UpdatedAt.After(current) {
+		t.Errorf("unexpected preferences after replace: %+v", prefs)
+	}
+}
@@ -0,0 +1,44 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+// RegistrationCleanupService drops registrations that were never verified,
+// which frees their email for a new registration.
+type RegistrationCleanupService struct {
+	UserVerification domain.UserVerificationRepository
+	Logger           domain.LoggingRepository
+	MaxAge           time.Duration
+}
+
+func NewRegistrationCleanupService(userVerification domain.UserVerificationRepository, logger domain.LoggingRepository, maxAge time.Duration) *RegistrationCleanupService {
+	return &RegistrationCleanupService{UserVerification: userVerification, Logger: logger, MaxAge: maxAge}
+}
+
+func (s *RegistrationCleanupService) CleanupStaleRegistrations(ctx context.Context, now time.Time) error {
+	log := s.Logger.With("service.name", "registration-janitor", "event.category", []string{"iam"})
+
+	deleted, err := s.UserVerification.DeleteStaleRegistrations(ctx, now.Add(-s.MaxAge))
+	if err != nil {
+		log.Error(
+			"failed to delete stale registrations",
+			"event.action", "delete_stale_registrations",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return err
+	}
+	if deleted > 0 {
+		log.Info(
+			"stale registrations deleted",
+			"event.action", "delete_stale_registrations",
+			"event.type", []string{"deletion"},
+			"event.outcome", "success",
+			"registration.count", deleted)
+	}
+	return nil
+}
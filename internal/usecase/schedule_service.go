@@ -0,0 +1,212 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+)
+
+type ScheduleService struct {
+	ScheduleRepo   domain.ScheduleRepository
+	Cron           domain.CronParser
+	StoryScheduler *StorySchedulerService
+	Logger         domain.LoggingRepository
+	BatchSize      int
+	MissedRunGrace time.Duration
+}
+
+func NewScheduleService(
+	schedulerepo domain.ScheduleRepository,
+	cron domain.CronParser,
+	storyScheduler *StorySchedulerService,
+	logger domain.LoggingRepository,
+	batchSize int,
+	missedRunGrace time.Duration,
+) *ScheduleService {
+	return &ScheduleService{
+		ScheduleRepo:   schedulerepo,
+		Cron:           cron,
+		StoryScheduler: storyScheduler,
+		Logger:         logger,
+		BatchSize:      batchSize,
+		MissedRunGrace: missedRunGrace,
+	}
+}
+
+// prepare validates the cron expression and time zone and sets the first run
+// after now.
+func (s *ScheduleService) prepare(schedule *domain.StorySchedule, now time.Time) error {
+	if schedule.MissedRunPolicy == "" {
+		schedule.MissedRunPolicy = domain.MissedRunSkip
+	}
+	next, err := s.Cron.Next(schedule.CronExpr, schedule.TimeZone, now)
+	if err != nil {
+		return err
+	}
+	schedule.NextRunAt = next
+	return nil
+}
+
+func (s *ScheduleService) CreateSchedule(ctx context.Context, schedule domain.StorySchedule) (*domain.StorySchedule, error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "story_schedules", "http.request.id", reqID, "user.id", schedule.UserID, "event.category", []string{"web"})
+
+	if err := s.prepare(&schedule, time.Now()); err != nil {
+		log.Warn(
+			"invalid schedule",
+			"event.action", "validate_schedule",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	id, err := s.ScheduleRepo.CreateSchedule(ctx, &schedule)
+	if err != nil {
+		log.Error(
+			"failed to create schedule",
+			"event.action", "create_schedule",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+	schedule.ID = id
+
+	log.Info(
+		"schedule created",
+		"schedule.id", id,
+		"event.action", "create_schedule",
+		"event.type", []string{"end", "creation"},
+		"event.outcome", "success")
+	return &schedule, nil
+}
+
+func (s *ScheduleService) GetSchedule(ctx context.Context, userID, id int) (*domain.StorySchedule, error) {
+	return s.ScheduleRepo.GetSchedule(ctx, userID, id)
+}
+
+func (s *ScheduleService) ListSchedules(ctx context.Context, userID int) ([]domain.StorySchedule, error) {
+	return s.ScheduleRepo.ListSchedules(ctx, userID)
+}
+
+func (s *ScheduleService) UpdateSchedule(ctx context.Context, schedule domain.StorySchedule) (*domain.StorySchedule, error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "story_schedules", "http.request.id", reqID, "user.id", schedule.UserID, "schedule.id", schedule.ID, "event.category", []string{"web"})
+
+	existing, err := s.ScheduleRepo.GetSchedule(ctx, schedule.UserID, schedule.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.prepare(&schedule, time.Now()); err != nil {
+		log.Warn(
+			"invalid schedule",
+			"event.action", "validate_schedule",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	if err := s.ScheduleRepo.UpdateSchedule(ctx, &schedule); err != nil {
+		log.Error(
+			"failed to update schedule",
+			"event.action", "update_schedule",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+	schedule.LastRunAt = existing.LastRunAt
+
+	log.Info(
+		"schedule updated",
+		"event.action", "update_schedule",
+		"event.type", []string{"end", "change"},
+		"event.outcome", "success")
+	return &schedule, nil
+}
+
+func (s *ScheduleService) DeleteSchedule(ctx context.Context, userID, id int) error {
+	return s.ScheduleRepo.DeleteSchedule(ctx, userID, id)
+}
+
+// RunDueSchedules enqueues a story for every schedule whose next run has
+// passed. The next run is always computed from now, so after downtime a
+// schedule fires at most once: run_once schedules catch up with one story and
+// skip schedules drop runs that are older than MissedRunGrace.
+func (s *ScheduleService) RunDueSchedules(ctx context.Context, now time.Time) error {
+	log := s.Logger.With("service.name", "story_schedules", "event.category", []string{"process"})
+
+	due, err := s.ScheduleRepo.ListDueSchedules(ctx, now, s.BatchSize)
+	if err != nil {
+		log.Error(
+			"failed to list due schedules",
+			"event.action", "list_due_schedules",
+			"event.type", []string{"error"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return err
+	}
+
+	for _, schedule := range due {
+		schedLog := log.With("schedule.id", schedule.ID, "user.id", schedule.UserID)
+
+		next, err := s.Cron.Next(schedule.CronExpr, schedule.TimeZone, now)
+		if err != nil {
+			schedLog.Error(
+				"failed to compute next run",
+				"event.action", "compute_next_run",
+				"event.type", []string{"error"},
+				"event.outcome", "failed",
+				"error.message", err.Error())
+			continue
+		}
+
+		// advance before enqueueing so a crash in between never produces a
+		// second story for the same run
+		if err := s.ScheduleRepo.MarkScheduleRun(ctx, schedule.ID, now, next); err != nil {
+			schedLog.Error(
+				"failed to advance schedule",
+				"event.action", "mark_schedule_run",
+				"event.type", []string{"error"},
+				"event.outcome", "failed",
+				"error.message", err.Error())
+			continue
+		}
+
+		missed := now.Sub(schedule.NextRunAt) > s.MissedRunGrace
+		if missed && schedule.MissedRunPolicy == domain.MissedRunSkip {
+			schedLog.Warn(
+				"missed scheduled run skipped",
+				"schedule.run_at", schedule.NextRunAt,
+				"event.action", "skip_missed_run",
+				"event.type", []string{"info"},
+				"event.outcome", "success")
+			continue
+		}
+
+		runCtx := observability.WithRequestID(ctx, fmt.Sprintf("schedule-%d-%d", schedule.ID, schedule.NextRunAt.Unix()))
+		if _, err := s.StoryScheduler.ScheduleStoryGeneration(runCtx, schedule.UserID); err != nil {
+			schedLog.Error(
+				"failed to enqueue scheduled story",
+				"event.action", "enqueue_scheduled_story",
+				"event.type", []string{"error"},
+				"event.outcome", "failed",
+				"error.message", err.Error())
+			continue
+		}
+
+		schedLog.Info(
+			"scheduled story enqueued",
+			"schedule.next_run_at", next,
+			"event.action", "enqueue_scheduled_story",
+			"event.type", []string{"creation"},
+			"event.outcome", "success")
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/infrastructure/utils"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(msg string, args ...interface{})                {}
+func (nopLogger) Warn(msg string, args ...interface{})                {}
+func (nopLogger) Error(msg string, args ...interface{})               {}
+func (l nopLogger) With(args ...interface{}) domain.LoggingRepository { return l }
+
+type fakeScheduleRepo struct {
+	mu        sync.Mutex
+	schedules map[int]*domain.StorySchedule
+}
+
+func newFakeScheduleRepo(schedules ...domain.StorySchedule) *fakeScheduleRepo {
+	r := &fakeScheduleRepo{schedules: make(map[int]*domain.StorySchedule)}
+	for i := range schedules {
+		s := schedules[i]
+		r.schedules[s.ID] = &s
+	}
+	return r
+}
+
+func (r *fakeScheduleRepo) CreateSchedule(ctx context.Context, s *domain.StorySchedule) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s.ID = len(r.schedules) + 1
+	c := *s
+	r.schedules[s.ID] = &c
+	return s.ID, nil
+}
+
+func (r *fakeScheduleRepo) GetSchedule(ctx context.Context, userID, id int) (*domain.StorySchedule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.schedules[id]
+	if !ok || s.UserID != userID {
+		return nil, domain.ErrScheduleNotFound
+	}
+	c := *s
+	return &c, nil
+}
+
+func (r *fakeScheduleRepo) ListSchedules(ctx context.Context, userID int) ([]domain.StorySchedule, error) {
+	return nil, nil
+}
+
+func (r *fakeScheduleRepo) UpdateSchedule(ctx context.Context, s *domain.StorySchedule) error {
+	return nil
+}
+
+func (r *fakeScheduleRepo) DeleteSchedule(ctx context.Context, userID, id int) error {
+	return nil
+}
+
+func (r *fakeScheduleRepo) ListDueSchedules(ctx context.Context, now time.Time, limit int) ([]domain.StorySchedule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []domain.StorySchedule
+	for _, s := range r.schedules {
+		if s.Enabled && !s.NextRunAt.After(now) {
+			due = append(due, *s)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeScheduleRepo) MarkScheduleRun(ctx context.Context, id int, lastRunAt, nextRunAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.schedules[id]
+	s.LastRunAt = &lastRunAt
+	s.NextRunAt = nextRunAt
+	return nil
+}
+
+type fakeUserRepo struct{}
+
+func (fakeUserRepo) GetUserByID(ctx context.Context, id int) (*domain.User, error) {
+	return &domain.User{ID: id, Email: "reader@example.com", Plan: domain.PlanFree}, nil
+}
+
+func (fakeUserRepo) DeleteUserByID(ctx context.Context, id int, deletedBy string) error {
+	return nil
+}
+
+func (fakeUserRepo) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return nil, domain.ErrEmailNotFound
+}
+
+func (fakeUserRepo) GetUserPreferencesByID(ctx context.Context, id int) (*domain.Preferences, error) {
+	return &domain.Preferences{UserID: id, UserPreferences: []string{"dragons"}}, nil
+}
+
+func (fakeUserRepo) UpdateUserRole(ctx context.Context, id int, role string) error { return nil }
+
+func (fakeUserRepo) GetDeletedUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return nil, domain.ErrEmailNotFound
+}
+
+func (fakeUserRepo) RestoreUserByID(ctx context.Context, id int) error { return nil }
+
+func (fakeUserRepo) UpdateUserProfile(ctx context.Context, id int, update domain.ProfileUpdate, version *time.Time) (*domain.User, error) {
+	return nil, domain.ErrUserNotFound
+}
+
+func (fakeUserRepo) ReplaceUserPreferences(ctx context.Context, userID int, preferences []string, version *time.Time) (*domain.Preferences, error) {
+	return nil, domain.ErrUserNotFound
+}
+
+type fakeStoryRepo struct {
+	mu        sync.Mutex
+	scheduled []domain.Job
+	files     map[string]bool
+}
+
+func (r *fakeStoryRepo) SaveStoryInfo(ctx context.Context, s *domain.Story) (int, error) {
+	return 1, nil
+}
+func (r *fakeStoryRepo) UploadStory(ctx context.Context, s *domain.UploadStory) error { return nil }
+func (r *fakeStoryRepo) SaveStoryJob(ctx context.Context, storyID int, status string) (int, error) {
+	return 1, nil
+}
+func (r *fakeStoryRepo) SaveEmailJob(ctx context.Context, storyID, userID int, status string) (int, error) {
+	return 1, nil
+}
+func (r *fakeStoryRepo) UpdateStoryJob(ctx context.Context, storyID int, status string) error {
+	return nil
+}
+func (r *fakeStoryRepo) UpdateEmailJob(ctx context.Context, storyID int, userID int, status string) error {
+	return nil
+}
+
+func (r *fakeStoryRepo) ScheduleStoryJob(ctx context.Context, s *domain.Story, job domain.Job, stream string, maxActive int) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// scheduled jobs never complete here, so all of them count as active
+	active := 0
+	for _, j := range r.scheduled {
+		if j.UserID == s.UserID {
+			active++
+		}
+	}
+	if active >= maxActive {
+		return 0, 0, domain.ErrTooManyActiveJobs
+	}
+	// mirror stories_user_file_unique
+	key := fmt.Sprintf("%d/%s", s.UserID, s.FileName)
+	if r.files[key] {
+		return 0, 0, domain.NewDomainError(domain.ErrCodeInternal, "query failed", errors.New("duplicate key value violates unique constraint"))
+	}
+	if r.files == nil {
+		r.files = make(map[string]bool)
+	}
+	r.files[key] = true
+	r.scheduled = append(r.scheduled, job)
+	return len(r.scheduled), len(r.scheduled), nil
+}
+
+func (r *fakeStoryRepo) GetStoryJobStats(ctx context.Context, userID int) (*domain.StoryJobStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &domain.StoryJobStats{Total: len(r.scheduled)}, nil
+}
+
+func (r *fakeStoryRepo) Scheduled() []domain.Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]domain.Job(nil), r.scheduled...)
+}
+
+func newTestScheduleService(repo *fakeScheduleRepo, stories *fakeStoryRepo) *ScheduleService {
+	storySvc := NewStorySchedulerService(fakeUserRepo{}, stories, nopLogger{}, "story_generation", 10)
+	return NewScheduleService(repo, utils.NewCronParser(), storySvc, nopLogger{}, 10, 5*time.Minute)
+}
+
+func TestRunDueSchedulesEnqueuesAndAdvances(t *testing.T) {
+	now := time.Date(2025, time.June, 1, 20, 0, 30, 0, time.UTC)
+	repo := newFakeScheduleRepo(domain.StorySchedule{
+		ID: 1, UserID: 7, CronExpr: "0 20 * * *", TimeZone: "UTC",
+		MissedRunPolicy: domain.MissedRunSkip, Enabled: true,
+		NextRunAt: time.Date(2025, time.June, 1, 20, 0, 0, 0, time.UTC),
+	})
+	stories := &fakeStoryRepo{}
+	svc := newTestScheduleService(repo, stories)
+
+	if err := svc.RunDueSchedules(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(stories.Scheduled()); got != 1 {
+		t.Fatalf("scheduled %d stories, want 1", got)
+	}
+	if got, want := repo.schedules[1].NextRunAt, time.Date(2025, time.June, 2, 20, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("next run = %s, want %s", got, want)
+	}
+
+	if err := svc.RunDueSchedules(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(stories.Scheduled()); got != 1 {
+		t.Errorf("second run scheduled %d stories in total, want 1", got)
+	}
+}
+
+func TestRunDueSchedulesEnqueuesEveryRecurringRun(t *testing.T) {
+	first := time.Date(2025, time.June, 1, 20, 0, 0, 0, time.UTC)
+	repo := newFakeScheduleRepo(domain.StorySchedule{
+		ID: 1, UserID: 7, CronExpr: "0 20 * * *", TimeZone: "UTC",
+		MissedRunPolicy: domain.MissedRunSkip, Enabled: true, NextRunAt: first,
+	})
+	stories := &fakeStoryRepo{}
+	svc := newTestScheduleService(repo, stories)
+
+	for day := 0; day < 2; day++ {
+		if err := svc.RunDueSchedules(context.Background(), first.AddDate(0, 0, day)); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(stories.Scheduled()); got != day+1 {
+			t.Fatalf("after run %d scheduled %d stories, want %d", day+1, got, day+1)
+		}
+	}
+}
+
+func TestRunDueSchedulesHandlesMissedRuns(t *testing.T) {
+	// the service was down for three days, so three 8pm runs were missed
+	now := time.Date(2025, time.June, 4, 9, 0, 0, 0, time.UTC)
+	missedAt := time.Date(2025, time.June, 1, 20, 0, 0, 0, time.UTC)
+	repo := newFakeScheduleRepo(
+		domain.StorySchedule{ID: 1, UserID: 7, CronExpr: "0 20 * * *", TimeZone: "UTC", MissedRunPolicy: domain.MissedRunSkip, Enabled: true, NextRunAt: missedAt},
+		domain.StorySchedule{ID: 2, UserID: 8, CronExpr: "0 20 * * *", TimeZone: "UTC", MissedRunPolicy: domain.MissedRunRunOnce, Enabled: true, NextRunAt: missedAt},
+	)
+	stories := &fakeStoryRepo{}
+	svc := newTestScheduleService(repo, stories)
+
+	if err := svc.RunDueSchedules(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduled := stories.Scheduled()
+	if len(scheduled) != 1 || scheduled[0].UserID != 8 {
+		t.Fatalf("scheduled %v, want a single catch-up story for user 8", scheduled)
+	}
+	want := time.Date(2025, time.June, 4, 20, 0, 0, 0, time.UTC)
+	for id, s := range repo.schedules {
+		if !s.NextRunAt.Equal(want) {
+			t.Errorf("schedule %d next run = %s, want %s", id, s.NextRunAt, want)
+		}
+	}
+}
+
+func TestCreateScheduleRejectsInvalidTimeZone(t *testing.T) {
+	svc := newTestScheduleService(newFakeScheduleRepo(), &fakeStoryRepo{})
+
+	_, err := svc.CreateSchedule(context.Background(), domain.StorySchedule{UserID: 7, CronExpr: "0 20 * * *", TimeZone: "Nowhere/Town"})
+	if err == nil {
+		t.Fatal("expected an error for an unknown time zone")
+	}
+}
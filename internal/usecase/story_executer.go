@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
@@ -34,6 +35,18 @@ func (s *StoryGenerationService) Execute(ctx context.Context, job domain.Job) er
 
 	log.Info("story generatoin started", "event.type", []string{"start"})
 
+	if _, err := s.UserRepo.GetUserByID(ctx, job.UserID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			log.Warn(
+				"user no longer exists, story job cancelled",
+				"event.action", "get_user_by_id",
+				"event.type", []string{"end"},
+				"event.outcome", "failed")
+			return domain.ErrJobCancelled
+		}
+		return err
+	}
+
 	aiStartTime := time.Now()
 	output, err := s.AI.GenerateStory(ctx, job.UserPreferences)
 	aiDurationTime := time.Since(aiStartTime)
@@ -48,7 +61,7 @@ func (s *StoryGenerationService) Execute(ctx context.Context, job domain.Job) er
 		return err
 	}
 
-	story := domain.UploadStory{UserID: job.UserID, Story: output}
+	story := domain.UploadStory{StoryID: job.StoryID, UserID: job.UserID, Story: output}
 	err = s.StoryRepo.UploadStory(ctx, &story)
 	if err != nil {
 		log.Error(
@@ -2,8 +2,10 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
 	"github.com/KianoushAmirpour/notification_server/internal/observability"
@@ -17,19 +19,28 @@ type StorySchedulerService struct {
 	UserRepo  domain.UserRepository
 	StoryRepo domain.StoryRepository
 	// WorkerPool domain.StoryWorkerPool
-	TaskStreamHandler domain.StreamTaskHandler
-	Logger            domain.LoggingRepository
-	Stream            string
+	Logger        domain.LoggingRepository
+	Stream        string
+	MaxActiveJobs int
 }
 
 func NewStorySchedulerService(
 	userrepo domain.UserRepository,
 	storyrepo domain.StoryRepository,
-	taskStreamHandler domain.StreamTaskHandler,
 	logger domain.LoggingRepository,
 	stream string,
+	maxActiveJobs int,
 ) *StorySchedulerService {
-	return &StorySchedulerService{UserRepo: userrepo, StoryRepo: storyrepo, TaskStreamHandler: taskStreamHandler, Logger: logger, Stream: stream}
+	return &StorySchedulerService{UserRepo: userrepo, StoryRepo: storyrepo, Logger: logger, Stream: stream, MaxActiveJobs: maxActiveJobs}
+}
+
+// jobPriority puts premium users and a user's very first story on the high
+// lane so they are not stuck behind bulk traffic.
+func jobPriority(user *domain.User, stats *domain.StoryJobStats) string {
+	if user.Plan == domain.PlanPremium || stats.Total == 0 {
+		return domain.PriorityHigh
+	}
+	return domain.PriorityNormal
 }
 
 func (s *StorySchedulerService) ScheduleStoryGeneration(ctx context.Context, userid int) (*StoryServiceResponse, error) {
@@ -49,67 +60,69 @@ func (s *StorySchedulerService) ScheduleStoryGeneration(ctx context.Context, use
 		return nil, err
 	}
 
-	userp, err := s.UserRepo.GetUserPreferencesByID(ctx, userid)
+	stats, err := s.StoryRepo.GetStoryJobStats(ctx, userid)
 	if err != nil {
 		log.Error(
-			"failed to find user preferences by id",
-			"event.action", "get_user_preferences_by_id",
+			"failed to get story job stats",
+			"event.action", "get_story_job_stats",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
 			"error.message", err.Error())
 		return nil, err
 	}
 
-	keywords := strings.Join(userp.UserPreferences, "-")
-
-	story := &domain.Story{FileName: fmt.Sprintf("story-%s", keywords), UserID: userid, Story: ""}
+	priority := jobPriority(user, stats)
+	stream := domain.PriorityStream(s.Stream, priority)
 
-	story_id, err := s.StoryRepo.SaveStoryInfo(ctx, story)
+	userp, err := s.UserRepo.GetUserPreferencesByID(ctx, userid)
 	if err != nil {
 		log.Error(
-			"failed to save story info",
-			"event.action", "save_story_info",
+			"failed to find user preferences by id",
+			"event.action", "get_user_preferences_by_id",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
 			"error.message", err.Error())
 		return nil, err
 	}
 
-	storyJobID, err := s.StoryRepo.SaveStoryJob(ctx, story_id, "pending")
-	if err != nil {
-		log.Error(
-			"failed to save story job",
-			"event.action", "save_story_job",
-			"event.type", []string{"error", "end"},
-			"event.outcome", "failed",
-			"error.message", err.Error())
-		return nil, err
-	}
+	keywords := strings.Join(userp.UserPreferences, "-")
+
+	// stories are unique per (user_id, file_name), so the name carries the
+	// time of the request to keep repeat requests and scheduled runs apart
+	story := &domain.Story{FileName: fmt.Sprintf("story-%s-%d", keywords, time.Now().UnixNano()), UserID: userid, Story: ""}
 
 	storyGenerationJob := domain.Job{
-		JobID:           storyJobID,
 		UserID:          userid,
-		StoryID:         story_id,
 		UserEmail:       user.Email,
 		UserPreferences: keywords,
 		RetryCounts:     0,
-		RequestID:       reqID}
-
-	err = s.TaskStreamHandler.Add(ctx, storyGenerationJob, s.Stream)
+		RequestID:       reqID,
+		Priority:        priority,
+		TraceContext:    observability.InjectTraceContext(ctx)}
+
+	storyID, storyJobID, err := s.StoryRepo.ScheduleStoryJob(ctx, story, storyGenerationJob, stream, s.MaxActiveJobs)
+	if errors.Is(err, domain.ErrTooManyActiveJobs) {
+		log.Warn(
+			"user has too many story jobs in progress",
+			"story.job.active", stats.Active,
+			"event.action", "check_active_story_jobs",
+			"event.type", []string{"denied", "end"},
+			"event.outcome", "failed")
+		return nil, err
+	}
 	if err != nil {
 		log.Error(
-			fmt.Sprintf("failed to add job to %s stream", s.Stream),
-			"story.id", story_id,
-			"story.job.id", storyJobID,
-			"event.action", "add_story_generation_job_to_stream",
+			fmt.Sprintf("failed to save story job to outbox for %s stream", stream),
+			"event.action", "schedule_story_job",
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
 			"error.message", err.Error())
 		return nil, err
 	}
 	log.Info(
-		fmt.Sprintf("job succussful added to %s stream", s.Stream),
-		"story.id", story_id,
+		fmt.Sprintf("job successfully saved to outbox for %s stream", stream),
+		"story.id", storyID,
+		"story.job.priority", priority,
 		"story.job.id", storyJobID,
 		"event.type", []string{"end", "creation"},
 		"event.outcome", "success")
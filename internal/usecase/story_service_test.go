@@ -0,0 +1,47 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+)
+
+func TestScheduleStoryGenerationEnforcesActiveLimitUnderConcurrency(t *testing.T) {
+	stories := &fakeStoryRepo{}
+	svc := NewStorySchedulerService(fakeUserRepo{}, stories, nopLogger{}, "story_generation", 2)
+
+	const requests = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.ScheduleStoryGeneration(context.Background(), 7)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	accepted, rejected := 0, 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			accepted++
+		case errors.Is(err, domain.ErrTooManyActiveJobs):
+			rejected++
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if accepted != 2 || rejected != requests-2 {
+		t.Errorf("accepted %d and rejected %d requests, want 2 and %d", accepted, rejected, requests-2)
+	}
+	if got := len(stories.Scheduled()); got != 2 {
+		t.Errorf("scheduled %d stories, want 2", got)
+	}
+}
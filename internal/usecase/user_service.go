@@ -2,6 +2,10 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
@@ -12,9 +16,17 @@ type UserServiceResponse struct {
 	Message string `json:"message"`
 }
 
+type UserServiceRegisterResponse struct {
+	Message        string `json:"message"`
+	VerificationID string `json:"verification_id"`
+}
+
+// UserServiceAuthResponse holds either the token pair or, for users with MFA
+// enabled, only MFAChallenge for CompleteMFALogin.
 type UserServiceAuthResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	MFAChallenge string `json:"mfa_token,omitempty"`
 }
 
 type UserService struct {
@@ -24,8 +36,11 @@ type UserService struct {
 	MailHandler         domain.Mailer
 	OtpHandler          domain.OTPService
 	OtpGenerator        domain.OTPGenerator
+	TokenGenerator      domain.TokenGenerator
 	JwtTokenHandler     domain.JwtTokenRepository
 	RefreshTokenHandler domain.RefreshTokenRepository
+	MFA                 *MFAService
+	Audit               domain.AuditRepository
 	Logger              domain.LoggingRepository
 }
 
@@ -36,8 +51,11 @@ func NewUserRegisterService(
 	mailhandler domain.Mailer,
 	otphandler domain.OTPService,
 	otpgenerator domain.OTPGenerator,
+	tokengenerator domain.TokenGenerator,
 	jwttoken domain.JwtTokenRepository,
 	reftoken domain.RefreshTokenRepository,
+	mfa *MFAService,
+	audit domain.AuditRepository,
 	logger domain.LoggingRepository,
 ) *UserService {
 	return &UserService{
@@ -47,14 +65,22 @@ func NewUserRegisterService(
 		MailHandler:         mailhandler,
 		OtpHandler:          otphandler,
 		OtpGenerator:        otpgenerator,
+		TokenGenerator:      tokengenerator,
 		JwtTokenHandler:     jwttoken,
 		RefreshTokenHandler: reftoken,
+		MFA:                 mfa,
+		Audit:               audit,
 		Logger:              logger}
 }
 
-func (s *UserService) RegisterUser(ctx context.Context, req domain.RegisteredUser, otpExpiration int) (*UserServiceResponse, error) {
+// RegisterUser stages the user and emails a code. The returned verification
+// id names the registration in VerifyUser until the code expires.
+func (s *UserService) RegisterUser(ctx context.Context, req domain.RegisteredUser, otpExpiration int) (_ *UserServiceRegisterResponse, err error) {
 	reqID := observability.GetRequestID(ctx)
 	log := s.Logger.With("service.name", "register", "http.request.id", reqID, "event.category", []string{"iam"})
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditUserRegistration, 0, err, nil)
+	}()
 
 	log.Info("user registration started", "event.type", []string{"start"})
 
@@ -68,6 +94,15 @@ func (s *UserService) RegisterUser(ctx context.Context, req domain.RegisteredUse
 			"reason", "email already exists")
 		return nil, domain.NewDomainError(domain.ErrCodeConflict, "email already exists", nil)
 	}
+	if deleted, err := s.Users.GetDeletedUserByEmail(ctx, req.Email); deleted != nil && err == nil {
+		log.Warn(
+			"user pending deletion",
+			"event.action", "check_existing_user",
+			"event.outcome", "failed",
+			"event.type", []string{"error", "end"},
+			"reason", "email belongs to an account pending deletion")
+		return nil, domain.ErrAccountPendingDeletion
+	}
 
 	hashedPassword, err := s.HashHandler.Hash(req.Password, false)
 	if err != nil {
@@ -98,7 +133,7 @@ func (s *UserService) RegisterUser(ctx context.Context, req domain.RegisteredUse
 		return nil, err
 	}
 
-	err = s.UserVerification.SaveVerificationData(ctx, reqID, req.Email)
+	verificationID, err := s.UserVerification.SaveVerificationData(ctx, req.Email, otpExpiresAt(otpExpiration))
 	if err != nil {
 		log.Error(
 			"failed to save verification data",
@@ -145,7 +180,7 @@ func (s *UserService) RegisterUser(ctx context.Context, req domain.RegisteredUse
 
 	go func() {
 		<-time.After(1 * time.Second)
-		emailerr := s.MailHandler.SendVerificationEmail(req.Email, otp)
+		emailerr := s.MailHandler.SendVerificationEmail(ctx, req.Email, otp)
 		if emailerr != nil {
 			emailErrChan <- emailerr
 		}
@@ -160,7 +195,7 @@ func (s *UserService) RegisterUser(ctx context.Context, req domain.RegisteredUse
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
 			"error.message", otperr.Error())
-		return nil, err
+		return nil, otperr
 	}
 
 	emailerr := <-emailErrChan
@@ -171,7 +206,7 @@ func (s *UserService) RegisterUser(ctx context.Context, req domain.RegisteredUse
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
 			"error.message", emailerr.Error())
-		return nil, err
+		return nil, emailerr
 	}
 
 	log.Info(
@@ -179,17 +214,30 @@ func (s *UserService) RegisterUser(ctx context.Context, req domain.RegisteredUse
 		"event.type", []string{"end", "creation"},
 		"event.outcome", "success")
 
-	return &UserServiceResponse{Message: "The verification code was sent to your email. Please check your email"}, nil
+	return &UserServiceRegisterResponse{
+		Message:        "The verification code was sent to your email. Please check your email",
+		VerificationID: verificationID,
+	}, nil
+
+}
 
+// otpExpiresAt is when a code saved now with otpExpiration minutes expires.
+func otpExpiresAt(otpExpiration int) time.Time {
+	return time.Now().Add(time.Duration(otpExpiration) * time.Minute)
 }
 
-func (s *UserService) VerifyUser(ctx context.Context, req domain.RegisterVerify, regsterReqID string) (*UserServiceResponse, error) {
+func (s *UserService) VerifyUser(ctx context.Context, req domain.RegisterVerify) (_ *UserServiceResponse, err error) {
 
 	reqID := observability.GetRequestID(ctx)
 	log := s.Logger.With("service.name", "verification", "http.request.id", reqID, "event.category", []string{"iam"})
+	var email string
+	var userID int
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditUserVerification, userID, err, nil)
+	}()
 	log.Info("user verification started", "event.type", []string{"start"})
 
-	email, err := s.UserVerification.RetrieveVerificationData(ctx, regsterReqID)
+	email, err = s.UserVerification.RetrieveVerificationData(ctx, req.VerificationID, req.Email)
 	if err != nil {
 		log.Error(
 			"failed to retrieve verification data",
@@ -253,10 +301,76 @@ func (s *UserService) VerifyUser(ctx context.Context, req domain.RegisterVerify,
 
 }
 
-func (s *UserService) AuthenticateUser(ctx context.Context, req domain.LoginUser) (*UserServiceAuthResponse, error) {
+// ResendVerification sends a new code for a pending registration and
+// extends it; its verification id stays the same. Unknown emails get the same
+// answer, so the endpoint does not tell which emails are registering; the
+// cooldown runs for them too.
+func (s *UserService) ResendVerification(ctx context.Context, email string, otpExpiration int, cooldown time.Duration) (_ *UserServiceResponse, err error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "verification", "http.request.id", reqID, "event.category", []string{"iam"})
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditVerificationResend, 0, err, nil)
+	}()
+	resp := &UserServiceResponse{Message: "If a registration is waiting for this email, a new verification code was sent to it"}
+
+	ok, err := s.OtpHandler.ReserveResend(ctx, "verification:"+email, cooldown)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrResendCooldown
+	}
+
+	err = s.UserVerification.RenewVerificationData(ctx, email, otpExpiresAt(otpExpiration))
+	if errors.Is(err, domain.ErrEmailNotFound) {
+		log.Warn(
+			"no pending registration for email",
+			"event.action", "renew_verification_data",
+			"event.type", []string{"end"},
+			"event.outcome", "failed")
+		return resp, nil
+	}
+	if err != nil {
+		log.Error(
+			"failed to renew verification data",
+			"event.action", "renew_verification_data",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	otp, err := s.issueOTP(ctx, log, email, otpExpiration)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.MailHandler.SendVerificationEmail(ctx, email, otp); err != nil {
+		log.Error(
+			"failed to send verification email to user",
+			"event.action", "send_verification_email",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	log.Info(
+		"verification code resent",
+		"event.type", []string{"end"},
+		"event.outcome", "success")
+	return resp, nil
+}
+
+func (s *UserService) AuthenticateUser(ctx context.Context, req domain.LoginUser) (_ *UserServiceAuthResponse, err error) {
 
 	reqID := observability.GetRequestID(ctx)
 	log := s.Logger.With("service.name", "login", "http.request.id", reqID, "event.category", []string{"authentication"})
+	var userID int
+	metadata := map[string]string{}
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditLogin, userID, err, metadata)
+	}()
 	log.Info("user authentication started", "event.type", []string{"start"})
 
 	u, err := s.Users.GetUserByEmail(ctx, req.Email)
@@ -270,6 +384,7 @@ func (s *UserService) AuthenticateUser(ctx context.Context, req domain.LoginUser
 		return nil, err
 	}
 
+	userID = u.ID
 	err = s.HashHandler.VerifyHash([]byte(u.Password), req.Password, false)
 	if err != nil {
 		log.Error(
@@ -282,7 +397,76 @@ func (s *UserService) AuthenticateUser(ctx context.Context, req domain.LoginUser
 		return nil, err
 	}
 
-	tokenPair, err := s.JwtTokenHandler.CreateJWTToken(u.ID, u.Email)
+	return s.finishLogin(ctx, log, u, metadata)
+}
+
+// finishLogin starts a session, or only issues an MFA challenge when the user
+// has MFA enabled; metadata of the login audit event is marked then.
+func (s *UserService) finishLogin(ctx context.Context, log domain.LoggingRepository, u *domain.User, metadata map[string]string) (*UserServiceAuthResponse, error) {
+	if s.MFA == nil {
+		return s.startSession(ctx, log, u)
+	}
+	enabled, err := s.MFA.enabled(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return s.startSession(ctx, log, u)
+	}
+
+	challenge, err := s.MFA.issueChallenge(ctx, log, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	metadata["mfa"] = "pending"
+	log.Info(
+		"password accepted, waiting for second factor",
+		"user.id", u.ID,
+		"event.action", "issue_mfa_challenge",
+		"event.type", []string{"end"},
+		"event.outcome", "success")
+	return &UserServiceAuthResponse{MFAChallenge: challenge}, nil
+}
+
+// CompleteMFALogin finishes a login that returned an MFA challenge. The
+// challenge is used up even when code is wrong, so every guess needs the
+// first factor again.
+func (s *UserService) CompleteMFALogin(ctx context.Context, challenge string, code string) (_ *UserServiceAuthResponse, err error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "login", "http.request.id", reqID, "event.category", []string{"authentication"})
+	var userID int
+	metadata := map[string]string{"mfa": "verified"}
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditLogin, userID, err, metadata)
+	}()
+
+	if s.MFA == nil {
+		return nil, domain.ErrInvalidMFAChallenge
+	}
+	userID, method, err := s.MFA.verifyChallenge(ctx, challenge, code)
+	if err != nil {
+		log.Warn(
+			"second factor rejected",
+			"user.id", userID,
+			"event.action", "verify_mfa",
+			"event.type", []string{"end", "denied"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+	metadata["factor"] = method
+
+	u, err := s.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, log, u)
+}
+
+// startSession issues the token pair for an authenticated user and stores the
+// refresh token.
+func (s *UserService) startSession(ctx context.Context, log domain.LoggingRepository, u *domain.User) (*UserServiceAuthResponse, error) {
+	tokenPair, err := s.JwtTokenHandler.CreateJWTToken(u.ID, u.Email, u.Role)
 	if err != nil {
 		log.Error(
 			"failed to create access and refresh token",
@@ -325,38 +509,420 @@ func (s *UserService) AuthenticateUser(ctx context.Context, req domain.LoginUser
 		"event.outcome", "success")
 
 	return &UserServiceAuthResponse{AccessToken: tokenPair.AccessToken, RefreshToken: tokenPair.RefreshToken}, nil
+}
 
+// accountDeletionOTPKey keeps deletion codes apart from the registration
+// codes stored under the bare email.
+func accountDeletionOTPKey(email string) string {
+	return "account-deletion:" + email
 }
 
-func (s *UserService) DeleteUser(ctx context.Context, req domain.DeleteUser) (*UserServiceResponse, error) {
+// issueOTP generates a code and stores its hash under key; the caller sends
+// the plain code by email.
+func (s *UserService) issueOTP(ctx context.Context, log domain.LoggingRepository, key string, otpExpiration int) (string, error) {
+	otp, err := s.OtpGenerator.GenerateOTP()
+	if err != nil {
+		log.Error(
+			"failed to generate otp code",
+			"event.action", "generate_otp",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return "", err
+	}
+
+	hashedOtp, err := s.HashHandler.Hash(otp, false)
+	if err != nil {
+		log.Error("failed to hash otp code",
+			"event.action", "hash_otp",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return "", err
+	}
+
+	if err := s.OtpHandler.SaveOTP(ctx, key, hashedOtp, otpExpiration); err != nil {
+		log.Error(
+			"failed to save hashed otp code",
+			"event.action", "save_otp",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return "", err
+	}
+	return otp, nil
+}
+
+// RequestAccountDeletion emails the user an OTP that confirms DeleteAccount,
+// for users who would rather not type their password.
+func (s *UserService) RequestAccountDeletion(ctx context.Context, userID int, otpExpiration int) (*UserServiceResponse, error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "deletion", "http.request.id", reqID, "user.id", userID, "event.category", []string{"iam"})
+
+	user, err := s.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	otp, err := s.issueOTP(ctx, log, accountDeletionOTPKey(user.Email), otpExpiration)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.MailHandler.SendAccountDeletionEmail(ctx, user.Email, otp); err != nil {
+		log.Error(
+			"failed to send account deletion email",
+			"event.action", "send_account_deletion_email",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	return &UserServiceResponse{Message: "A confirmation code was sent to your email"}, nil
+}
+
+// DeleteAccount deletes the caller's own account once the password or the
+// OTP from RequestAccountDeletion checks out.
+func (s *UserService) DeleteAccount(ctx context.Context, req domain.DeleteUser) (_ *UserServiceResponse, err error) {
 	reqID := observability.GetRequestID(ctx)
 	log := s.Logger.With("service.name", "deletion", "http.request.id", reqID, "user.id", req.ID, "event.category", []string{"iam"})
-	log.Info("user deletion started", "event.type", []string{"start"})
+	confirmation := "password"
+	if req.Password == "" {
+		confirmation = "otp"
+	}
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditUserDeletion, req.ID, err, map[string]string{"confirmation": confirmation})
+	}()
+	log.Info("account deletion started", "event.type", []string{"start"})
 
-	err := s.Users.DeleteUserByID(ctx, req.ID)
+	user, err := s.Users.GetUserByID(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.Password != "":
+		err = s.HashHandler.VerifyHash([]byte(user.Password), req.Password, false)
+	case req.OTP != "":
+		err = s.OtpHandler.VerifyOTP(ctx, accountDeletionOTPKey(user.Email), req.OTP)
+	default:
+		err = domain.NewDomainError(domain.ErrCodeValidation, "password or otp is required", nil)
+	}
 	if err != nil {
+		log.Error(
+			"account deletion not confirmed",
+			"event.action", "confirm_account_deletion",
+			"event.type", []string{"error", "denied"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	if err = s.deleteUser(ctx, log, req.ID, domain.DeletedBySelf); err != nil {
+		return nil, err
+	}
+	return &UserServiceResponse{Message: "User deleted successfully, it can be restored until the grace period ends"}, nil
+}
+
+// DeleteUser deletes any account without confirmation; it is only exposed to
+// admins.
+func (s *UserService) DeleteUser(ctx context.Context, userID int) (_ *UserServiceResponse, err error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "deletion", "http.request.id", reqID, "user.id", userID, "event.category", []string{"iam"})
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditUserDeletion, userID, err, map[string]string{"confirmation": "admin"})
+	}()
+	log.Info("user deletion started", "event.type", []string{"start"})
+
+	if err = s.deleteUser(ctx, log, userID, domain.DeletedByAdmin); err != nil {
+		return nil, err
+	}
+	return &UserServiceResponse{Message: "User deleted successfully"}, nil
+}
+
+// deleteUser revokes the refresh tokens first, so a failed deletion leaves
+// the user logged out rather than a deleted user logged in. The user is only
+// soft-deleted and its unfinished job rows are marked cancelled; lookups stop
+// finding it, so messages still in the streams are dropped by the workers
+// when they come due, and the purger removes the data after the grace period.
+// deletedBy decides whether RestoreAccount may bring the account back.
+func (s *UserService) deleteUser(ctx context.Context, log domain.LoggingRepository, userID int, deletedBy string) error {
+	if err := s.RefreshTokenHandler.RevokeUserRefreshTokens(ctx, userID, time.Now()); err != nil {
+		log.Error(
+			"failed to revoke refresh tokens",
+			"event.action", "revoke_refresh_tokens",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return err
+	}
+
+	if err := s.Users.DeleteUserByID(ctx, userID, deletedBy); err != nil {
 		log.Error(
 			"failed to delete user by id",
 			"event.action", "delete_user_by_id",
 			"event.type", []string{"error", "denied"},
 			"event.outcome", "failed",
 			"error.message", err.Error())
-		return nil, err
+		return err
 	}
 	log.Info(
 		"user deleted successfully",
 		"event.type", []string{"end", "deletion"},
 		"event.outcome", "success")
+	return nil
+}
 
-	return &UserServiceResponse{Message: "User deleted successfully"}, nil
+// accountRestorationOTPKey keeps restoration codes apart from the other codes
+// sent to the same email.
+func accountRestorationOTPKey(email string) string {
+	return "account-restoration:" + email
 }
 
-func (s *UserService) RefreshJwtToken(ctx context.Context, refreshToken string, JwtRefreshSecret string) (*UserServiceAuthResponse, error) {
+// RequestAccountRestoration emails an OTP that confirms RestoreAccount. It is
+// the only way back for accounts without a password, like those created
+// through an identity provider. It answers the same whether or not a deleted
+// account exists for email.
+func (s *UserService) RequestAccountRestoration(ctx context.Context, email string, otpExpiration int, cooldown time.Duration) (*UserServiceResponse, error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "restoration", "http.request.id", reqID, "event.category", []string{"iam"})
+	resp := &UserServiceResponse{Message: "If a deleted account exists for this email, a confirmation code was sent to it"}
+
+	ok, err := s.OtpHandler.ReserveResend(ctx, accountRestorationOTPKey(email), cooldown)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrResendCooldown
+	}
+
+	user, err := s.Users.GetDeletedUserByEmail(ctx, email)
+	if err != nil {
+		log.Warn(
+			"no deleted account for email",
+			"event.action", "get_deleted_user_by_email",
+			"event.type", []string{"end"},
+			"event.outcome", "failed")
+		return resp, nil
+	}
+	log = log.With("user.id", user.ID)
+
+	otp, err := s.issueOTP(ctx, log, accountRestorationOTPKey(user.Email), otpExpiration)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.MailHandler.SendAccountRestorationEmail(ctx, user.Email, otp); err != nil {
+		log.Error(
+			"failed to send account restoration email",
+			"event.action", "send_account_restoration_email",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RestoreAccount undoes a self-service deletion within gracePeriod. The user
+// proves the account is theirs with the password or the OTP from
+// RequestAccountRestoration, since a deleted user cannot log in. Accounts
+// deleted by an admin stay deleted.
+func (s *UserService) RestoreAccount(ctx context.Context, req domain.RestoreUser, gracePeriod time.Duration) (_ *UserServiceResponse, err error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "restoration", "http.request.id", reqID, "event.category", []string{"iam"})
+	var userID int
+	confirmation := "password"
+	if req.Password == "" {
+		confirmation = "otp"
+	}
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditUserRestoration, userID, err, map[string]string{"confirmation": confirmation})
+	}()
+
+	user, err := s.Users.GetDeletedUserByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+	userID = user.ID
+
+	switch {
+	case req.Password != "":
+		err = s.HashHandler.VerifyHash([]byte(user.Password), req.Password, false)
+		if err != nil {
+			err = domain.ErrInvalidCredentials
+		}
+	case req.OTP != "":
+		err = s.OtpHandler.VerifyOTP(ctx, accountRestorationOTPKey(user.Email), req.OTP)
+	default:
+		err = domain.NewDomainError(domain.ErrCodeValidation, "password or otp is required", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedBy == domain.DeletedByAdmin {
+		return nil, domain.ErrDeletedByAdmin
+	}
+	if user.DeletedAt == nil || time.Since(*user.DeletedAt) > gracePeriod {
+		return nil, domain.ErrDeletionGraceExpired
+	}
+
+	if err = s.Users.RestoreUserByID(ctx, user.ID); err != nil {
+		log.Error(
+			"failed to restore user",
+			"event.action", "restore_user",
+			"user.id", user.ID,
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+	log.Info(
+		"user restored successfully",
+		"user.id", user.ID,
+		"event.type", []string{"end", "change"},
+		"event.outcome", "success")
+	return &UserServiceResponse{Message: "Account restored, you can log in again"}, nil
+}
+
+// emailChangeOTPKey ties the code to both the user and the address it was
+// sent to, so it cannot confirm a different change.
+func emailChangeOTPKey(userID int, email string) string {
+	return fmt.Sprintf("email-change:%d:%s", userID, email)
+}
+
+// RequestEmailChange stages the new email and sends a code to it; the email
+// only changes once ConfirmEmailChange gets that code back.
+func (s *UserService) RequestEmailChange(ctx context.Context, req domain.EmailChange, otpExpiration int) (_ *UserServiceResponse, err error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "email-change", "http.request.id", reqID, "user.id", req.UserID, "event.category", []string{"iam"})
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditEmailChange, req.UserID, err, map[string]string{"step": "request"})
+	}()
+	log.Info("email change started", "event.type", []string{"start"})
+
+	user, err := s.Users.GetUserByID(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.HashHandler.VerifyHash([]byte(user.Password), req.Password, false); err != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+	if strings.EqualFold(user.Email, req.Email) {
+		return nil, domain.ErrSameEmail
+	}
+	// an account pending deletion keeps its email until it is purged
+	if existing, lookupErr := s.Users.GetUserByEmail(ctx, req.Email); existing != nil && lookupErr == nil {
+		return nil, domain.ErrEmailTaken
+	}
+	if deleted, lookupErr := s.Users.GetDeletedUserByEmail(ctx, req.Email); deleted != nil && lookupErr == nil {
+		return nil, domain.ErrEmailTaken
+	}
+
+	if err = s.UserVerification.StageEmailChange(ctx, req.UserID, req.Email); err != nil {
+		log.Error(
+			"failed to stage email change",
+			"event.action", "stage_email_change",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	otp, err := s.issueOTP(ctx, log, emailChangeOTPKey(req.UserID, req.Email), otpExpiration)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.MailHandler.SendEmailChangeEmail(ctx, req.Email, otp); err != nil {
+		log.Error(
+			"failed to send email change email",
+			"event.action", "send_email_change_email",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	return &UserServiceResponse{Message: "A confirmation code was sent to the new email"}, nil
+}
+
+// ConfirmEmailChange swaps in the staged email, logs the user out everywhere
+// and tells the old address about it. Only the email the code was checked
+// against is swapped in, and only while it is younger than otpExpiration
+// minutes.
+func (s *UserService) ConfirmEmailChange(ctx context.Context, userID int, otp string, otpExpiration int) (_ *UserServiceResponse, err error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "email-change", "http.request.id", reqID, "user.id", userID, "event.category", []string{"iam"})
+	metadata := map[string]string{"step": "confirm"}
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditEmailChange, userID, err, metadata)
+	}()
+
+	newEmail, err := s.UserVerification.GetStagedEmailChange(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.OtpHandler.VerifyOTP(ctx, emailChangeOTPKey(userID, newEmail), otp); err != nil {
+		log.Warn(
+			"email change not confirmed",
+			"event.action", "confirm_email_change",
+			"event.type", []string{"error", "denied"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	oldEmail, err := s.UserVerification.ConfirmEmailChange(ctx, userID, newEmail, time.Duration(otpExpiration)*time.Minute)
+	if err != nil {
+		log.Error(
+			"failed to change email",
+			"event.action", "confirm_email_change",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+	if err = s.RefreshTokenHandler.RevokeUserRefreshTokens(ctx, userID, time.Now()); err != nil {
+		log.Error(
+			"failed to revoke refresh tokens",
+			"event.action", "revoke_refresh_tokens",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	// the change is done, a lost notice is logged but does not undo it
+	if mailErr := s.MailHandler.SendEmailChangedEmail(ctx, oldEmail, newEmail); mailErr != nil {
+		log.Warn(
+			"failed to notify the old email",
+			"event.action", "send_email_changed_email",
+			"event.type", []string{"error"},
+			"event.outcome", "failed",
+			"error.message", mailErr.Error())
+	}
+
+	log.Info(
+		"email changed",
+		"event.action", "confirm_email_change",
+		"event.type", []string{"change", "end"},
+		"event.outcome", "success")
+	return &UserServiceResponse{Message: "Email changed, log in again with the new email"}, nil
+}
+
+func (s *UserService) RefreshJwtToken(ctx context.Context, refreshToken string) (_ *UserServiceAuthResponse, err error) {
 	reqID := observability.GetRequestID(ctx)
 	log := s.Logger.With("service.name", "jwt-refresh", "http.request.id", reqID, "event.category", []string{"authentication"})
+	var userID int
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditTokenRefresh, userID, err, nil)
+	}()
 	log.Info("refreshing jwt token started", "event.type", []string{"start"})
 
-	token, err := s.JwtTokenHandler.VerifyRefreshToken(refreshToken, []byte(JwtRefreshSecret))
+	token, err := s.JwtTokenHandler.VerifyRefreshToken(refreshToken)
 	if err != nil {
 		log.Error(
 			"failed to verify jwt refresh token",
@@ -366,11 +932,12 @@ func (s *UserService) RefreshJwtToken(ctx context.Context, refreshToken string,
 			"error.message", err.Error())
 		return nil, err
 	}
+	userID = token.UserID
 	user, err := s.Users.GetUserByID(ctx, token.UserID)
 	if err != nil {
 		log.Error("failed to find user by id",
 			"event.action", "get_user_by_id",
-			"user.id", user.ID,
+			"user.id", token.UserID,
 			"event.type", []string{"error", "end"},
 			"event.outcome", "failed",
 			"error.message", err.Error())
@@ -422,7 +989,7 @@ func (s *UserService) RefreshJwtToken(ctx context.Context, refreshToken string,
 		return nil, domain.NewDomainError(domain.ErrCodeValidation, "refresh token revoked", nil)
 	}
 
-	tokenPair, err := s.JwtTokenHandler.CreateJWTToken(token.UserID, token.Email)
+	tokenPair, err := s.JwtTokenHandler.CreateJWTToken(token.UserID, token.Email, user.Role)
 	if err != nil {
 		log.Error(
 			"failed to create access and refresh token",
@@ -477,3 +1044,136 @@ func (s *UserService) RefreshJwtToken(ctx context.Context, refreshToken string,
 		"event.outcome", "success")
 	return &UserServiceAuthResponse{AccessToken: tokenPair.AccessToken, RefreshToken: tokenPair.RefreshToken}, nil
 }
+
+// magicLinkKey keeps sign-in link tokens apart from the OTP codes stored for
+// the same email.
+func magicLinkKey(email string) string {
+	return "magic-link:" + email
+}
+
+// RequestMagicLink emails a single-use sign-in link pointing at callbackURL.
+// Like ResendVerification it answers the same way for unknown emails.
+func (s *UserService) RequestMagicLink(ctx context.Context, email string, callbackURL string, expiration int, cooldown time.Duration) (_ *UserServiceResponse, err error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "magic_link", "http.request.id", reqID, "event.category", []string{"authentication"})
+	var userID int
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditMagicLinkRequest, userID, err, nil)
+	}()
+	resp := &UserServiceResponse{Message: "If an account exists for this email, a sign-in link was sent to it"}
+
+	ok, err := s.OtpHandler.ReserveResend(ctx, magicLinkKey(email), cooldown)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrResendCooldown
+	}
+
+	u, err := s.Users.GetUserByEmail(ctx, email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		log.Warn(
+			"no account for email",
+			"event.action", "get_user_by_email",
+			"event.type", []string{"end"},
+			"event.outcome", "failed")
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	userID = u.ID
+
+	token, err := s.TokenGenerator.GenerateToken()
+	if err != nil {
+		log.Error(
+			"failed to generate sign-in token",
+			"event.action", "generate_magic_link_token",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	hashedToken, err := s.HashHandler.Hash(token, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.OtpHandler.SaveOTP(ctx, magicLinkKey(email), hashedToken, expiration); err != nil {
+		log.Error(
+			"failed to save hashed sign-in token",
+			"event.action", "save_magic_link_token",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	link, err := url.Parse(callbackURL)
+	if err != nil {
+		return nil, domain.NewDomainError(domain.ErrCodeInternal, "invalid magic link callback url", err)
+	}
+	query := link.Query()
+	query.Set("email", email)
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	if err = s.MailHandler.SendMagicLinkEmail(ctx, email, link.String()); err != nil {
+		log.Error(
+			"failed to send sign-in link",
+			"user.id", u.ID,
+			"event.action", "send_magic_link_email",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+
+	log.Info(
+		"sign-in link sent",
+		"user.id", u.ID,
+		"event.type", []string{"end"},
+		"event.outcome", "success")
+	return resp, nil
+}
+
+// LoginWithMagicLink exchanges a token from RequestMagicLink for the same
+// token pair AuthenticateUser returns. The token is deleted once used.
+func (s *UserService) LoginWithMagicLink(ctx context.Context, email string, token string) (_ *UserServiceAuthResponse, err error) {
+	reqID := observability.GetRequestID(ctx)
+	log := s.Logger.With("service.name", "login", "http.request.id", reqID, "event.category", []string{"authentication"})
+	var userID int
+	metadata := map[string]string{"method": "magic_link"}
+	defer func() {
+		auditOutcome(ctx, s.Audit, log, domain.AuditLogin, userID, err, metadata)
+	}()
+
+	err = s.OtpHandler.VerifyOTP(ctx, magicLinkKey(email), token)
+	if err != nil {
+		log.Warn(
+			"sign-in link rejected",
+			"event.action", "verify_magic_link",
+			"event.type", []string{"end", "denied"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		if errors.Is(err, domain.ErrOtpKeyNotFound) || errors.Is(err, domain.ErrInvalidOtp) {
+			return nil, domain.ErrInvalidMagicLink
+		}
+		return nil, err
+	}
+
+	u, err := s.Users.GetUserByEmail(ctx, email)
+	if err != nil {
+		log.Error(
+			"failed to find user by email",
+			"event.action", "get_user_by_email",
+			"event.type", []string{"error", "end"},
+			"event.outcome", "failed",
+			"error.message", err.Error())
+		return nil, err
+	}
+	userID = u.ID
+
+	return s.finishLogin(ctx, log, u, metadata)
+}
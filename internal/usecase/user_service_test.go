@@ -0,0 +1,897 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"github.com/KianoushAmirpour/notification_server/internal/observability"
+)
+
+type fakeAuditRepo struct {
+	mu     sync.Mutex
+	events []domain.AuditEvent
+}
+
+func (r *fakeAuditRepo) RecordAuditEvent(ctx context.Context, e domain.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.ID = int64(len(r.events) + 1)
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *fakeAuditRepo) ListAuditEvents(ctx context.Context, f domain.AuditFilter) ([]domain.AuditEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []domain.AuditEvent
+	for i := len(r.events) - 1; i >= 0 && len(events) < f.Limit; i-- {
+		events = append(events, r.events[i])
+	}
+	return events, nil
+}
+
+type loginUserRepo struct {
+	users   map[string]*domain.User
+	deleted map[int]bool
+	prefs   map[int]*domain.Preferences
+}
+
+func (r *loginUserRepo) GetUserByID(ctx context.Context, id int) (*domain.User, error) {
+	for _, u := range r.users {
+		if u.ID == id && u.DeletedAt == nil {
+			return u, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *loginUserRepo) DeleteUserByID(ctx context.Context, id int, deletedBy string) error {
+	if r.deleted == nil {
+		r.deleted = make(map[int]bool)
+	}
+	r.deleted[id] = true
+	for _, u := range r.users {
+		if u.ID == id {
+			now := time.Now()
+			u.DeletedAt = &now
+			u.DeletedBy = deletedBy
+		}
+	}
+	return nil
+}
+
+func (r *loginUserRepo) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	u, ok := r.users[email]
+	if !ok || u.DeletedAt != nil {
+		return nil, domain.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *loginUserRepo) GetDeletedUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	u, ok := r.users[email]
+	if !ok || u.DeletedAt == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *loginUserRepo) RestoreUserByID(ctx context.Context, id int) error {
+	for _, u := range r.users {
+		if u.ID == id {
+			u.DeletedAt = nil
+			u.DeletedBy = ""
+			delete(r.deleted, id)
+			return nil
+		}
+	}
+	return domain.ErrUserNotFound
+}
+
+func (r *loginUserRepo) GetUserPreferencesByID(ctx context.Context, id int) (*domain.Preferences, error) {
+	p, ok := r.prefs[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	return p, nil
+}
+
+// UpdateUserProfile and ReplaceUserPreferences bump UpdatedAt by a second, so
+// every write yields a new version.
+func (r *loginUserRepo) UpdateUserProfile(ctx context.Context, id int, update domain.ProfileUpdate, version *time.Time) (*domain.User, error) {
+	u, err := r.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version != nil && !version.Equal(u.UpdatedAt) {
+		return nil, domain.ErrStaleVersion
+	}
+	if update.FirstName != nil {
+		u.FirstName = *update.FirstName
+	}
+	if update.LastName != nil {
+		u.LastName = *update.LastName
+	}
+	u.UpdatedAt = u.UpdatedAt.Add(time.Second)
+	return u, nil
+}
+
+func (r *loginUserRepo) ReplaceUserPreferences(ctx context.Context, userID int, preferences []string, version *time.Time) (*domain.Preferences, error) {
+	p, err := r.GetUserPreferencesByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if version != nil && !version.Equal(p.UpdatedAt) {
+		return nil, domain.ErrStaleVersion
+	}
+	p.UserPreferences = preferences
+	p.UpdatedAt = p.UpdatedAt.Add(time.Second)
+	return p, nil
+}
+
+func (r *loginUserRepo) UpdateUserRole(ctx context.Context, id int, role string) error {
+	u, err := r.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	u.Role = role
+	return nil
+}
+
+// plainHasher compares plaintexts, which is enough to drive the login flow.
+type plainHasher struct{}
+
+func (plainHasher) Hash(plaintext string, preHash bool) (string, error) {
+	return plaintext, nil
+}
+
+func (plainHasher) VerifyHash(hashedtext []byte, plaintext string, preHash bool) error {
+	if string(hashedtext) != plaintext {
+		return domain.ErrInvalidCredentials
+	}
+	return nil
+}
+
+type fakeJwt struct{}
+
+func (fakeJwt) CreateJWTToken(id int, email string, role string) (*domain.TokenPair, error) {
+	return &domain.TokenPair{AccessToken: "access:" + role, RefreshToken: "refresh"}, nil
+}
+
+func (fakeJwt) VerifyJWTToken(tokenString string) (*domain.IdentityToken, error) {
+	return nil, domain.ErrInvalidJWTToken
+}
+
+func (fakeJwt) VerifyRefreshToken(tokenString string) (*domain.IdentityToken, error) {
+	return nil, domain.ErrInvalidJWTToken
+}
+
+type fakeRefreshTokenRepo struct{}
+
+func (fakeRefreshTokenRepo) StoreRefreshToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	return nil
+}
+
+func (fakeRefreshTokenRepo) RetrieveRefreshToken(ctx context.Context, userID int) (*domain.RefreshToken, error) {
+	return nil, domain.ErrInvalidJWTToken
+}
+
+func (fakeRefreshTokenRepo) UpdateRefreshToken(ctx context.Context, userID int, revokedAt time.Time) error {
+	return nil
+}
+
+func (fakeRefreshTokenRepo) RevokeUserRefreshTokens(ctx context.Context, userID int, revokedAt time.Time) error {
+	return nil
+}
+
+func newLoginUsers() *loginUserRepo {
+	return &loginUserRepo{users: map[string]*domain.User{
+		"reza@example.com":  {ID: 7, Email: "reza@example.com", Password: "secret-password", Role: domain.RoleUser},
+		"admin@example.com": {ID: 1, Email: "admin@example.com", Password: "admin-password", Role: domain.RoleAdmin},
+	}}
+}
+
+func newLoginService(audit domain.AuditRepository) *UserService {
+	users := newLoginUsers()
+	return NewUserRegisterService(users, nil, plainHasher{}, nil, nil, nil, nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, audit, nopLogger{})
+}
+
+func TestAuthenticateUserRecordsAuditEvents(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        domain.LoginUser
+		wantUserID *int
+		outcome    string
+		reason     string
+	}{
+		{"success", domain.LoginUser{Email: "reza@example.com", Password: "secret-password"}, ptr(7), domain.AuditOutcomeSuccess, ""},
+		{"wrong password", domain.LoginUser{Email: "reza@example.com", Password: "guess"}, ptr(7), domain.AuditOutcomeFailure, "invalid credentials"},
+		{"unknown email", domain.LoginUser{Email: "nobody@example.com", Password: "guess"}, nil, domain.AuditOutcomeFailure, "user not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audit := &fakeAuditRepo{}
+			ctx := observability.WithClientIP(observability.WithRequestID(context.Background(), "req-1"), "203.0.113.9")
+
+			_, err := newLoginService(audit).AuthenticateUser(ctx, tt.req)
+			if (err == nil) != (tt.outcome == domain.AuditOutcomeSuccess) {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if len(audit.events) != 1 {
+				t.Fatalf("recorded %d events, want 1", len(audit.events))
+			}
+			e := audit.events[0]
+			if e.EventType != domain.AuditLogin || e.Outcome != tt.outcome {
+				t.Errorf("got %s/%s, want %s/%s", e.EventType, e.Outcome, domain.AuditLogin, tt.outcome)
+			}
+			if (e.UserID == nil) != (tt.wantUserID == nil) || (e.UserID != nil && *e.UserID != *tt.wantUserID) {
+				t.Errorf("user id = %v, want %v", e.UserID, tt.wantUserID)
+			}
+			if e.Metadata["reason"] != tt.reason {
+				t.Errorf("metadata = %v", e.Metadata)
+			}
+			// audit rows are never deleted, so they must not hold the email
+			for k, v := range e.Metadata {
+				if v == tt.req.Email {
+					t.Errorf("metadata %s holds the email", k)
+				}
+			}
+			if e.RequestID != "req-1" || e.ClientIP != "203.0.113.9" || e.ActorID != nil {
+				t.Errorf("request context not recorded: %+v", e)
+			}
+		})
+	}
+}
+
+func TestListAuditEventsIsAudited(t *testing.T) {
+	audit := &fakeAuditRepo{}
+	for i := 0; i < 3; i++ {
+		_ = audit.RecordAuditEvent(context.Background(), domain.AuditEvent{EventType: domain.AuditLogin})
+	}
+	svc := NewAuditService(audit, nopLogger{})
+	ctx := observability.WithUserID(context.Background(), 1)
+
+	page, err := svc.ListEvents(ctx, domain.AuditFilter{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Events) != 2 || page.NextCursor != page.Events[1].ID {
+		t.Errorf("page = %+v, want 2 events and a cursor", page)
+	}
+
+	last := audit.events[len(audit.events)-1]
+	if last.EventType != domain.AuditAuditLogQuery || last.ActorID == nil || *last.ActorID != 1 {
+		t.Errorf("query not audited: %+v", last)
+	}
+
+	var de *domain.DomainError
+	if _, err := svc.ListEvents(ctx, domain.AuditFilter{Limit: maxAuditPageSize + 1}); !errors.As(err, &de) || de.Code != domain.ErrCodeValidation {
+		t.Errorf("oversized page: got %v, want a validation error", err)
+	}
+}
+
+func ptr(v int) *int {
+	return &v
+}
+
+func TestLoginTokenCarriesTheUserRole(t *testing.T) {
+	resp, err := newLoginService(&fakeAuditRepo{}).AuthenticateUser(context.Background(), domain.LoginUser{Email: "admin@example.com", Password: "admin-password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AccessToken != "access:"+domain.RoleAdmin {
+		t.Errorf("access token = %q, want one issued for the admin role", resp.AccessToken)
+	}
+}
+
+func TestChangeUserRole(t *testing.T) {
+	users := newLoginUsers()
+	audit := &fakeAuditRepo{}
+	svc := NewAdminService(users, audit, nopLogger{})
+	ctx := observability.WithUserID(context.Background(), 1)
+
+	if err := svc.ChangeUserRole(ctx, 7, domain.RoleSupport); err != nil {
+		t.Fatal(err)
+	}
+	if users.users["reza@example.com"].Role != domain.RoleSupport {
+		t.Errorf("role not updated")
+	}
+	e := audit.events[0]
+	if e.EventType != domain.AuditRoleChange || e.Outcome != domain.AuditOutcomeSuccess || *e.ActorID != 1 || *e.UserID != 7 ||
+		e.Metadata["previous_role"] != domain.RoleUser || e.Metadata["role"] != domain.RoleSupport {
+		t.Errorf("unexpected audit event %+v", e)
+	}
+
+	if err := svc.ChangeUserRole(ctx, 1, domain.RoleUser); !errors.Is(err, domain.ErrOwnRoleChange) {
+		t.Errorf("own role change: got %v, want %v", err, domain.ErrOwnRoleChange)
+	}
+	if users.users["admin@example.com"].Role != domain.RoleAdmin {
+		t.Errorf("admin demoted themselves")
+	}
+	if last := audit.events[len(audit.events)-1]; last.Outcome != domain.AuditOutcomeFailure {
+		t.Errorf("rejected change not audited as a failure: %+v", last)
+	}
+}
+
+func TestDeleteAccountRequiresConfirmation(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"wrong password", "guess", true},
+		{"no confirmation", "", true},
+		{"password", "secret-password", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newLoginUsers()
+			audit := &fakeAuditRepo{}
+			svc := NewUserRegisterService(users, nil, plainHasher{}, nil, nil, nil, nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, audit, nopLogger{})
+
+			_, err := svc.DeleteAccount(context.Background(), domain.DeleteUser{ID: 7, Password: tt.password})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if deleted := users.deleted[7]; deleted == tt.wantErr {
+				t.Errorf("deleted = %v, want %v", deleted, !tt.wantErr)
+			}
+			if e := audit.events[0]; e.EventType != domain.AuditUserDeletion || (e.Outcome == domain.AuditOutcomeFailure) != tt.wantErr {
+				t.Errorf("unexpected audit event %+v", e)
+			}
+		})
+	}
+}
+
+func TestRestoreAccountWithinGracePeriod(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		deletedAt time.Duration
+		deletedBy string
+		wantErr   error
+	}{
+		{"within grace period", "secret-password", time.Hour, domain.DeletedBySelf, nil},
+		{"deleted before deleted_by was recorded", "secret-password", time.Hour, "", nil},
+		{"wrong password", "guess", time.Hour, domain.DeletedBySelf, domain.ErrInvalidCredentials},
+		{"grace period over", "secret-password", 31 * 24 * time.Hour, domain.DeletedBySelf, domain.ErrDeletionGraceExpired},
+		{"deleted by an admin", "secret-password", time.Hour, domain.DeletedByAdmin, domain.ErrDeletedByAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newLoginUsers()
+			deletedAt := time.Now().Add(-tt.deletedAt)
+			users.users["reza@example.com"].DeletedAt = &deletedAt
+			users.users["reza@example.com"].DeletedBy = tt.deletedBy
+			audit := &fakeAuditRepo{}
+			svc := NewUserRegisterService(users, nil, plainHasher{}, nil, nil, nil, nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, audit, nopLogger{})
+
+			_, err := svc.RestoreAccount(context.Background(), domain.RestoreUser{Email: "reza@example.com", Password: tt.password}, 30*24*time.Hour)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if restored := users.users["reza@example.com"].DeletedAt == nil; restored != (tt.wantErr == nil) {
+				t.Errorf("restored = %v, want %v", restored, tt.wantErr == nil)
+			}
+			if e := audit.events[0]; e.EventType != domain.AuditUserRestoration || (e.Outcome == domain.AuditOutcomeSuccess) != (tt.wantErr == nil) {
+				t.Errorf("unexpected audit event %+v", e)
+			}
+		})
+	}
+}
+
+func TestDeletedAccountCannotLogIn(t *testing.T) {
+	users := newLoginUsers()
+	svc := NewUserRegisterService(users, nil, plainHasher{}, nil, nil, nil, nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, &fakeAuditRepo{}, nopLogger{})
+
+	if _, err := svc.DeleteAccount(context.Background(), domain.DeleteUser{ID: 7, Password: "secret-password"}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := svc.AuthenticateUser(context.Background(), domain.LoginUser{Email: "reza@example.com", Password: "secret-password"}); err == nil {
+		t.Fatal("deleted account logged in")
+	}
+	if _, err := svc.RestoreAccount(context.Background(), domain.RestoreUser{Email: "reza@example.com", Password: "secret-password"}, time.Hour); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if _, err := svc.AuthenticateUser(context.Background(), domain.LoginUser{Email: "reza@example.com", Password: "secret-password"}); err != nil {
+		t.Fatalf("restored account cannot log in: %v", err)
+	}
+}
+
+func TestAdminDeletedAccountCannotBeRestored(t *testing.T) {
+	users := newLoginUsers()
+	svc := NewUserRegisterService(users, nil, plainHasher{}, nil, nil, nil, nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, &fakeAuditRepo{}, nopLogger{})
+
+	if _, err := svc.DeleteUser(context.Background(), 7); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	_, err := svc.RestoreAccount(context.Background(), domain.RestoreUser{Email: "reza@example.com", Password: "secret-password"}, time.Hour)
+	if !errors.Is(err, domain.ErrDeletedByAdmin) {
+		t.Fatalf("err = %v, want %v", err, domain.ErrDeletedByAdmin)
+	}
+	if users.users["reza@example.com"].DeletedAt == nil {
+		t.Error("account deleted by an admin was restored")
+	}
+}
+
+// Accounts created through an identity provider have no password, so the
+// emailed code is their only way back.
+func TestRestoreAccountWithEmailedOTP(t *testing.T) {
+	users := newLoginUsers()
+	users.users["reza@example.com"].Password = ""
+	mailer := &recordingMailer{}
+	otps := &fakeOTPs{}
+	svc := NewUserRegisterService(users, nil, plainHasher{}, mailer, otps, fixedOTP("246810"), nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, &fakeAuditRepo{}, nopLogger{})
+	ctx := context.Background()
+
+	if _, err := svc.RequestAccountDeletion(ctx, 7, 2); err != nil {
+		t.Fatalf("request deletion code: %v", err)
+	}
+	if _, err := svc.DeleteAccount(ctx, domain.DeleteUser{ID: 7, OTP: "246810"}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	mailer.sent = nil
+
+	unknown, err := svc.RequestAccountRestoration(ctx, "nobody@example.com", 2, time.Minute)
+	if err != nil {
+		t.Fatalf("unknown email: %v", err)
+	}
+	deleted, err := svc.RequestAccountRestoration(ctx, "reza@example.com", 2, time.Minute)
+	if err != nil {
+		t.Fatalf("request code: %v", err)
+	}
+	if deleted.Message != unknown.Message {
+		t.Errorf("answers differ, %q vs %q", deleted.Message, unknown.Message)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].kind != "account_restoration" || mailer.sent[0].body != "246810" {
+		t.Fatalf("restoration code not sent: %+v", mailer.sent)
+	}
+
+	if _, err := svc.RestoreAccount(ctx, domain.RestoreUser{Email: "reza@example.com", OTP: "000000"}, time.Hour); !errors.Is(err, domain.ErrInvalidOtp) {
+		t.Fatalf("wrong code: got %v, want %v", err, domain.ErrInvalidOtp)
+	}
+	if _, err := svc.RestoreAccount(ctx, domain.RestoreUser{Email: "reza@example.com", OTP: "246810"}, time.Hour); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if users.users["reza@example.com"].DeletedAt != nil {
+		t.Error("account was not restored")
+	}
+}
+
+// fakeOTPs keeps plain codes, which plainHasher hashes to themselves.
+// Cooldowns never run out.
+type fakeOTPs struct {
+	codes     map[string]string
+	cooldowns map[string]bool
+}
+
+func (o *fakeOTPs) ReserveResend(ctx context.Context, key string, cooldown time.Duration) (bool, error) {
+	if o.cooldowns[key] {
+		return false, nil
+	}
+	if o.cooldowns == nil {
+		o.cooldowns = make(map[string]bool)
+	}
+	o.cooldowns[key] = true
+	return true, nil
+}
+
+func (o *fakeOTPs) SaveOTP(ctx context.Context, key string, otp string, expiration int) error {
+	if o.codes == nil {
+		o.codes = make(map[string]string)
+	}
+	o.codes[key] = otp
+	return nil
+}
+
+func (o *fakeOTPs) VerifyOTP(ctx context.Context, key string, sentotp string) error {
+	otp, ok := o.codes[key]
+	if !ok {
+		return domain.ErrOtpKeyNotFound
+	}
+	if otp != sentotp {
+		return domain.ErrInvalidOtp
+	}
+	delete(o.codes, key)
+	return nil
+}
+
+type fixedOTP string
+
+func (f fixedOTP) GenerateOTP() (string, error) { return string(f), nil }
+
+type fixedToken string
+
+func (f fixedToken) GenerateToken() (string, error) { return string(f), nil }
+
+// sentMail records who got which email.
+type sentMail struct {
+	kind string
+	to   string
+	body string
+}
+
+type recordingMailer struct {
+	sent []sentMail
+}
+
+func (m *recordingMailer) SendVerificationEmail(ctx context.Context, email string, otp string) error {
+	m.sent = append(m.sent, sentMail{"verification", email, otp})
+	return nil
+}
+
+func (m *recordingMailer) SendNotificationEmail(ctx context.Context, email string) error {
+	m.sent = append(m.sent, sentMail{"notification", email, ""})
+	return nil
+}
+
+func (m *recordingMailer) SendAccountDeletionEmail(ctx context.Context, email string, otp string) error {
+	m.sent = append(m.sent, sentMail{"account_deletion", email, otp})
+	return nil
+}
+
+func (m *recordingMailer) SendAccountRestorationEmail(ctx context.Context, email string, otp string) error {
+	m.sent = append(m.sent, sentMail{"account_restoration", email, otp})
+	return nil
+}
+
+func (m *recordingMailer) SendEmailChangeEmail(ctx context.Context, email string, otp string) error {
+	m.sent = append(m.sent, sentMail{"email_change", email, otp})
+	return nil
+}
+
+func (m *recordingMailer) SendEmailChangedEmail(ctx context.Context, oldEmail string, newEmail string) error {
+	m.sent = append(m.sent, sentMail{"email_changed", oldEmail, newEmail})
+	return nil
+}
+
+func (m *recordingMailer) SendMagicLinkEmail(ctx context.Context, email string, link string) error {
+	m.sent = append(m.sent, sentMail{"magic_link", email, link})
+	return nil
+}
+
+// stagingRepo implements the email change and resend parts of
+// UserVerificationRepository on top of a loginUserRepo. pending maps the
+// emails of pending registrations to when they expire.
+type stagingRepo struct {
+	domain.UserVerificationRepository
+	users         *loginUserRepo
+	staged        map[int]string
+	stagedAt      map[int]time.Time
+	pending       map[string]time.Time
+	registrations map[string]registration
+}
+
+// registration is a pending registration under its verification id.
+type registration struct {
+	email     string
+	expiresAt time.Time
+}
+
+// RetrieveVerificationData matches the postgres query: by verification id,
+// or by email when the id is empty, and only while unexpired.
+func (r *stagingRepo) RetrieveVerificationData(ctx context.Context, verificationID, email string) (string, error) {
+	for id, reg := range r.registrations {
+		matches := id == verificationID
+		if verificationID == "" {
+			matches = reg.email == email
+		}
+		if matches && reg.expiresAt.After(time.Now()) {
+			return reg.email, nil
+		}
+	}
+	return "", domain.ErrVerificationNotFound
+}
+
+func (r *stagingRepo) PersistUserInfo(ctx context.Context, email string) (int, []string, error) {
+	id := len(r.users.users) + 100
+	r.users.users[email] = &domain.User{ID: id, Email: email, Role: domain.RoleUser}
+	return id, nil, nil
+}
+
+func (r *stagingRepo) PersistUserPreferenes(ctx context.Context, userID int, preferences []string) error {
+	return nil
+}
+
+func (r *stagingRepo) DeleteUserFromStaging(ctx context.Context, email string) error {
+	for id, reg := range r.registrations {
+		if reg.email == email {
+			delete(r.registrations, id)
+		}
+	}
+	return nil
+}
+
+func (r *stagingRepo) RenewVerificationData(ctx context.Context, email string, expiresAt time.Time) error {
+	if _, ok := r.pending[email]; !ok {
+		return domain.ErrEmailNotFound
+	}
+	r.pending[email] = expiresAt
+	return nil
+}
+
+func (r *stagingRepo) StageEmailChange(ctx context.Context, userID int, email string) error {
+	if r.staged == nil {
+		r.staged = make(map[int]string)
+		r.stagedAt = make(map[int]time.Time)
+	}
+	r.staged[userID] = email
+	r.stagedAt[userID] = time.Now()
+	return nil
+}
+
+func (r *stagingRepo) GetStagedEmailChange(ctx context.Context, userID int) (string, error) {
+	email, ok := r.staged[userID]
+	if !ok {
+		return "", domain.ErrNoEmailChange
+	}
+	return email, nil
+}
+
+// ConfirmEmailChange matches the postgres query: only the given email, and
+// only while younger than maxAge.
+func (r *stagingRepo) ConfirmEmailChange(ctx context.Context, userID int, email string, maxAge time.Duration) (string, error) {
+	if staged, ok := r.staged[userID]; !ok || staged != email || time.Since(r.stagedAt[userID]) >= maxAge {
+		return "", domain.ErrNoEmailChange
+	}
+	if _, taken := r.users.users[email]; taken {
+		return "", domain.ErrEmailTaken
+	}
+	u, err := r.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	old := u.Email
+	delete(r.users.users, old)
+	u.Email = email
+	r.users.users[email] = u
+	delete(r.staged, userID)
+	return old, nil
+}
+
+type revokingRefreshTokenRepo struct {
+	fakeRefreshTokenRepo
+	revoked []int
+}
+
+func (r *revokingRefreshTokenRepo) RevokeUserRefreshTokens(ctx context.Context, userID int, revokedAt time.Time) error {
+	r.revoked = append(r.revoked, userID)
+	return nil
+}
+
+func TestEmailChangeNeedsTheCodeSentToTheNewEmail(t *testing.T) {
+	users := newLoginUsers()
+	staging := &stagingRepo{users: users}
+	mailer := &recordingMailer{}
+	tokens := &revokingRefreshTokenRepo{}
+	audit := &fakeAuditRepo{}
+	svc := NewUserRegisterService(users, staging, plainHasher{}, mailer, &fakeOTPs{}, fixedOTP("123456"), nil, fakeJwt{}, tokens, nil, audit, nopLogger{})
+	ctx := context.Background()
+
+	if _, err := svc.RequestEmailChange(ctx, domain.EmailChange{UserID: 7, Email: "new@example.com", Password: "guess"}, 2); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("wrong password: got %v, want %v", err, domain.ErrInvalidCredentials)
+	}
+	if _, err := svc.RequestEmailChange(ctx, domain.EmailChange{UserID: 7, Email: "admin@example.com", Password: "secret-password"}, 2); !errors.Is(err, domain.ErrEmailTaken) {
+		t.Fatalf("taken email: got %v, want %v", err, domain.ErrEmailTaken)
+	}
+	if _, err := svc.RequestEmailChange(ctx, domain.EmailChange{UserID: 7, Email: "new@example.com", Password: "secret-password"}, 2); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if users.users["reza@example.com"] == nil {
+		t.Fatal("email changed before it was confirmed")
+	}
+	if last := mailer.sent[len(mailer.sent)-1]; last.kind != "email_change" || last.to != "new@example.com" {
+		t.Errorf("code not sent to the new email: %+v", last)
+	}
+
+	if _, err := svc.ConfirmEmailChange(ctx, 7, "000000", 2); !errors.Is(err, domain.ErrInvalidOtp) {
+		t.Fatalf("wrong code: got %v, want %v", err, domain.ErrInvalidOtp)
+	}
+	if _, err := svc.ConfirmEmailChange(ctx, 7, "123456", 2); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if u := users.users["new@example.com"]; u == nil || u.ID != 7 {
+		t.Fatalf("email not changed: %+v", users.users)
+	}
+	if len(tokens.revoked) != 1 || tokens.revoked[0] != 7 {
+		t.Errorf("sessions not revoked: %v", tokens.revoked)
+	}
+	if last := mailer.sent[len(mailer.sent)-1]; last.kind != "email_changed" || last.to != "reza@example.com" {
+		t.Errorf("old email not notified: %+v", last)
+	}
+	if last := audit.events[len(audit.events)-1]; last.EventType != domain.AuditEmailChange || last.Outcome != domain.AuditOutcomeSuccess || len(last.Metadata) != 1 || last.Metadata["step"] != "confirm" {
+		t.Errorf("unexpected audit event %+v", last)
+	}
+}
+
+// restagingOTPs restages the email change right after the code is checked,
+// like a second request to change the email racing the confirmation.
+type restagingOTPs struct {
+	*fakeOTPs
+	staging *stagingRepo
+	email   string
+}
+
+func (o restagingOTPs) VerifyOTP(ctx context.Context, key string, sentotp string) error {
+	err := o.fakeOTPs.VerifyOTP(ctx, key, sentotp)
+	_ = o.staging.StageEmailChange(ctx, 7, o.email)
+	return err
+}
+
+func TestConfirmEmailChangeOnlySwapsInTheCheckedEmail(t *testing.T) {
+	users := newLoginUsers()
+	staging := &stagingRepo{users: users}
+	otps := restagingOTPs{fakeOTPs: &fakeOTPs{}, staging: staging, email: "attacker@example.com"}
+	svc := NewUserRegisterService(users, staging, plainHasher{}, &recordingMailer{}, otps, fixedOTP("123456"), nil, fakeJwt{}, &revokingRefreshTokenRepo{}, nil, &fakeAuditRepo{}, nopLogger{})
+	ctx := context.Background()
+
+	if _, err := svc.RequestEmailChange(ctx, domain.EmailChange{UserID: 7, Email: "new@example.com", Password: "secret-password"}, 2); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if _, err := svc.ConfirmEmailChange(ctx, 7, "123456", 2); !errors.Is(err, domain.ErrNoEmailChange) {
+		t.Fatalf("confirm after restaging: got %v, want %v", err, domain.ErrNoEmailChange)
+	}
+	if users.users["attacker@example.com"] != nil || users.users["reza@example.com"] == nil {
+		t.Errorf("email changed to the restaged address: %+v", users.users)
+	}
+}
+
+func TestConfirmEmailChangeRejectsStaleStagedEmail(t *testing.T) {
+	users := newLoginUsers()
+	staging := &stagingRepo{users: users}
+	svc := NewUserRegisterService(users, staging, plainHasher{}, &recordingMailer{}, &fakeOTPs{}, fixedOTP("123456"), nil, fakeJwt{}, &revokingRefreshTokenRepo{}, nil, &fakeAuditRepo{}, nopLogger{})
+	ctx := context.Background()
+
+	if _, err := svc.RequestEmailChange(ctx, domain.EmailChange{UserID: 7, Email: "new@example.com", Password: "secret-password"}, 2); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	staging.stagedAt[7] = time.Now().Add(-3 * time.Minute)
+
+	if _, err := svc.ConfirmEmailChange(ctx, 7, "123456", 2); !errors.Is(err, domain.ErrNoEmailChange) {
+		t.Fatalf("confirm of a stale change: got %v, want %v", err, domain.ErrNoEmailChange)
+	}
+	if users.users["new@example.com"] != nil {
+		t.Errorf("stale email change was applied: %+v", users.users)
+	}
+}
+
+func TestVerifyUserByVerificationID(t *testing.T) {
+	tests := []struct {
+		name           string
+		verificationID string
+		email          string
+		wantErr        error
+	}{
+		{"pending registration", "ver-new", "", nil},
+		{"falls back to email", "", "new@example.com", nil},
+		{"expired registration", "ver-old", "", domain.ErrVerificationNotFound},
+		{"expired registration by email", "", "old@example.com", domain.ErrVerificationNotFound},
+		{"unknown verification id", "ver-unknown", "new@example.com", domain.ErrVerificationNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newLoginUsers()
+			staging := &stagingRepo{users: users, registrations: map[string]registration{
+				"ver-new": {email: "new@example.com", expiresAt: time.Now().Add(time.Minute)},
+				"ver-old": {email: "old@example.com", expiresAt: time.Now().Add(-time.Minute)},
+			}}
+			otps := &fakeOTPs{codes: map[string]string{"new@example.com": "123456", "old@example.com": "123456"}}
+			svc := NewUserRegisterService(users, staging, plainHasher{}, nil, otps, nil, nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, &fakeAuditRepo{}, nopLogger{})
+
+			_, err := svc.VerifyUser(context.Background(), domain.RegisterVerify{VerificationID: tt.verificationID, Email: tt.email, SentOtpbyUser: "123456"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			_, created := users.users["new@example.com"]
+			if created != (tt.wantErr == nil) {
+				t.Errorf("user created = %v, want %v", created, tt.wantErr == nil)
+			}
+			if _, created := users.users["old@example.com"]; created {
+				t.Error("expired registration was verified")
+			}
+		})
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	expiresAt := time.Now().Add(time.Minute)
+	staging := &stagingRepo{pending: map[string]time.Time{"new@example.com": expiresAt}}
+	mailer := &recordingMailer{}
+	otps := &fakeOTPs{}
+	svc := NewUserRegisterService(newLoginUsers(), staging, plainHasher{}, mailer, otps, fixedOTP("654321"), nil, fakeJwt{}, fakeRefreshTokenRepo{}, nil, &fakeAuditRepo{}, nopLogger{})
+	ctx := context.Background()
+
+	unknown, err := svc.ResendVerification(ctx, "nobody@example.com", 2, time.Minute)
+	if err != nil {
+		t.Fatalf("unknown email: %v", err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Errorf("email sent for an unknown registration: %+v", mailer.sent)
+	}
+
+	pending, err := svc.ResendVerification(ctx, "new@example.com", 2, time.Minute)
+	if err != nil {
+		t.Fatalf("pending registration: %v", err)
+	}
+	if pending.Message != unknown.Message {
+		t.Errorf("answers differ, %q vs %q", pending.Message, unknown.Message)
+	}
+	if !staging.pending["new@example.com"].After(expiresAt) {
+		t.Errorf("registration not extended: %v", staging.pending)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].to != "new@example.com" || otps.codes["new@example.com"] != "654321" {
+		t.Errorf("new code not sent: %+v %v", mailer.sent, otps.codes)
+	}
+
+	if _, err := svc.ResendVerification(ctx, "new@example.com", 2, time.Minute); !errors.Is(err, domain.ErrResendCooldown) {
+		t.Errorf("resend within cooldown: got %v, want %v", err, domain.ErrResendCooldown)
+	}
+}
+
+func TestMagicLinkLogsInOnce(t *testing.T) {
+	mailer := &recordingMailer{}
+	otps := &fakeOTPs{}
+	audit := &fakeAuditRepo{}
+	svc := NewUserRegisterService(newLoginUsers(), nil, plainHasher{}, mailer, otps, nil, fixedToken("link-token"), fakeJwt{}, fakeRefreshTokenRepo{}, nil, audit, nopLogger{})
+	ctx := context.Background()
+
+	unknown, err := svc.RequestMagicLink(ctx, "nobody@example.com", "https://app.example.com/login?src=mail", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("unknown email: %v", err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Errorf("link sent for an unknown email: %+v", mailer.sent)
+	}
+
+	known, err := svc.RequestMagicLink(ctx, "reza@example.com", "https://app.example.com/login?src=mail", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("request link: %v", err)
+	}
+	if known.Message != unknown.Message {
+		t.Errorf("answers differ, %q vs %q", known.Message, unknown.Message)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("want one email, got %+v", mailer.sent)
+	}
+	link, err := url.Parse(mailer.sent[0].body)
+	if err != nil {
+		t.Fatalf("link %q: %v", mailer.sent[0].body, err)
+	}
+	query := link.Query()
+	if query.Get("email") != "reza@example.com" || query.Get("token") != "link-token" || query.Get("src") != "mail" {
+		t.Errorf("unexpected link %s", link)
+	}
+	if otps.codes[magicLinkKey("reza@example.com")] != "link-token" {
+		t.Errorf("token not stored: %v", otps.codes)
+	}
+
+	if _, err := svc.LoginWithMagicLink(ctx, "reza@example.com", "guess"); !errors.Is(err, domain.ErrInvalidMagicLink) {
+		t.Errorf("wrong token: got %v, want %v", err, domain.ErrInvalidMagicLink)
+	}
+	resp, err := svc.LoginWithMagicLink(ctx, "reza@example.com", "link-token")
+	if err != nil {
+		t.Fatalf("login with link: %v", err)
+	}
+	if resp.AccessToken == "" || resp.RefreshToken == "" {
+		t.Errorf("missing tokens: %+v", resp)
+	}
+	if _, err := svc.LoginWithMagicLink(ctx, "reza@example.com", "link-token"); !errors.Is(err, domain.ErrInvalidMagicLink) {
+		t.Errorf("reused link: got %v, want %v", err, domain.ErrInvalidMagicLink)
+	}
+
+	var logins int
+	for _, e := range audit.events {
+		if e.EventType == domain.AuditLogin && e.Outcome == domain.AuditOutcomeSuccess && e.Metadata["method"] == "magic_link" {
+			logins++
+		}
+	}
+	if logins != 1 {
+		t.Errorf("want one successful magic link login in the audit log, got %d: %+v", logins, audit.events)
+	}
+}
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS job_queue (
+    id BIGSERIAL PRIMARY KEY,
+    stream VARCHAR(256) NOT NULL,
+    payload JSONB NOT NULL,
+    run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMP NULL,
+    locked_by VARCHAR(256) NULL,
+    acked_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_queue_ready ON job_queue (stream, run_at, id) WHERE acked_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS job_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    stream VARCHAR(256) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE job_dead_letters;
+DROP INDEX IF EXISTS idx_job_queue_ready;
+DROP TABLE job_queue;
+-- +goose StatementEnd
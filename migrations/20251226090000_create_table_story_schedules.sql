@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS story_schedules (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    cron_expr VARCHAR(128) NOT NULL,
+    time_zone VARCHAR(64) NOT NULL,
+    missed_run_policy VARCHAR(16) NOT NULL DEFAULT 'skip' CHECK (missed_run_policy IN ('skip', 'run_once')),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_story_schedules_users
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_story_schedules_due ON story_schedules (next_run_at) WHERE enabled;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_story_schedules_due;
+DROP TABLE story_schedules;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE email_verification RENAME COLUMN request_id TO verification_id;
+-- request ids came from the client and may repeat, pending rows get fresh ids
+UPDATE email_verification SET verification_id = gen_random_uuid()::text;
+ALTER TABLE email_verification ALTER COLUMN verification_id SET DEFAULT gen_random_uuid()::text;
+ALTER TABLE email_verification ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ NULL;
+-- pending registrations keep a day to verify, the longest a registration is
+-- kept (REGISTRATION_MAX_AGE); the code in redis still expires on its own
+UPDATE email_verification SET expires_at = NOW() + INTERVAL '1 day' WHERE expires_at IS NULL;
+ALTER TABLE email_verification ALTER COLUMN expires_at SET DEFAULT NOW();
+ALTER TABLE email_verification ALTER COLUMN expires_at SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_verification_verification_id ON email_verification (verification_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_email_verification_verification_id;
+ALTER TABLE email_verification DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE email_verification ALTER COLUMN verification_id DROP DEFAULT;
+ALTER TABLE email_verification RENAME COLUMN verification_id TO request_id;
+-- +goose StatementEnd
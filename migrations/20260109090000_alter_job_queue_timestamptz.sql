@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE job_queue
+    ALTER COLUMN run_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN locked_until TYPE TIMESTAMPTZ,
+    ALTER COLUMN acked_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE job_dead_letters
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE job_dead_letters
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+
+ALTER TABLE job_queue
+    ALTER COLUMN run_at TYPE TIMESTAMP,
+    ALTER COLUMN locked_until TYPE TIMESTAMP,
+    ALTER COLUMN acked_at TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+-- +goose StatementEnd
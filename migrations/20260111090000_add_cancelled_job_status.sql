@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE story_status ADD VALUE IF NOT EXISTS 'cancelled';
+ALTER TYPE email_status ADD VALUE IF NOT EXISTS 'cancelled';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- enum values cannot be dropped, so cancelled jobs fall back to failed
+UPDATE story_jobs SET status = 'failed' WHERE status = 'cancelled';
+UPDATE email_jobs SET status = 'failed' WHERE status = 'cancelled';
+-- +goose StatementEnd
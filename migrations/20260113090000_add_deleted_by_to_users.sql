@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- NULL on accounts deleted before this column existed; they stay restorable
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(16) NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_by;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the 30 second step of the last accepted TOTP; codes at or before it are replays
+ALTER TABLE users_mfa ADD COLUMN IF NOT EXISTS last_totp_step BIGINT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users_mfa DROP COLUMN IF EXISTS last_totp_step;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- published rows are deleted from now on; drop the ones kept so far
+DELETE FROM outbox WHERE sent_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 1;
+-- +goose StatementEnd
@@ -1,25 +1,70 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 
 	"github.com/KianoushAmirpour/notification_server/internal/domain"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+const (
+	OutputStdout = "stdout"
+	OutputFile   = "file"
+	OutputBoth   = "both"
+)
+
+// Options configures where the logger writes and from which level. The file
+// output is appended to and rotated once it reaches MaxSizeMB; rotated files
+// are removed after MaxAgeDays or when more than MaxBackups exist (0 keeps
+// them all).
+type Options struct {
+	Level      string
+	Output     string
+	FilePath   string
+	MaxSizeMB  int
+	MaxAgeDays int
+	MaxBackups int
+	Compress   bool
+}
+
 type Logger struct {
 	SlogLogger *slog.Logger
 }
 
-func NewLogger(loggingFilePath string) *Logger {
-	file, err := os.Create(loggingFilePath)
-	if err != nil {
-		panic(err)
+func NewLogger(opts Options) (*Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", opts.Level, err)
 	}
 
-	logger := slog.New(slog.NewJSONHandler(file, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	var out io.Writer
+	switch opts.Output {
+	case OutputStdout:
+		out = os.Stdout
+	case OutputFile:
+		out = opts.rotatingFile()
+	case OutputBoth:
+		out = io.MultiWriter(os.Stdout, opts.rotatingFile())
+	default:
+		return nil, fmt.Errorf("invalid log output %q", opts.Output)
+	}
 
-	return &Logger{SlogLogger: logger}
+	logger := slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level, ReplaceAttr: Redact}))
+
+	return &Logger{SlogLogger: logger}, nil
+}
+
+func (opts Options) rotatingFile() io.Writer {
+	return &lumberjack.Logger{
+		Filename:   opts.FilePath,
+		MaxSize:    opts.MaxSizeMB,
+		MaxAge:     opts.MaxAgeDays,
+		MaxBackups: opts.MaxBackups,
+		Compress:   opts.Compress,
+	}
 }
 
 func (l Logger) Info(msg string, args ...interface{}) {
@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	emailPattern = regexp.MustCompile(`([A-Za-z0-9._%+\-])[A-Za-z0-9._%+\-]*@([A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+	jwtPattern   = regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`)
+)
+
+// secretKeys are attribute names whose value is dropped entirely. Only the
+// last segment of dotted ECS keys is compared, so "user.password" matches
+// but "event.action" with the value "hash_password" does not.
+var secretKeys = map[string]bool{
+	"password":      true,
+	"otp":           true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"secret":        true,
+	"authorization": true,
+	"cookie":        true,
+	"api_key":       true,
+}
+
+// Redact is a slog ReplaceAttr hook. It drops the value of secret attributes
+// and masks email addresses and JWTs in every other string, the message
+// included, so "to", "user_email" or an error text never carries them.
+func Redact(groups []string, a slog.Attr) slog.Attr {
+	if isSecretKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		if values, ok := a.Value.Any().([]string); ok {
+			masked := make([]string, len(values))
+			for i, v := range values {
+				masked[i] = redactString(v)
+			}
+			return slog.Any(a.Key, masked)
+		}
+	}
+	return a
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key[strings.LastIndex(key, ".")+1:])
+	if secretKeys[key] {
+		return true
+	}
+	return strings.HasSuffix(key, "_password") || strings.HasSuffix(key, "_token") || strings.HasSuffix(key, "_secret")
+}
+
+// redactString keeps the first letter and the domain of an email, which is
+// usually enough to correlate a log line with a support request.
+func redactString(s string) string {
+	if strings.Contains(s, "@") {
+		s = emailPattern.ReplaceAllString(s, "$1***@$2")
+	}
+	if strings.Contains(s, "eyJ") {
+		s = jwtPattern.ReplaceAllString(s, redacted)
+	}
+	return s
+}